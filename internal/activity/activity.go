@@ -0,0 +1,281 @@
+package activity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const earthRadiusMeters = 6371000.0
+
+var ErrUnsupportedFormat = errors.New("unsupported activity file format")
+var ErrNoTrackPoints = errors.New("activity file has no timed track points")
+
+type TrackPoint struct {
+	Lat       float64
+	Lon       float64
+	HasPos    bool
+	Elevation *float64
+	Distance  *float64 // cumulative distance reported by the device, if any
+	HeartRate *int
+	Time      time.Time
+}
+
+type Activity struct {
+	Format string
+	Name   string
+	Sport  string
+	Points []TrackPoint
+}
+
+type HeartRateSample struct {
+	OffsetSeconds int `json:"offset_seconds"`
+	BPM           int `json:"bpm"`
+}
+
+type Split struct {
+	Index               int     `json:"index"`
+	DistanceMeters      float64 `json:"distance_meters"`
+	DurationSeconds     int     `json:"duration_seconds"`
+	ElevationGainMeters float64 `json:"elevation_gain_meters"`
+	AvgHeartRate        *int    `json:"avg_heart_rate,omitempty"`
+}
+
+type Summary struct {
+	StartedAt           time.Time
+	DistanceMeters      float64
+	DurationSeconds     int
+	ElevationGainMeters float64
+	ElevationLossMeters float64
+	AvgHeartRate        *int
+	MaxHeartRate        *int
+	HeartRateSamples    []HeartRateSample
+	Splits              []Split
+	Route               [][2]float64
+}
+
+// Parse picks the parser from the file extension and falls back to
+// sniffing the root element when the extension doesn't tell us.
+func Parse(filename string, r io.Reader) (*Activity, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpx":
+		return ParseGPX(bytes.NewReader(data))
+	case ".tcx":
+		return ParseTCX(bytes.NewReader(data))
+	}
+
+	switch {
+	case bytes.Contains(data, []byte("<gpx")):
+		return ParseGPX(bytes.NewReader(data))
+	case bytes.Contains(data, []byte("<TrainingCenterDatabase")):
+		return ParseTCX(bytes.NewReader(data))
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+// Summarize computes totals, per-split figures and a simplified route.
+// splitMeters is the split length (1000 for km splits) and tolerance is the
+// route simplification tolerance in meters.
+func (a *Activity) Summarize(splitMeters, tolerance float64) *Summary {
+	summary := &Summary{}
+	if len(a.Points) == 0 {
+		return summary
+	}
+
+	start := a.Points[0].Time
+	summary.StartedAt = start
+	summary.DurationSeconds = int(a.Points[len(a.Points)-1].Time.Sub(start).Seconds())
+
+	useDevice := true
+	for _, p := range a.Points {
+		if p.Distance == nil {
+			useDevice = false
+			break
+		}
+	}
+
+	var (
+		distance     float64
+		hrTotal      int
+		hrCount      int
+		maxHR        int
+		prev         *TrackPoint
+		splitStart   = a.Points[0]
+		splitStartAt float64
+		splitGain    float64
+		splitHRTotal int
+		splitHRCount int
+	)
+
+	closeSplit := func(p TrackPoint, dist float64) {
+		split := Split{
+			Index:               len(summary.Splits) + 1,
+			DistanceMeters:      round2(dist - splitStartAt),
+			DurationSeconds:     int(p.Time.Sub(splitStart.Time).Seconds()),
+			ElevationGainMeters: round2(splitGain),
+		}
+		if splitHRCount > 0 {
+			avg := splitHRTotal / splitHRCount
+			split.AvgHeartRate = &avg
+		}
+		summary.Splits = append(summary.Splits, split)
+		splitStart = p
+		splitStartAt = dist
+		splitGain = 0
+		splitHRTotal = 0
+		splitHRCount = 0
+	}
+
+	for i := range a.Points {
+		p := a.Points[i]
+
+		if prev != nil {
+			switch {
+			case useDevice:
+				distance = *p.Distance
+			case p.HasPos && prev.HasPos:
+				distance += haversine(prev.Lat, prev.Lon, p.Lat, p.Lon)
+			}
+
+			if p.Elevation != nil && prev.Elevation != nil {
+				delta := *p.Elevation - *prev.Elevation
+				if delta > 0 {
+					summary.ElevationGainMeters += delta
+					splitGain += delta
+				} else {
+					summary.ElevationLossMeters -= delta
+				}
+			}
+		}
+
+		if p.HeartRate != nil {
+			hr := *p.HeartRate
+			hrTotal += hr
+			hrCount++
+			splitHRTotal += hr
+			splitHRCount++
+			if hr > maxHR {
+				maxHR = hr
+			}
+			summary.HeartRateSamples = append(summary.HeartRateSamples, HeartRateSample{
+				OffsetSeconds: int(p.Time.Sub(start).Seconds()),
+				BPM:           hr,
+			})
+		}
+
+		if splitMeters > 0 && distance-splitStartAt >= splitMeters {
+			closeSplit(p, distance)
+		}
+
+		prev = &a.Points[i]
+	}
+
+	last := a.Points[len(a.Points)-1]
+	if splitMeters > 0 && distance-splitStartAt > 0 {
+		closeSplit(last, distance)
+	}
+
+	summary.DistanceMeters = round2(distance)
+	summary.ElevationGainMeters = round2(summary.ElevationGainMeters)
+	summary.ElevationLossMeters = round2(summary.ElevationLossMeters)
+	if hrCount > 0 {
+		avg := hrTotal / hrCount
+		summary.AvgHeartRate = &avg
+		summary.MaxHeartRate = &maxHR
+	}
+
+	summary.Route = Simplify(a.Points, tolerance)
+
+	return summary
+}
+
+// Simplify reduces the track to a [lat, lon] polyline using
+// Douglas-Peucker with the given tolerance in meters.
+func Simplify(points []TrackPoint, tolerance float64) [][2]float64 {
+	var line [][2]float64
+	for _, p := range points {
+		if p.HasPos {
+			line = append(line, [2]float64{p.Lat, p.Lon})
+		}
+	}
+	if len(line) <= 2 {
+		return line
+	}
+
+	keep := make([]bool, len(line))
+	keep[0] = true
+	keep[len(line)-1] = true
+	douglasPeucker(line, 0, len(line)-1, tolerance, keep)
+
+	simplified := make([][2]float64, 0, len(line))
+	for i, p := range line {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+func douglasPeucker(line [][2]float64, first, last int, tolerance float64, keep []bool) {
+	if last <= first+1 {
+		return
+	}
+
+	maxDist := 0.0
+	index := first
+	for i := first + 1; i < last; i++ {
+		d := perpendicularDistance(line[i], line[first], line[last])
+		if d > maxDist {
+			maxDist = d
+			index = i
+		}
+	}
+
+	if maxDist > tolerance {
+		keep[index] = true
+		douglasPeucker(line, first, index, tolerance, keep)
+		douglasPeucker(line, index, last, tolerance, keep)
+	}
+}
+
+// perpendicularDistance projects onto a local equirectangular plane, which is
+// accurate enough at the scale of a single activity.
+func perpendicularDistance(p, a, b [2]float64) float64 {
+	refLat := a[0] * math.Pi / 180
+	toXY := func(q [2]float64) (float64, float64) {
+		x := (q[1] - a[1]) * math.Pi / 180 * math.Cos(refLat) * earthRadiusMeters
+		y := (q[0] - a[0]) * math.Pi / 180 * earthRadiusMeters
+		return x, y
+	}
+
+	px, py := toXY(p)
+	bx, by := toXY(b)
+
+	length := math.Hypot(bx, by)
+	if length == 0 {
+		return math.Hypot(px, py)
+	}
+	return math.Abs(bx*py-by*px) / length
+}
+
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
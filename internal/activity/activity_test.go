@@ -0,0 +1,116 @@
+package activity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"
+     xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <name>Morning Run</name>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="52.0000" lon="4.0000"><ele>10</ele><time>2025-01-01T07:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="52.0050" lon="4.0000"><ele>15</ele><time>2025-01-01T07:03:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>140</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="52.0100" lon="4.0000"><ele>12</ele><time>2025-01-01T07:06:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>160</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2025-01-01T07:00:00Z</Id>
+      <Lap StartTime="2025-01-01T07:00:00Z">
+        <Track>
+          <Trackpoint>
+            <Time>2025-01-01T07:00:00Z</Time>
+            <Position><LatitudeDegrees>52.0</LatitudeDegrees><LongitudeDegrees>4.0</LongitudeDegrees></Position>
+            <AltitudeMeters>5</AltitudeMeters>
+            <DistanceMeters>0</DistanceMeters>
+            <HeartRateBpm><Value>110</Value></HeartRateBpm>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2025-01-01T07:05:00Z</Time>
+            <Position><LatitudeDegrees>52.02</LatitudeDegrees><LongitudeDegrees>4.0</LongitudeDegrees></Position>
+            <AltitudeMeters>8</AltitudeMeters>
+            <DistanceMeters>2500</DistanceMeters>
+            <HeartRateBpm><Value>130</Value></HeartRateBpm>
+          </Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseGPX(t *testing.T) {
+	act, err := Parse("run.gpx", strings.NewReader(testGPX))
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpx", act.Format)
+	assert.Equal(t, "Morning Run", act.Name)
+	assert.Equal(t, "Running", act.Sport)
+	require.Len(t, act.Points, 3)
+	require.NotNil(t, act.Points[0].HeartRate)
+	assert.Equal(t, 120, *act.Points[0].HeartRate)
+
+	summary := act.Summarize(500, 10)
+	assert.InDelta(t, 1112, summary.DistanceMeters, 2)
+	assert.Equal(t, 360, summary.DurationSeconds)
+	assert.Equal(t, 5.0, summary.ElevationGainMeters)
+	assert.Equal(t, 3.0, summary.ElevationLossMeters)
+	require.NotNil(t, summary.AvgHeartRate)
+	assert.Equal(t, 140, *summary.AvgHeartRate)
+	assert.Equal(t, 160, *summary.MaxHeartRate)
+	assert.Len(t, summary.HeartRateSamples, 3)
+	assert.Len(t, summary.Splits, 2)
+	// the three points are collinear, so only the endpoints survive
+	assert.Len(t, summary.Route, 2)
+}
+
+func TestParseTCX(t *testing.T) {
+	// no extension, format is sniffed from the content
+	act, err := Parse("upload", strings.NewReader(testTCX))
+	require.NoError(t, err)
+
+	assert.Equal(t, "tcx", act.Format)
+	assert.Equal(t, "Cycling", act.Sport)
+
+	summary := act.Summarize(1000, 10)
+	assert.Equal(t, 2500.0, summary.DistanceMeters)
+	assert.Equal(t, 300, summary.DurationSeconds)
+	assert.Len(t, summary.Splits, 1)
+}
+
+func TestParseUnsupported(t *testing.T) {
+	_, err := Parse("notes.txt", strings.NewReader("hello"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestParseSkipsPointsWithoutTime(t *testing.T) {
+	gpx := `<gpx><trk><trkseg>
+      <trkpt lat="52.0000" lon="4.0000"></trkpt>
+      <trkpt lat="52.0050" lon="4.0000"><time>2025-01-01T07:03:00Z</time></trkpt>
+      <trkpt lat="52.0100" lon="4.0000"><time>2025-01-01T07:06:00Z</time></trkpt>
+    </trkseg></trk></gpx>`
+	act, err := Parse("run.gpx", strings.NewReader(gpx))
+	require.NoError(t, err)
+	require.Len(t, act.Points, 2)
+	assert.Equal(t, 180, act.Summarize(1000, 10).DurationSeconds)
+
+	untimed := `<gpx><trk><trkseg><trkpt lat="52.0000" lon="4.0000"></trkpt></trkseg></trk></gpx>`
+	_, err = Parse("run.gpx", strings.NewReader(untimed))
+	assert.ErrorIs(t, err, ErrNoTrackPoints)
+}
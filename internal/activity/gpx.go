@@ -0,0 +1,97 @@
+package activity
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat       float64  `xml:"lat,attr"`
+				Lon       float64  `xml:"lon,attr"`
+				Elevation *float64 `xml:"ele"`
+				Time      string   `xml:"time"`
+				HeartRate *int     `xml:"extensions>TrackPointExtension>hr"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+func ParseGPX(r io.Reader) (*Activity, error) {
+	var doc gpxFile
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &Activity{Format: "gpx", Name: doc.Metadata.Name}
+	for _, trk := range doc.Tracks {
+		if act.Name == "" {
+			act.Name = trk.Name
+		}
+		if act.Sport == "" {
+			act.Sport = normalizeSport(trk.Type)
+		}
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				if strings.TrimSpace(pt.Time) == "" {
+					// without a time the point can't be placed in the activity
+					continue
+				}
+				t, err := parseTime(pt.Time)
+				if err != nil {
+					return nil, err
+				}
+				act.Points = append(act.Points, TrackPoint{
+					Lat:       pt.Lat,
+					Lon:       pt.Lon,
+					HasPos:    true,
+					Elevation: pt.Elevation,
+					HeartRate: pt.HeartRate,
+					Time:      t,
+				})
+			}
+		}
+	}
+
+	if len(act.Points) == 0 {
+		return nil, ErrNoTrackPoints
+	}
+	if act.Sport == "" {
+		act.Sport = "Running"
+	}
+
+	return act, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339, strings.TrimSpace(value))
+}
+
+// normalizeSport maps the free-form type strings written by watches
+// ("running", "9", "Biking") onto the names we use for exercise entries.
+func normalizeSport(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return ""
+	case "running", "run", "9":
+		return "Running"
+	case "biking", "cycling", "ride", "1":
+		return "Cycling"
+	case "walking", "walk", "hiking":
+		return "Walking"
+	case "swimming", "swim":
+		return "Swimming"
+	default:
+		return "Other"
+	}
+}
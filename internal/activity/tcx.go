@@ -0,0 +1,78 @@
+package activity
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Laps  []struct {
+			Tracks []struct {
+				Points []struct {
+					Time     string `xml:"Time"`
+					Position *struct {
+						Lat float64 `xml:"LatitudeDegrees"`
+						Lon float64 `xml:"LongitudeDegrees"`
+					} `xml:"Position"`
+					Altitude  *float64 `xml:"AltitudeMeters"`
+					Distance  *float64 `xml:"DistanceMeters"`
+					HeartRate *int     `xml:"HeartRateBpm>Value"`
+				} `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+func ParseTCX(r io.Reader) (*Activity, error) {
+	var doc tcxFile
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &Activity{Format: "tcx"}
+	for _, a := range doc.Activities {
+		if act.Sport == "" {
+			act.Sport = normalizeSport(a.Sport)
+		}
+		for _, lap := range a.Laps {
+			for _, trk := range lap.Tracks {
+				for _, pt := range trk.Points {
+					if strings.TrimSpace(pt.Time) == "" {
+						// without a time the point can't be placed in the activity
+						continue
+					}
+					t, err := parseTime(pt.Time)
+					if err != nil {
+						return nil, err
+					}
+					point := TrackPoint{
+						Elevation: pt.Altitude,
+						Distance:  pt.Distance,
+						HeartRate: pt.HeartRate,
+						Time:      t,
+					}
+					if pt.Position != nil {
+						point.Lat = pt.Position.Lat
+						point.Lon = pt.Position.Lon
+						point.HasPos = true
+					}
+					act.Points = append(act.Points, point)
+				}
+			}
+		}
+	}
+
+	if len(act.Points) == 0 {
+		return nil, ErrNoTrackPoints
+	}
+	if act.Sport == "" {
+		act.Sport = "Running"
+	}
+
+	return act, nil
+}
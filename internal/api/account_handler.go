@@ -0,0 +1,220 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+const dataExportTTL = 48 * time.Hour
+
+const dataExportReadme = `This archive contains all personal data we hold about your account.
+
+Each JSON file holds one kind of record:
+%s
+Authentication tokens are listed by scope and expiry only; the token
+values themselves are never stored in readable form.
+
+Generated at %s.
+`
+
+type AccountHandler struct {
+	accountStore store.AccountStore
+	logger       *log.Logger
+}
+
+func NewAccountHandler(accountStore store.AccountStore, logger *log.Logger) *AccountHandler {
+	return &AccountHandler{
+		accountStore: accountStore,
+		logger:       logger,
+	}
+}
+
+// HandleRequestDataExport queues a "download my data" export. The archive
+// is assembled by a background job; the returned download token can be
+// used on GET /data-exports/{token} once the status is ready.
+func (h *AccountHandler) HandleRequestDataExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	export, token, err := h.accountStore.CreateDataExport(user.ID, dataExportTTL)
+	if err != nil {
+		h.logger.Println("ERROR: createDataExport:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{
+		"data_export":    export,
+		"download_token": token.Plaintext,
+	})
+}
+
+func (h *AccountHandler) HandleGetDataExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid data export ID parameter"})
+		return
+	}
+
+	export, err := h.accountStore.GetDataExport(exportID, middleware.GetUser(r).ID)
+	if err != nil {
+		h.logger.Println("ERROR: getDataExport:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if export == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "data export not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data_export": export})
+}
+
+// HandleDownloadDataExport is public; the unguessable, time-limited token
+// in the URL is the credential.
+func (h *AccountHandler) HandleDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.accountStore.GetDataExportByToken(chi.URLParam(r, "token"))
+	if err != nil {
+		h.logger.Println("ERROR: getDataExportByToken:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if export == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invalid or expired download token"})
+		return
+	}
+
+	switch export.Status {
+	case store.DataExportPending:
+		utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data_export": export})
+		return
+	case store.DataExportFailed:
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "data export failed, please request a new one"})
+		return
+	}
+
+	filename := fmt.Sprintf("account-data-%s.zip", export.CreatedAt.UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(export.Archive)
+}
+
+// HandleEraseAccount permanently deletes the current user and everything
+// they own. The password is required again so a stolen token alone can't
+// wipe an account.
+func (h *AccountHandler) HandleEraseAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	matches, err := user.PasswordHash.Matches(req.Password)
+	if err != nil {
+		h.logger.Println("ERROR: passwordMatches:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !matches {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
+		return
+	}
+
+	counts, err := h.accountStore.EraseUser(user.ID)
+	if err != nil {
+		h.logger.Println("ERROR: eraseUser:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	h.logger.Printf("INFO: erased user %d: %v", user.ID, counts)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "Account and all personal data erased", "erased": counts})
+}
+
+// BuildDataExport is the handler of store.JobBuildDataExport. The export
+// is only marked failed once the job's last attempt failed.
+func (h *AccountHandler) BuildDataExport(ctx context.Context, job *store.Job, args store.DataExportJobArgs) error {
+	archive, err := h.assembleArchive(args.UserID)
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts {
+			failErr := h.accountStore.FailDataExport(args.ExportID, "could not assemble archive")
+			if failErr != nil {
+				h.logger.Printf("ERROR: failDataExport %d: %v", args.ExportID, failErr)
+			}
+		}
+		return err
+	}
+
+	return h.accountStore.CompleteDataExport(args.ExportID, archive)
+}
+
+func (h *AccountHandler) assembleArchive(userID int) ([]byte, error) {
+	data, err := h.accountStore.CollectUserData(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var listing string
+	for _, name := range names {
+		listing += fmt.Sprintf("  - %s.json\n", name)
+
+		var pretty bytes.Buffer
+		err = json.Indent(&pretty, data[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := zw.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(pretty.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("README.txt")
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(f, dataExportReadme, listing, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
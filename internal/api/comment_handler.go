@@ -0,0 +1,404 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+const (
+	maxCommentLength = 2000
+	maxEmojiBytes    = 32
+)
+
+// CommentHandler serves comments and reactions on workouts. Everyone who
+// can see a workout may comment and react; comments are edited by their
+// author and deleted by their author or the workout's owner.
+type CommentHandler struct {
+	commentStore store.CommentStore
+	workoutStore store.WorkoutStore
+	followStore  store.FollowStore
+	logger       *log.Logger
+}
+
+func NewCommentHandler(commentStore store.CommentStore, workoutStore store.WorkoutStore, followStore store.FollowStore, logger *log.Logger) *CommentHandler {
+	return &CommentHandler{
+		commentStore: commentStore,
+		workoutStore: workoutStore,
+		followStore:  followStore,
+		logger:       logger,
+	}
+}
+
+type commentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int64 `json:"parent_id"`
+	EntryID  *int64 `json:"entry_id"`
+}
+
+// HandleListComments lists the workout's comment threads, oldest first:
+// GET /workouts/{id}/comments?entry_id=&limit=&offset=
+func (ch *CommentHandler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return
+	}
+	entryID, err := readEntryIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, offset, ok := readPage(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := ch.commentStore.ListComments(int64(workout.ID), entryID, limit, offset)
+	if err != nil {
+		ch.logger.Println("ERROR: listComments:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comments": comments})
+}
+
+// HandleCreateComment comments on the workout, on one of its entries with
+// entry_id, or replies to a comment with parent_id.
+func (ch *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return
+	}
+
+	var req commentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Println("ERROR: decodeComment:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if msg := validateCommentBody(req.Body); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	comment := &store.Comment{
+		WorkoutID: int64(workout.ID),
+		EntryID:   req.EntryID,
+		ParentID:  req.ParentID,
+		Author:    store.UserRef{ID: user.ID, Username: user.Username},
+		Body:      strings.TrimSpace(req.Body),
+	}
+	err = ch.commentStore.CreateComment(comment)
+	if errors.Is(err, store.ErrCommentNotFound) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "parent_id is not a comment on this workout"})
+		return
+	}
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "entry_id is not an entry of this workout"})
+		return
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: createComment:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"comment": comment})
+}
+
+// HandleUpdateComment changes the body of the user's own comment.
+func (ch *CommentHandler) HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	_, comment, ok := ch.loadComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.Author.ID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the author can edit a comment"})
+		return
+	}
+
+	var req commentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Println("ERROR: decodeComment:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if msg := validateCommentBody(req.Body); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	comment.Body = strings.TrimSpace(req.Body)
+	err = ch.commentStore.UpdateComment(comment)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: updateComment:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comment": comment})
+}
+
+// HandleDeleteComment deletes a comment of the user's, or any comment on
+// the user's workout. Replies to it stay.
+func (ch *CommentHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	workout, comment, ok := ch.loadComment(w, r)
+	if !ok {
+		return
+	}
+	user := middleware.GetUser(r)
+	if comment.Author.ID != user.ID && workout.UserID != user.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the author or the workout's owner can delete a comment"})
+		return
+	}
+
+	err := ch.commentStore.DeleteComment(comment.WorkoutID, comment.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: deleteComment:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListReactions counts the reactions on the workout, or on one entry:
+// GET /workouts/{id}/reactions?entry_id=
+func (ch *CommentHandler) HandleListReactions(w http.ResponseWriter, r *http.Request) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return
+	}
+	entryID, err := readEntryIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	reactions, err := ch.commentStore.ListReactions(int64(workout.ID), entryID, middleware.GetUser(r).ID)
+	if err != nil {
+		ch.logger.Println("ERROR: listReactions:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reactions": reactions})
+}
+
+// HandleAddReaction reacts to the workout, or one of its entries, with an
+// emoji: {"emoji", "entry_id"}. Reacting twice the same way is a no-op.
+func (ch *CommentHandler) HandleAddReaction(w http.ResponseWriter, r *http.Request) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Emoji   string `json:"emoji"`
+		EntryID *int64 `json:"entry_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Println("ERROR: decodeReaction:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if msg := validateEmoji(req.Emoji); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	reaction := &store.Reaction{
+		WorkoutID: int64(workout.ID),
+		EntryID:   req.EntryID,
+		UserID:    middleware.GetUser(r).ID,
+		Emoji:     req.Emoji,
+	}
+	created, err := ch.commentStore.AddReaction(reaction)
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "entry_id is not an entry of this workout"})
+		return
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: addReaction:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"reaction": reaction})
+}
+
+// HandleRemoveReaction takes back a reaction:
+// DELETE /workouts/{id}/reactions?emoji=&entry_id=
+func (ch *CommentHandler) HandleRemoveReaction(w http.ResponseWriter, r *http.Request) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return
+	}
+	entryID, err := readEntryIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	reaction := &store.Reaction{
+		WorkoutID: int64(workout.ID),
+		EntryID:   entryID,
+		UserID:    middleware.GetUser(r).ID,
+		Emoji:     r.URL.Query().Get("emoji"),
+	}
+	err = ch.commentStore.RemoveReaction(reaction)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "reaction not found"})
+		return
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: removeReaction:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadComment loads the workout the user may see and the live comment
+// {commentID} on it. When it returns false the error response has already
+// been written.
+func (ch *CommentHandler) loadComment(w http.ResponseWriter, r *http.Request) (*store.Workout, *store.Comment, bool) {
+	workout, ok := loadVisibleWorkout(w, r, ch.workoutStore, ch.followStore, ch.logger)
+	if !ok {
+		return nil, nil, false
+	}
+
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+	if err != nil || commentID < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid comment ID parameter"})
+		return nil, nil, false
+	}
+
+	comment, err := ch.commentStore.GetComment(int64(workout.ID), commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		ch.logger.Println("ERROR: getComment:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, nil, false
+	}
+
+	return workout, comment, true
+}
+
+// loadVisibleWorkout reads the {id} URL parameter and loads that workout if
+// the current user may see it. When it returns false the error response has
+// already been written. Workouts the user may not see are reported as not
+// found.
+func loadVisibleWorkout(w http.ResponseWriter, r *http.Request, workoutStore store.WorkoutStore, followStore store.FollowStore, logger *log.Logger) (*store.Workout, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		return nil, false
+	}
+
+	workout, err := workoutStore.GetWorkoutByID(workoutID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return nil, false
+	}
+	if err != nil {
+		logger.Println("ERROR: getWorkoutByID:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	visible, err := canViewWorkout(followStore, workout, middleware.GetUser(r))
+	if err != nil {
+		logger.Println("ERROR: canViewWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if !visible {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return nil, false
+	}
+
+	return workout, true
+}
+
+// readEntryIDParam parses the optional entry_id query parameter.
+func readEntryIDParam(r *http.Request) (*int64, error) {
+	value := r.URL.Query().Get("entry_id")
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		return nil, errors.New("invalid entry_id parameter")
+	}
+	return &id, nil
+}
+
+// validateCommentBody returns "" when body can be stored as a comment.
+func validateCommentBody(body string) string {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "body is required"
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "body must be at most 2000 characters"
+	}
+	return ""
+}
+
+// validateEmoji returns "" when emoji looks like a single emoji: a short
+// run of symbols and their joiners and modifiers, without letters, digits
+// or spaces.
+func validateEmoji(emoji string) string {
+	if emoji == "" {
+		return "emoji is required"
+	}
+	if len(emoji) > maxEmojiBytes || !utf8.ValidString(emoji) {
+		return "emoji is not a single emoji"
+	}
+	symbol := false
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbol = true
+		case r < utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsSpace(r):
+			return "emoji is not a single emoji"
+		}
+	}
+	if !symbol {
+		return "emoji is not a single emoji"
+	}
+	return ""
+}
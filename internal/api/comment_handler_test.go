@@ -0,0 +1,24 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEmoji(t *testing.T) {
+	for _, emoji := range []string{"🔥", "💪", "❤️", "👍🏽", "🏋️‍♀️", "🇳🇱"} {
+		assert.Equal(t, "", validateEmoji(emoji), emoji)
+	}
+	for _, emoji := range []string{"", "fire", ":)", "🔥 ", "a🔥", strings.Repeat("🔥", 9)} {
+		assert.NotEqual(t, "", validateEmoji(emoji), emoji)
+	}
+}
+
+func TestValidateCommentBody(t *testing.T) {
+	assert.Equal(t, "", validateCommentBody("Nice pace!"))
+	assert.Equal(t, "body is required", validateCommentBody("  \n"))
+	assert.Equal(t, "", validateCommentBody(strings.Repeat("é", maxCommentLength)))
+	assert.NotEqual(t, "", validateCommentBody(strings.Repeat("é", maxCommentLength+1)))
+}
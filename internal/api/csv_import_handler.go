@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Anezz12/femProject/internal/importer"
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const maxCSVUploadBytes = 10 << 20
+
+func (wh *WorkoutHandler) HandleListImportPresets(w http.ResponseWriter, r *http.Request) {
+	presets := utils.Envelope{}
+	for _, name := range importer.PresetNames() {
+		mapping, _ := importer.Preset(name)
+		presets[name] = mapping
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"presets": presets})
+}
+
+// HandleImportCSV imports workout history from a CSV export. The multipart
+// form takes the "file", an optional "preset" name, an optional "mapping"
+// JSON object that overrides preset columns, "dry_run" to only report what
+// would be imported and "skip_invalid" to import despite row errors.
+func (wh *WorkoutHandler) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVUploadBytes)
+	err := r.ParseMultipartForm(maxCSVUploadBytes)
+	if err != nil {
+		wh.logger.Println("ERROR: parseCSVImportForm:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid upload, expected multipart form with a file field"})
+		return
+	}
+
+	var mapping importer.Mapping
+	if preset := r.FormValue("preset"); preset != "" {
+		mapping, err = importer.Preset(preset)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+	if raw := r.FormValue("mapping"); raw != "" {
+		var override importer.Mapping
+		err = json.Unmarshal([]byte(raw), &override)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mapping must be a JSON object"})
+			return
+		}
+		mapping = mapping.Merge(override)
+	}
+
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	skipInvalid, _ := strconv.ParseBool(r.FormValue("skip_invalid"))
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	user := middleware.GetUser(r)
+	knownNames, err := wh.workoutStore.ListExerciseNames(user.ID)
+	if err != nil {
+		wh.logger.Println("ERROR: listExerciseNames:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	result, err := importer.Parse(file, mapping, importer.NewMatcher(knownNames))
+	if err != nil {
+		wh.logger.Println("ERROR: parseCSVImport:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if dryRun {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"dry_run": true, "import": result})
+		return
+	}
+
+	if len(result.Errors) > 0 && !skipInvalid {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "some rows could not be parsed", "import": result})
+		return
+	}
+
+	for _, workout := range result.Workouts {
+		workout.UserID = user.ID
+	}
+
+	err = wh.workoutStore.CreateWorkouts(result.Workouts)
+	if err != nil {
+		wh.logger.Println("ERROR: createImportedWorkouts:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"dry_run": false, "import": result})
+}
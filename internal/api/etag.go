@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+// workoutETag is the strong validator of a workout: its version. Writes
+// are guarded by it, so comments and reactions from other users, which
+// don't bump the version, never fail an owner's If-Match.
+func workoutETag(workout *store.Workout) string {
+	return fmt.Sprintf(`"%d"`, workout.Version)
+}
+
+// workoutCacheETag is the weak validator GET answers with. Besides the
+// version it covers the feedback counts, which change without a new
+// version, so a cached copy goes stale when someone comments or reacts.
+// It starts with the version, which checkIfMatch compares on its own.
+func workoutCacheETag(workout *store.Workout) string {
+	if workout.CommentCount == 0 && len(workout.Reactions) == 0 {
+		return fmt.Sprintf(`W/"%d"`, workout.Version)
+	}
+
+	emojis := make([]string, 0, len(workout.Reactions))
+	for emoji := range workout.Reactions {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+	h := fnv.New32a()
+	for _, emoji := range emojis {
+		fmt.Fprintf(h, "%s=%d;", emoji, workout.Reactions[emoji])
+	}
+	return fmt.Sprintf(`W/"%d-%d-%08x"`, workout.Version, workout.CommentCount, h.Sum32())
+}
+
+// versionETag reduces a tag of workoutCacheETag to the workoutETag it
+// starts with. Other tags are returned as they are.
+func versionETag(etag string) string {
+	opaque, ok := strings.CutPrefix(etag, `W/"`)
+	if !ok || !strings.HasSuffix(opaque, `"`) {
+		return etag
+	}
+	version, _, _ := strings.Cut(strings.TrimSuffix(opaque, `"`), "-")
+	return `"` + version + `"`
+}
+
+// etagMatches reports whether an If-Match / If-None-Match header value
+// lists etag or "*". If-None-Match uses the weak comparison, where W/"3"
+// matches "3"; If-Match must use the strong one (RFC 9110 13.1.1), where a
+// weak tag never matches.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces a client supplied If-Match header against the
+// workout the handler just loaded. Only the version is compared: a tag
+// from GET counts by the version it starts with. When it returns false a
+// 412 has been written. Writes should then be guarded with workout.Version
+// so a change slipping in between the read and the write is still caught.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, workout *store.Workout) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	etag := workoutETag(workout)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if etagMatches(versionETag(strings.TrimSpace(candidate)), etag, false) {
+			return true
+		}
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": "workout has been modified, fetch it again before updating"})
+	return false
+}
+
+// writeVersionConflict answers a store.ErrVersionConflict. It is a failed
+// precondition if the client sent If-Match, otherwise a plain conflict from
+// a concurrent write.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, store.ErrVersionConflict) {
+		return false
+	}
+
+	if r.Header.Get("If-Match") != "" {
+		utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": "workout has been modified, fetch it again before updating"})
+		return true
+	}
+	utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "workout was modified concurrently, please retry"})
+	return true
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	for _, weak := range []bool{true, false} {
+		assert.True(t, etagMatches(`"3"`, `"3"`, weak))
+		assert.True(t, etagMatches(`"1", "3"`, `"3"`, weak))
+		assert.True(t, etagMatches(`*`, `"3"`, weak))
+		assert.False(t, etagMatches(`"2"`, `"3"`, weak))
+		assert.False(t, etagMatches(`3`, `"3"`, weak))
+	}
+
+	assert.True(t, etagMatches(`W/"3"`, `"3"`, true))
+	assert.False(t, etagMatches(`W/"3"`, `"3"`, false))
+}
+
+func TestWorkoutCacheETagCoversFeedback(t *testing.T) {
+	workout := &store.Workout{Version: 3}
+	assert.Equal(t, `W/"3"`, workoutCacheETag(workout))
+
+	workout.CommentCount = 1
+	commented := workoutCacheETag(workout)
+	assert.NotEqual(t, `W/"3"`, commented)
+
+	workout.Reactions = map[string]int{"🔥": 1}
+	fire := workoutCacheETag(workout)
+	assert.NotEqual(t, commented, fire)
+
+	workout.Reactions = map[string]int{"👍": 1}
+	assert.NotEqual(t, fire, workoutCacheETag(workout))
+	assert.Equal(t, `"3"`, workoutETag(workout))
+}
+
+func TestCheckIfMatchIgnoresFeedback(t *testing.T) {
+	workout := &store.Workout{Version: 3}
+	fetched := workoutCacheETag(workout)
+
+	// a follower comments between the owner's GET and PUT
+	workout.CommentCount = 1
+	workout.Reactions = map[string]int{"🔥": 1}
+
+	for _, ifMatch := range []string{fetched, workoutCacheETag(workout), `"3"`, `"2", "3"`} {
+		r := httptest.NewRequest(http.MethodPut, "/workouts/1", nil)
+		r.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		assert.True(t, checkIfMatch(w, r, workout), ifMatch)
+	}
+
+	workout.Version = 4
+	r := httptest.NewRequest(http.MethodPut, "/workouts/1", nil)
+	r.Header.Set("If-Match", fetched)
+	w := httptest.NewRecorder()
+	assert.False(t, checkIfMatch(w, r, workout))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+}
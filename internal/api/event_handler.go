@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const (
+	// eventPollInterval is how often an open stream checks the activity
+	// log for new events.
+	eventPollInterval = 2 * time.Second
+	// eventKeepAlive keeps idle streams from being cut by proxies.
+	eventKeepAlive = 15 * time.Second
+	eventBatchSize = 100
+	// eventRetry is the reconnect delay suggested to clients, in
+	// milliseconds.
+	eventRetry = 3000
+)
+
+type EventHandler struct {
+	activityStore store.ActivityStore
+	logger        *log.Logger
+	pollInterval  time.Duration
+	shutdown      chan struct{}
+	shutdownOnce  sync.Once
+}
+
+func NewEventHandler(activityStore store.ActivityStore, logger *log.Logger) *EventHandler {
+	return &EventHandler{
+		activityStore: activityStore,
+		logger:        logger,
+		pollInterval:  eventPollInterval,
+		shutdown:      make(chan struct{}),
+	}
+}
+
+// Shutdown ends the open streams, which would otherwise hold up a graceful
+// shutdown until it times out; clients reconnect and resume where they
+// left off. It is meant for http.Server.RegisterOnShutdown.
+func (eh *EventHandler) Shutdown() {
+	eh.shutdownOnce.Do(func() {
+		close(eh.shutdown)
+	})
+}
+
+// HandleEvents is a Server-Sent Events stream of the workouts created,
+// updated or deleted by the current user and, where shared with them, by
+// the users they follow. A client reconnecting with the Last-Event-ID
+// header (or the last_event_id query parameter, for clients that can't set
+// headers) first gets every event it missed; without one the stream starts
+// with the next event.
+func (eh *EventHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	position, err := eh.startPosition(r)
+	if errors.Is(err, store.ErrInvalidEventPosition) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid Last-Event-ID"})
+		return
+	}
+	if err != nil {
+		eh.logger.Println("ERROR: currentEventPosition:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// the stream stays open far longer than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+	err = rc.Flush()
+	if err != nil {
+		eh.logger.Println("ERROR: flushEvents:", err)
+		return
+	}
+
+	poll := time.NewTicker(eh.pollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	userID := middleware.GetUser(r).ID
+	for {
+		// once the headers are out a failure can only end the stream;
+		// the client reconnects from the last event it got
+		for {
+			events, err := eh.activityStore.ListActivityEvents(userID, position, eventBatchSize)
+			if err != nil {
+				eh.logger.Println("ERROR: listActivityEvents:", err)
+				return
+			}
+			for _, event := range events {
+				err = writeActivityEvent(w, event)
+				if err != nil {
+					return
+				}
+				position = event.Position
+			}
+			if len(events) > 0 && rc.Flush() != nil {
+				return
+			}
+			if len(events) < eventBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-eh.shutdown:
+			return
+		case <-poll.C:
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// startPosition is where the stream resumes from: after the event named
+// by Last-Event-ID, or the current end of the log.
+func (eh *EventHandler) startPosition(r *http.Request) (store.EventPosition, error) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return eh.activityStore.CurrentEventPosition()
+	}
+	return store.ParseEventPosition(lastEventID)
+}
+
+func writeActivityEvent(w io.Writer, event *store.ActivityEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Position, event.Type, data)
+	return err
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryActivityStore struct {
+	mu     sync.Mutex
+	events []*store.ActivityEvent
+}
+
+func (m *memoryActivityStore) CurrentEventPosition() (store.EventPosition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) == 0 {
+		return store.EventPosition{}, nil
+	}
+	return m.events[len(m.events)-1].Position, nil
+}
+
+func (m *memoryActivityStore) ListActivityEvents(viewerID int, after store.EventPosition, limit int) ([]*store.ActivityEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []*store.ActivityEvent
+	for _, event := range m.events {
+		newer := event.Position.TxID > after.TxID || (event.Position.TxID == after.TxID && event.Position.ID > after.ID)
+		if event.UserID == viewerID && newer && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryActivityStore) add(txID, id int64, eventType string, userID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, &store.ActivityEvent{
+		Position:   store.EventPosition{TxID: txID, ID: id},
+		Type:       eventType,
+		UserID:     userID,
+		WorkoutID:  int(id),
+		OccurredAt: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	})
+}
+
+// readEvents reads n events off an SSE stream and returns their id and
+// event lines.
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []string {
+	var got []string
+	for len(got) < n && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "id: ") || strings.HasPrefix(line, "event: ") {
+			got = append(got, line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return got
+}
+
+func TestHandleEvents(t *testing.T) {
+	activity := &memoryActivityStore{}
+	activity.add(100, 1, store.EventWorkoutCreated, 3)
+	activity.add(100, 2, store.EventWorkoutCreated, 4)
+	activity.add(102, 3, store.EventWorkoutUpdated, 3)
+
+	eh := NewEventHandler(activity, log.New(&strings.Builder{}, "", 0))
+	eh.pollInterval = 10 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eh.HandleEvents(w, middleware.SetUser(r, &store.User{ID: 3}))
+	}))
+	defer server.Close()
+
+	stream := func(t *testing.T, lastEventID string) *bufio.Scanner {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewScanner(resp.Body)
+	}
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		scanner := stream(t, "100-1")
+		assert.Equal(t, []string{"id: 102-3", "event: workout.updated"}, readEvents(t, scanner, 2))
+	})
+
+	t.Run("starts at the end and pushes new events", func(t *testing.T) {
+		scanner := stream(t, "")
+		activity.add(103, 5, store.EventWorkoutCreated, 4)
+		activity.add(103, 6, store.EventWorkoutDeleted, 3)
+		assert.Equal(t, []string{"id: 103-6", "event: workout.deleted"}, readEvents(t, scanner, 2))
+	})
+
+	t.Run("rejects a foreign Last-Event-ID", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"?last_event_id=abc", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("shutdown ends open streams", func(t *testing.T) {
+		scanner := stream(t, "")
+		eh.Shutdown()
+		for scanner.Scan() {
+		}
+		assert.NoError(t, scanner.Err())
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/export"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+// HandleExportWorkouts streams the current user's workouts in the requested
+// format. from/to are inclusive dates (YYYY-MM-DD) or RFC3339 timestamps;
+// tag and tag_mode filter by tags as on GET /workouts.
+// The column layout is advertised in the X-Export-Columns and
+// X-Export-Version headers.
+func (wh *WorkoutHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	formatName := query.Get("format")
+	if formatName == "" {
+		formatName = "csv"
+	}
+
+	exporter, err := export.New(formatName, query.Get("granularity"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// large histories can take longer than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	filename := fmt.Sprintf("workouts-%s.%s", time.Now().UTC().Format("20060102"), exporter.Extension)
+	w.Header().Set("Content-Type", exporter.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Export-Columns", strings.Join(exporter.Columns, ","))
+	w.Header().Set("X-Export-Version", strconv.Itoa(export.Version))
+	w.WriteHeader(http.StatusOK)
+
+	err = exporter.Start(w)
+	if err != nil {
+		wh.logger.Println("ERROR: startExport:", err)
+		return
+	}
+
+	// once the headers are out we can only log failures and cut the stream
+	err = wh.workoutStore.IterateWorkouts(filter, func(workout *store.Workout) error {
+		err := exporter.WriteWorkout(workout)
+		if err != nil {
+			return err
+		}
+		err = exporter.Flush()
+		if err != nil {
+			return err
+		}
+		rc.Flush()
+		return nil
+	})
+	if err != nil {
+		wh.logger.Println("ERROR: exportWorkouts:", err)
+		return
+	}
+
+	err = exporter.Close()
+	if err != nil {
+		wh.logger.Println("ERROR: closeExport:", err)
+	}
+}
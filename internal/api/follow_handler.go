@@ -0,0 +1,230 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+// FollowHandler serves following, follower approval and the feed.
+type FollowHandler struct {
+	followStore store.FollowStore
+	logger      *log.Logger
+}
+
+func NewFollowHandler(followStore store.FollowStore, logger *log.Logger) *FollowHandler {
+	return &FollowHandler{
+		followStore: followStore,
+		logger:      logger,
+	}
+}
+
+// HandleFollow follows the user in the URL. For private accounts the
+// follow stays pending until they accept it.
+func (fh *FollowHandler) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == middleware.GetUser(r).Username {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "you cannot follow yourself"})
+		return
+	}
+
+	follow, err := fh.followStore.Follow(middleware.GetUser(r).ID, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		fh.logger.Println("ERROR: follow:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"follow": follow})
+}
+
+// HandleUnfollow stops following the user in the URL, or withdraws the
+// request to.
+func (fh *FollowHandler) HandleUnfollow(w http.ResponseWriter, r *http.Request) {
+	err := fh.followStore.Unfollow(middleware.GetUser(r).ID, chi.URLParam(r, "username"))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you don't follow this user"})
+		return
+	}
+	if err != nil {
+		fh.logger.Println("ERROR: unfollow:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListFollowers lists the current user's followers, newest first:
+// GET /users/me/followers?status=&limit=&offset=
+func (fh *FollowHandler) HandleListFollowers(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != store.FollowPending && status != store.FollowAccepted {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be pending or accepted"})
+		return
+	}
+	limit, offset, ok := readPage(w, r)
+	if !ok {
+		return
+	}
+
+	followers, err := fh.followStore.ListFollowers(middleware.GetUser(r).ID, status, limit, offset)
+	if err != nil {
+		fh.logger.Println("ERROR: listFollowers:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"followers": followers})
+}
+
+// HandleListFollowing lists the users the current user follows or asked to
+// follow: GET /users/me/following?limit=&offset=
+func (fh *FollowHandler) HandleListFollowing(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := readPage(w, r)
+	if !ok {
+		return
+	}
+
+	following, err := fh.followStore.ListFollowing(middleware.GetUser(r).ID, limit, offset)
+	if err != nil {
+		fh.logger.Println("ERROR: listFollowing:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"following": following})
+}
+
+// HandleAcceptFollower approves the follow request of the user {id}.
+func (fh *FollowHandler) HandleAcceptFollower(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID parameter"})
+		return
+	}
+
+	follow, err := fh.followStore.AcceptFollower(middleware.GetUser(r).ID, int(followerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follow request not found"})
+		return
+	}
+	if err != nil {
+		fh.logger.Println("ERROR: acceptFollower:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"follower": follow})
+}
+
+// HandleRemoveFollower rejects the follow request of the user {id}, or
+// removes them as a follower.
+func (fh *FollowHandler) HandleRemoveFollower(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID parameter"})
+		return
+	}
+
+	err = fh.followStore.RemoveFollower(middleware.GetUser(r).ID, int(followerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follower not found"})
+		return
+	}
+	if err != nil {
+		fh.logger.Println("ERROR: removeFollower:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSetPrivacy makes the current account private or public:
+// PUT /users/me/privacy {"is_private": true}. Going public accepts the
+// pending follow requests.
+func (fh *FollowHandler) HandleSetPrivacy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IsPrivate *bool `json:"is_private"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		fh.logger.Println("ERROR: decodePrivacy:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if req.IsPrivate == nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "is_private is required"})
+		return
+	}
+
+	accepted, err := fh.followStore.SetPrivate(middleware.GetUser(r).ID, *req.IsPrivate)
+	if err != nil {
+		fh.logger.Println("ERROR: setPrivate:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"is_private": *req.IsPrivate, "accepted_requests": accepted})
+}
+
+// HandleFeed lists the workouts followed users shared, newest first:
+// GET /feed?limit=&offset=
+func (fh *FollowHandler) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := readPage(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := fh.followStore.ListFeed(middleware.GetUser(r).ID, limit, offset)
+	if err != nil {
+		fh.logger.Println("ERROR: listFeed:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"feed": items})
+}
+
+// readPage reads the limit and offset query parameters. When it returns
+// false the error response has already been written.
+func readPage(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, err := utils.ReadIntParam(r, "limit", defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return 0, 0, false
+	}
+	offset, err := utils.ReadIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset must be a non-negative integer"})
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+// canViewWorkout reports whether the user may see the workout: owners see
+// their own, everyone sees public workouts and accepted followers see those
+// shared with followers.
+func canViewWorkout(followStore store.FollowStore, workout *store.Workout, user *store.User) (bool, error) {
+	switch {
+	case workout.UserID == user.ID:
+		return true, nil
+	case workout.Visibility == store.VisibilityPublic:
+		return true, nil
+	case workout.Visibility == store.VisibilityFollowers:
+		return followStore.IsFollowing(user.ID, workout.UserID)
+	}
+	return false, nil
+}
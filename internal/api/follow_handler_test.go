@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryFollowStore struct {
+	store.FollowStore
+
+	// accepted holds follower -> followee pairs
+	accepted map[[2]int]bool
+}
+
+func (m *memoryFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	return m.accepted[[2]int{followerID, followeeID}], nil
+}
+
+func TestCanViewWorkout(t *testing.T) {
+	follows := &memoryFollowStore{accepted: map[[2]int]bool{{2, 1}: true}}
+	owner := &store.User{ID: 1}
+	follower := &store.User{ID: 2}
+	stranger := &store.User{ID: 3}
+
+	tests := []struct {
+		visibility string
+		user       *store.User
+		want       bool
+	}{
+		{store.VisibilityPrivate, owner, true},
+		{store.VisibilityPrivate, follower, false},
+		{store.VisibilityFollowers, follower, true},
+		{store.VisibilityFollowers, stranger, false},
+		{store.VisibilityPublic, stranger, true},
+	}
+
+	for _, tt := range tests {
+		workout := &store.Workout{UserID: 1, Visibility: tt.visibility}
+		visible, err := canViewWorkout(follows, workout, tt.user)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, visible, "%s workout seen by user %d", tt.visibility, tt.user.ID)
+	}
+}
+
+func TestValidateWorkoutVisibility(t *testing.T) {
+	assert.Equal(t, "", validateWorkout(&store.Workout{Title: "Legs"}))
+	assert.Equal(t, "", validateWorkout(&store.Workout{Title: "Legs", Visibility: store.VisibilityFollowers}))
+	assert.Equal(t, visibilityError, validateWorkout(&store.Workout{Title: "Legs", Visibility: "friends"}))
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+var jobStatuses = []string{store.JobPending, store.JobRunning, store.JobSucceeded, store.JobDead}
+
+// JobHandler serves the admin endpoints of the job queue.
+type JobHandler struct {
+	jobStore store.JobStore
+	logger   *log.Logger
+}
+
+func NewJobHandler(jobStore store.JobStore, logger *log.Logger) *JobHandler {
+	return &JobHandler{
+		jobStore: jobStore,
+		logger:   logger,
+	}
+}
+
+// HandleListJobs lists jobs, newest first:
+// GET /admin/jobs?status=&type=&limit=&offset=
+func (jh *JobHandler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	filter := store.JobFilter{
+		Status: r.URL.Query().Get("status"),
+		Type:   r.URL.Query().Get("type"),
+	}
+	if filter.Status != "" && !slices.Contains(jobStatuses, filter.Status) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be one of pending, running, succeeded, dead"})
+		return
+	}
+	limit, err := utils.ReadIntParam(r, "limit", defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := utils.ReadIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	jobs, err := jh.jobStore.ListJobs(filter, limit, offset)
+	if err != nil {
+		jh.logger.Println("ERROR: listJobs:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"jobs": jobs})
+}
+
+func (jh *JobHandler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid job ID parameter"})
+		return
+	}
+
+	job, err := jh.jobStore.GetJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		jh.logger.Println("ERROR: getJob:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"job": job})
+}
+
+// HandleRetryJob runs a dead or waiting job right away with a fresh set of
+// attempts.
+func (jh *JobHandler) HandleRetryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid job ID parameter"})
+		return
+	}
+
+	job, err := jh.jobStore.RetryJob(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "job not found"})
+		return
+	}
+	if errors.Is(err, store.ErrJobNotRetryable) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		jh.logger.Println("ERROR: retryJob:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"job": job})
+}
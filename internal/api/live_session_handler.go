@@ -0,0 +1,419 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/live"
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/coder/websocket"
+)
+
+const (
+	// maxLiveEventBytes caps a single event read from a socket.
+	maxLiveEventBytes = 64 << 10
+	// livePingInterval keeps idle sockets open through proxies and
+	// detects devices that went away without closing.
+	livePingInterval = 30 * time.Second
+	// liveWriteTimeout bounds a single write or ping.
+	liveWriteTimeout = 10 * time.Second
+	// liveSaveAttempts is how often an event is re-applied when another
+	// instance wrote the session in between.
+	liveSaveAttempts = 3
+)
+
+type LiveSessionHandler struct {
+	liveStore    store.LiveSessionStore
+	workoutStore store.WorkoutStore
+	hub          *live.Hub
+	logger       *log.Logger
+}
+
+func NewLiveSessionHandler(liveStore store.LiveSessionStore, workoutStore store.WorkoutStore, hub *live.Hub, logger *log.Logger) *LiveSessionHandler {
+	return &LiveSessionHandler{
+		liveStore:    liveStore,
+		workoutStore: workoutStore,
+		hub:          hub,
+		logger:       logger,
+	}
+}
+
+// HandleStartLiveSession starts a session, blank or from the plan of one of
+// the user's workouts: {"template_workout_id", "title"}, both optional.
+func (lh *LiveSessionHandler) HandleStartLiveSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TemplateWorkoutID *int64 `json:"template_workout_id"`
+		Title             string `json:"title"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		lh.logger.Println("ERROR: decodeStartLiveSession:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+	var template *store.Workout
+	if req.TemplateWorkoutID != nil {
+		template, err = lh.workoutStore.GetWorkoutByID(*req.TemplateWorkoutID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && (template.UserID != userID || template.DeletedAt != nil)) {
+			utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "template_workout_id must be one of your workouts"})
+			return
+		}
+		if err != nil {
+			lh.logger.Println("ERROR: getWorkoutByID:", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	session := &store.LiveSession{
+		UserID:            userID,
+		TemplateWorkoutID: req.TemplateWorkoutID,
+		State:             live.NewState(template, req.Title),
+	}
+	err = lh.liveStore.CreateLiveSession(session)
+	if err != nil {
+		lh.logger.Println("ERROR: createLiveSession:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"live_session": session})
+}
+
+// HandleListLiveSessions lists the user's active sessions so a device can
+// pick up a workout started on another one.
+func (lh *LiveSessionHandler) HandleListLiveSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := lh.liveStore.ListLiveSessions(middleware.GetUser(r).ID)
+	if err != nil {
+		lh.logger.Println("ERROR: listLiveSessions:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"live_sessions": sessions})
+}
+
+func (lh *LiveSessionHandler) HandleGetLiveSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := lh.loadOwnedSession(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"live_session": session})
+}
+
+// HandleLiveSessionEvent applies a single event sent over plain HTTP, for
+// devices that can't hold a socket open. It is broadcast like events sent
+// over the socket.
+func (lh *LiveSessionHandler) HandleLiveSessionEvent(w http.ResponseWriter, r *http.Request) {
+	session, ok := lh.loadOwnedSession(w, r)
+	if !ok {
+		return
+	}
+
+	var event live.Event
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		lh.logger.Println("ERROR: decodeLiveEvent:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	session, err = lh.applyEvent(session.ID, &event)
+	if !lh.handleLiveWriteError(w, err) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"seq": session.Seq, "event": event})
+}
+
+// HandleLiveSessionSocket upgrades to a WebSocket that first receives a
+// snapshot of the session, then every event applied to it by any device.
+// Events the device sends are applied and broadcast; rejected ones are
+// answered with an error message to that device only.
+func (lh *LiveSessionHandler) HandleLiveSessionSocket(w http.ResponseWriter, r *http.Request) {
+	session, ok := lh.loadOwnedSession(w, r)
+	if !ok {
+		return
+	}
+	if session.Status != store.LiveSessionActive {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrLiveSessionEnded.Error()})
+		return
+	}
+
+	// the server's read and write timeouts are meant for plain requests,
+	// sockets stay open for the whole workout
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		lh.logger.Println("ERROR: acceptLiveSocket:", err)
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxLiveEventBytes)
+
+	client, err := lh.join(session.ID)
+	if err != nil {
+		lh.logger.Println("ERROR: joinLiveSession:", err)
+		conn.Close(websocket.StatusInternalError, "internal server error")
+		return
+	}
+	defer lh.hub.Leave(session.ID, client)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		lh.writeMessages(ctx, conn, client)
+	}()
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var event live.Event
+		err = json.Unmarshal(data, &event)
+		if err != nil {
+			lh.hub.Send(session.ID, client, live.Message{Type: live.MessageError, Error: "Invalid event payload"})
+			continue
+		}
+
+		_, err = lh.applyEvent(session.ID, &event)
+		switch {
+		case err == nil:
+		case errors.Is(err, live.ErrInvalidEvent), errors.Is(err, store.ErrLiveSessionEnded):
+			lh.hub.Send(session.ID, client, live.Message{Type: live.MessageError, Event: &event, Error: err.Error()})
+		default:
+			lh.logger.Println("ERROR: applyLiveEvent:", err)
+			lh.hub.Send(session.ID, client, live.Message{Type: live.MessageError, Event: &event, Error: "internal server error"})
+		}
+	}
+}
+
+// writeMessages sends the client's messages and pings until the client is
+// disconnected by the hub, the hub shuts down or ctx ends.
+func (lh *LiveSessionHandler) writeMessages(ctx context.Context, conn *websocket.Conn, client *live.Client) {
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+
+	ended := false
+	for {
+		select {
+		case msg, ok := <-client.Messages:
+			if !ok {
+				if ended {
+					conn.Close(websocket.StatusNormalClosure, "session ended")
+				} else {
+					conn.Close(websocket.StatusTryAgainLater, "too far behind, reconnect")
+				}
+				return
+			}
+			ended = msg.Type == live.MessageEnded
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				lh.logger.Println("ERROR: encodeLiveMessage:", err)
+				return
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, liveWriteTimeout)
+			err = conn.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				return
+			}
+
+		case <-lh.hub.Done():
+			conn.Close(websocket.StatusGoingAway, "server shutting down, reconnect")
+			return
+
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, liveWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// join connects a device and queues the current snapshot for it. Holding
+// the session lock makes sure no event falls between the two.
+func (lh *LiveSessionHandler) join(id int64) (*live.Client, error) {
+	unlock := lh.hub.Lock(id)
+	defer unlock()
+
+	session, err := lh.liveStore.GetLiveSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	client := lh.hub.Join(id)
+	if session.Status != store.LiveSessionActive {
+		lh.hub.Send(id, client, live.Message{Type: live.MessageEnded, Seq: session.Seq, Session: session})
+		lh.hub.Leave(id, client)
+		return client, nil
+	}
+	lh.hub.Send(id, client, live.Message{Type: live.MessageSnapshot, Seq: session.Seq, Session: session})
+	return client, nil
+}
+
+// applyEvent applies event to the stored session, saves it and broadcasts
+// it to the session's devices.
+func (lh *LiveSessionHandler) applyEvent(id int64, event *live.Event) (*store.LiveSession, error) {
+	unlock := lh.hub.Lock(id)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		session, err := lh.liveStore.GetLiveSession(id)
+		if err != nil {
+			return nil, err
+		}
+		if session.Status != store.LiveSessionActive {
+			return nil, store.ErrLiveSessionEnded
+		}
+
+		err = live.Apply(&session.State, event, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		err = lh.liveStore.SaveLiveSessionState(session)
+		if errors.Is(err, store.ErrVersionConflict) && attempt < liveSaveAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lh.hub.Broadcast(id, live.Message{Type: live.MessageEvent, Seq: session.Seq, Event: event})
+		return session, nil
+	}
+}
+
+// HandleFinishLiveSession stores the completed sets of the session as a
+// workout and disconnects its devices.
+func (lh *LiveSessionHandler) HandleFinishLiveSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := lh.loadOwnedSession(w, r)
+	if !ok {
+		return
+	}
+
+	unlock := lh.hub.Lock(session.ID)
+	defer unlock()
+
+	// reload now that no event can be applied in between
+	session, err := lh.liveStore.GetLiveSession(session.ID)
+	if err != nil {
+		lh.logger.Println("ERROR: getLiveSession:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if session.Status != store.LiveSessionActive {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrLiveSessionEnded.Error()})
+		return
+	}
+
+	workout := live.ToWorkout(session, time.Now())
+	if msg := validateWorkout(workout); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	err = lh.liveStore.FinishLiveSession(session, workout)
+	if errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if !lh.handleLiveWriteError(w, err) {
+		return
+	}
+
+	lh.hub.End(session.ID, live.Message{Type: live.MessageEnded, Seq: session.Seq, Session: session})
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": workout, "live_session": session})
+}
+
+// HandleAbandonLiveSession ends the session without storing a workout.
+func (lh *LiveSessionHandler) HandleAbandonLiveSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := lh.loadOwnedSession(w, r)
+	if !ok {
+		return
+	}
+
+	unlock := lh.hub.Lock(session.ID)
+	defer unlock()
+
+	err := lh.liveStore.AbandonLiveSession(session)
+	if !lh.handleLiveWriteError(w, err) {
+		return
+	}
+
+	lh.hub.End(session.ID, live.Message{Type: live.MessageEnded, Seq: session.Seq, Session: session})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLiveWriteError writes the response for a failed session write and
+// reports whether the handler may continue.
+func (lh *LiveSessionHandler) handleLiveWriteError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, live.ErrInvalidEvent) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return false
+	}
+	if errors.Is(err, store.ErrLiveSessionEnded) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return false
+	}
+	if errors.Is(err, store.ErrVersionConflict) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "live session was modified concurrently, please retry"})
+		return false
+	}
+
+	lh.logger.Println("ERROR: writeLiveSession:", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	return false
+}
+
+// loadOwnedSession reads the {id} URL parameter and loads that session of
+// the user. When it returns false the error response has been written.
+func (lh *LiveSessionHandler) loadOwnedSession(w http.ResponseWriter, r *http.Request) (*store.LiveSession, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid live session ID parameter"})
+		return nil, false
+	}
+
+	session, err := lh.liveStore.GetLiveSession(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && session.UserID != middleware.GetUser(r).ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "live session not found"})
+		return nil, false
+	}
+	if err != nil {
+		lh.logger.Println("ERROR: getLiveSession:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	return session, true
+}
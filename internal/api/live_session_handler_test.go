@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/live"
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryLiveSessionStore struct {
+	mu       sync.Mutex
+	sessions map[int64]store.LiveSession
+}
+
+func (m *memoryLiveSessionStore) CreateLiveSession(session *store.LiveSession) error {
+	return nil
+}
+
+func (m *memoryLiveSessionStore) GetLiveSession(id int64) (*store.LiveSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &session, nil
+}
+
+func (m *memoryLiveSessionStore) ListLiveSessions(userID int) ([]*store.LiveSession, error) {
+	return nil, nil
+}
+
+func (m *memoryLiveSessionStore) SaveLiveSessionState(session *store.LiveSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[session.ID].Seq != session.Seq {
+		return store.ErrVersionConflict
+	}
+	session.Seq++
+	m.sessions[session.ID] = *session
+	return nil
+}
+
+func (m *memoryLiveSessionStore) FinishLiveSession(session *store.LiveSession, workout *store.Workout) error {
+	return nil
+}
+
+func (m *memoryLiveSessionStore) AbandonLiveSession(session *store.LiveSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.Status = store.LiveSessionAbandoned
+	m.sessions[session.ID] = *session
+	return nil
+}
+
+func TestLiveSessionSocketBroadcastsToAllDevices(t *testing.T) {
+	liveStore := &memoryLiveSessionStore{sessions: map[int64]store.LiveSession{
+		5: {ID: 5, UserID: 3, Status: store.LiveSessionActive, State: live.NewState(&store.Workout{
+			Title:   "Legs",
+			Entries: []store.WorkoutEntry{{ExerciseName: "Squat", Sets: 5, Reps: intPtr(5)}},
+		}, "")},
+	}}
+	lh := NewLiveSessionHandler(liveStore, nil, live.NewHub(nil, nil), log.New(&strings.Builder{}, "", 0))
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, middleware.SetUser(r, &store.User{ID: 3}))
+		})
+	})
+	r.Get("/live-sessions/{id}/ws", lh.HandleLiveSessionSocket)
+	r.Delete("/live-sessions/{id}", lh.HandleAbandonLiveSession)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/live-sessions/5/ws"
+
+	var devices []*websocket.Conn
+	for range 2 {
+		conn, _, err := websocket.Dial(ctx, url, nil)
+		require.NoError(t, err)
+		defer conn.CloseNow()
+
+		var msg live.Message
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, live.MessageSnapshot, msg.Type)
+		assert.Equal(t, "Squat", msg.Session.State.Entries[0].ExerciseName)
+		devices = append(devices, conn)
+	}
+
+	require.NoError(t, wsjson.Write(ctx, devices[0], live.Event{ID: "a1", Type: live.EventSetCompleted, EntryID: 1}))
+	for _, conn := range devices {
+		var msg live.Message
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, live.MessageEvent, msg.Type)
+		assert.Equal(t, int64(1), msg.Seq)
+		assert.Equal(t, "a1", msg.Event.ID)
+	}
+
+	require.NoError(t, wsjson.Write(ctx, devices[1], live.Event{ID: "b1", Type: live.EventSetUndone, EntryID: 9}))
+	var rejected live.Message
+	require.NoError(t, wsjson.Read(ctx, devices[1], &rejected))
+	assert.Equal(t, live.MessageError, rejected.Type)
+	assert.Equal(t, "b1", rejected.Event.ID)
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/live-sessions/5", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	for _, conn := range devices {
+		var msg live.Message
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, live.MessageEnded, msg.Type)
+		assert.Equal(t, store.LiveSessionAbandoned, msg.Session.Status)
+
+		_, _, err := conn.Read(ctx)
+		assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+	}
+}
+
+func TestLiveSessionSocketClosesOnShutdown(t *testing.T) {
+	liveStore := &memoryLiveSessionStore{sessions: map[int64]store.LiveSession{
+		5: {ID: 5, UserID: 3, Status: store.LiveSessionActive, State: live.NewState(&store.Workout{Title: "Legs"}, "")},
+	}}
+	hub := live.NewHub(nil, nil)
+	lh := NewLiveSessionHandler(liveStore, nil, hub, log.New(&strings.Builder{}, "", 0))
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, middleware.SetUser(r, &store.User{ID: 3}))
+		})
+	})
+	r.Get("/live-sessions/{id}/ws", lh.HandleLiveSessionSocket)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/live-sessions/5/ws", nil)
+	require.NoError(t, err)
+	defer conn.CloseNow()
+
+	var msg live.Message
+	require.NoError(t, wsjson.Read(ctx, conn, &msg))
+	assert.Equal(t, live.MessageSnapshot, msg.Type)
+
+	hub.Shutdown()
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+}
+
+func intPtr(i int) *int {
+	return &i
+}
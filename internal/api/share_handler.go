@@ -0,0 +1,240 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+// ShareHandler serves share links: owners create and revoke them, and
+// anyone holding one can read the workout.
+type ShareHandler struct {
+	shareStore   store.ShareStore
+	workoutStore store.WorkoutStore
+	followStore  store.FollowStore
+	logger       *log.Logger
+}
+
+func NewShareHandler(shareStore store.ShareStore, workoutStore store.WorkoutStore, followStore store.FollowStore, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		shareStore:   shareStore,
+		workoutStore: workoutStore,
+		followStore:  followStore,
+		logger:       logger,
+	}
+}
+
+// sharedWorkout is what a share link shows: the session itself, without
+// the owner's bookkeeping (ids, tags, visibility), the feedback on it, or
+// the GPS route and heart rate samples of its activity.
+type sharedWorkout struct {
+	Title           string             `json:"title"`
+	Description     string             `json:"description"`
+	DurationMinutes int                `json:"duration_minutes"`
+	CaloriesBurned  int                `json:"calories_burned"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Groups          []sharedEntryGroup `json:"groups"`
+	Entries         []sharedEntry      `json:"entries"`
+	Activity        *sharedActivity    `json:"activity,omitempty"`
+}
+
+type sharedEntryGroup struct {
+	Kind                string `json:"kind"`
+	Name                string `json:"name,omitempty"`
+	Rounds              int    `json:"rounds"`
+	RestSeconds         *int   `json:"rest_seconds,omitempty"`
+	ExerciseRestSeconds *int   `json:"exercise_rest_seconds,omitempty"`
+	IntervalSeconds     *int   `json:"interval_seconds,omitempty"`
+	TimeCapSeconds      *int   `json:"time_cap_seconds,omitempty"`
+}
+
+type sharedEntry struct {
+	ExerciseName    string   `json:"exercise_name"`
+	Sets            int      `json:"sets"`
+	Reps            *int     `json:"reps,omitempty"`
+	DurationSeconds *int     `json:"duration_seconds,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+	Notes           string   `json:"notes,omitempty"`
+	Group           *int     `json:"group,omitempty"`
+}
+
+type sharedActivity struct {
+	Sport               string                `json:"sport"`
+	DistanceMeters      float64               `json:"distance_meters"`
+	DurationSeconds     int                   `json:"duration_seconds"`
+	ElevationGainMeters float64               `json:"elevation_gain_meters"`
+	ElevationLossMeters float64               `json:"elevation_loss_meters"`
+	AvgHeartRate        *int                  `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate        *int                  `json:"max_heart_rate,omitempty"`
+	Splits              []store.ActivitySplit `json:"splits"`
+}
+
+func newSharedWorkout(workout *store.Workout) *sharedWorkout {
+	shared := &sharedWorkout{
+		Title:           workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		CreatedAt:       workout.CreatedAt,
+		Groups:          []sharedEntryGroup{},
+		Entries:         []sharedEntry{},
+	}
+	for _, g := range workout.Groups {
+		shared.Groups = append(shared.Groups, sharedEntryGroup{
+			Kind:                g.Kind,
+			Name:                g.Name,
+			Rounds:              g.Rounds,
+			RestSeconds:         g.RestSeconds,
+			ExerciseRestSeconds: g.ExerciseRestSeconds,
+			IntervalSeconds:     g.IntervalSeconds,
+			TimeCapSeconds:      g.TimeCapSeconds,
+		})
+	}
+	for _, e := range workout.Entries {
+		shared.Entries = append(shared.Entries, sharedEntry{
+			ExerciseName:    e.ExerciseName,
+			Sets:            e.Sets,
+			Reps:            e.Reps,
+			DurationSeconds: e.DurationSeconds,
+			Weight:          e.Weight,
+			Notes:           e.Notes,
+			Group:           e.Group,
+		})
+	}
+	if a := workout.Activity; a != nil {
+		shared.Activity = &sharedActivity{
+			Sport:               a.Sport,
+			DistanceMeters:      a.DistanceMeters,
+			DurationSeconds:     a.DurationSeconds,
+			ElevationGainMeters: a.ElevationGainMeters,
+			ElevationLossMeters: a.ElevationLossMeters,
+			AvgHeartRate:        a.AvgHeartRate,
+			MaxHeartRate:        a.MaxHeartRate,
+			Splits:              a.Splits,
+		}
+	}
+	return shared
+}
+
+// HandleCreateShare creates a share link for the user's workout. The
+// optional body sets when it stops working: {"expires_at"}; without it the
+// link works until revoked. The token is only ever returned here.
+func (sh *ShareHandler) HandleCreateShare(w http.ResponseWriter, r *http.Request) {
+	workout, ok := sh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		sh.logger.Println("ERROR: decodeShare:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "expires_at must be in the future"})
+		return
+	}
+
+	share, err := sh.shareStore.CreateShare(int64(workout.ID), workout.UserID, req.ExpiresAt)
+	if err != nil {
+		sh.logger.Println("ERROR: createShare:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// no-store keeps the token out of caches and idempotency records
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"share": share, "url": "/shared/" + share.Token})
+}
+
+// HandleListShares lists the share links of the user's workout. Tokens
+// are not included.
+func (sh *ShareHandler) HandleListShares(w http.ResponseWriter, r *http.Request) {
+	workout, ok := sh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := sh.shareStore.ListShares(int64(workout.ID))
+	if err != nil {
+		sh.logger.Println("ERROR: listShares:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"shares": shares})
+}
+
+// HandleRevokeShare stops the share link {shareID} from working.
+func (sh *ShareHandler) HandleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	workout, ok := sh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	shareID, err := strconv.ParseInt(chi.URLParam(r, "shareID"), 10, 64)
+	if err != nil || shareID < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid share ID parameter"})
+		return
+	}
+
+	err = sh.shareStore.RevokeShare(int64(workout.ID), shareID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share not found"})
+		return
+	}
+	if err != nil {
+		sh.logger.Println("ERROR: revokeShare:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetSharedWorkout is public; the unguessable token in the URL is
+// the credential. Responses aren't cached so revoking takes effect at once.
+func (sh *ShareHandler) HandleGetSharedWorkout(w http.ResponseWriter, r *http.Request) {
+	workout, err := sh.shareStore.GetSharedWorkout(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invalid, expired or revoked share link"})
+		return
+	}
+	if err != nil {
+		sh.logger.Println("ERROR: getSharedWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": newSharedWorkout(workout)})
+}
+
+// loadOwnedWorkout loads the workout {id} for its owner. Others who can
+// see it get a 403, everyone else a 404. When it returns false the error
+// response has already been written.
+func (sh *ShareHandler) loadOwnedWorkout(w http.ResponseWriter, r *http.Request) (*store.Workout, bool) {
+	workout, ok := loadVisibleWorkout(w, r, sh.workoutStore, sh.followStore, sh.logger)
+	if !ok {
+		return nil, false
+	}
+	if workout.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can manage share links"})
+		return nil, false
+	}
+	return workout, true
+}
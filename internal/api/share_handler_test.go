@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSharedWorkoutStripsPrivateFields(t *testing.T) {
+	workout := &store.Workout{
+		ID:         7,
+		UserID:     3,
+		ClientID:   "4f1c1a52-8d1e-4d2c-9a55-0a3c8c2b1f10",
+		Version:    4,
+		Title:      "Long run",
+		Visibility: store.VisibilityPrivate,
+		Tags:       []store.Tag{{ID: 1, Name: "injury rehab"}},
+		Groups:     []store.EntryGroup{{ID: 9, Kind: store.GroupSuperset, Rounds: 3}},
+		Entries: []store.WorkoutEntry{
+			{ID: 11, WorkoutID: 7, ExerciseName: "Strides", Sets: 4, Group: intPtr(0)},
+		},
+		Activity: &store.WorkoutActivity{
+			Sport:          "running",
+			DistanceMeters: 15000,
+			Route:          [][2]float64{{52.37, 4.89}},
+		},
+		CommentCount: 2,
+		Reactions:    map[string]int{"🔥": 1},
+	}
+
+	data, err := json.Marshal(newSharedWorkout(workout))
+	require.NoError(t, err)
+
+	var shared map[string]any
+	require.NoError(t, json.Unmarshal(data, &shared))
+	for _, field := range []string{"id", "user_id", "client_id", "version", "visibility", "tags", "comment_count", "reactions"} {
+		assert.NotContains(t, shared, field)
+	}
+	assert.Equal(t, "Long run", shared["title"])
+
+	entry := shared["entries"].([]any)[0].(map[string]any)
+	assert.NotContains(t, entry, "id")
+	assert.NotContains(t, entry, "workout_id")
+	assert.Equal(t, "Strides", entry["exercise_name"])
+	assert.NotContains(t, shared["groups"].([]any)[0], "id")
+
+	activity := shared["activity"].(map[string]any)
+	assert.NotContains(t, activity, "route")
+	assert.NotContains(t, activity, "heart_rate_samples")
+	assert.Equal(t, 15000.0, activity["distance_meters"])
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+// StatsHandler serves platform-wide statistics to admins.
+type StatsHandler struct {
+	schedulerStore store.SchedulerStore
+	logger         *log.Logger
+}
+
+func NewStatsHandler(schedulerStore store.SchedulerStore, logger *log.Logger) *StatsHandler {
+	return &StatsHandler{
+		schedulerStore: schedulerStore,
+		logger:         logger,
+	}
+}
+
+// HandleDailyStats returns the workout numbers per UTC day:
+// GET /admin/stats/daily?from=&to=. They are refreshed every few minutes,
+// so the latest day may lag behind.
+func (sh *StatsHandler) HandleDailyStats(w http.ResponseWriter, r *http.Request) {
+	from, err := utils.ReadTimeParam(r, "from", false)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	to, err := utils.ReadTimeParam(r, "to", true)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	stats, err := sh.schedulerStore.ListDailyStats(from, to)
+	if err != nil {
+		sh.logger.Println("ERROR: listDailyStats:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"days": stats})
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 500
+	maxSyncOps       = 500
+)
+
+type syncRequest struct {
+	Cursor     string          `json:"cursor"`
+	Limit      int             `json:"limit"`
+	Operations []syncOperation `json:"operations"`
+}
+
+// syncOperation is a change the client made while offline. Workouts are
+// identified by the UUID the client gave them on create; base_version is
+// the server version the client last saw (0 if never synced).
+type syncOperation struct {
+	Op              string       `json:"op"`
+	ClientID        string       `json:"client_id"`
+	ClientUpdatedAt time.Time    `json:"client_updated_at"`
+	BaseVersion     int          `json:"base_version"`
+	Workout         *syncWorkout `json:"workout"`
+}
+
+type syncWorkout struct {
+	Title           string               `json:"title"`
+	Description     string               `json:"description"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	CaloriesBurned  int                  `json:"calories_burned"`
+	CreatedAt       time.Time            `json:"created_at"`
+	Groups          []store.EntryGroup   `json:"groups"`
+	Entries         []store.WorkoutEntry `json:"entries"`
+}
+
+type syncResult struct {
+	ClientID  string         `json:"client_id"`
+	Op        string         `json:"op"`
+	Status    string         `json:"status"`
+	Reason    string         `json:"reason,omitempty"`
+	WorkoutID int            `json:"workout_id,omitempty"`
+	Version   int            `json:"version,omitempty"`
+	Workout   *store.Workout `json:"workout,omitempty"`
+}
+
+type syncChange struct {
+	ClientID  string         `json:"client_id"`
+	WorkoutID int            `json:"workout_id"`
+	Deleted   bool           `json:"deleted"`
+	Workout   *store.Workout `json:"workout,omitempty"`
+}
+
+const (
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncInvalid  = "invalid"
+)
+
+// HandleSync is the offline sync endpoint. It first applies the client's
+// operations in order, each on its own, then returns the user's changes
+// since the given cursor together with the cursor to send next time.
+//
+// Conflicts are resolved per workout:
+//   - create of a client_id that already exists is a retried create and is
+//     acknowledged without writing anything
+//   - update and delete apply when base_version is the current version;
+//     otherwise the write with the later timestamp wins (client_updated_at
+//     against the server's updated_at, client clocks ahead of ours are
+//     clamped to now)
+//   - updates to deleted or unknown workouts are conflicts; deleting them
+//     again is a no-op
+//
+// A conflict leaves the server copy untouched and returns it so the client
+// can reconcile.
+func (wh *WorkoutHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	var req syncRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeSync:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if len(req.Operations) > maxSyncOps {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "at most " + strconv.Itoa(maxSyncOps) + " operations per sync"})
+		return
+	}
+
+	cursor := int64(0)
+	if req.Cursor != "" {
+		cursor, err = strconv.ParseInt(req.Cursor, 10, 64)
+		if err != nil || cursor < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid sync cursor"})
+			return
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	userID := middleware.GetUser(r).ID
+	results := make([]syncResult, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		result, err := wh.applySyncOperation(userID, op)
+		if err != nil {
+			wh.logger.Println("ERROR: applySyncOperation:", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		results = append(results, result)
+	}
+
+	changes, nextCursor, hasMore, err := wh.changesSince(userID, cursor, limit)
+	if err != nil {
+		wh.logger.Println("ERROR: listChanges:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"results":  results,
+		"changes":  changes,
+		"cursor":   strconv.FormatInt(nextCursor, 10),
+		"has_more": hasMore,
+	})
+}
+
+func (wh *WorkoutHandler) applySyncOperation(userID int, op syncOperation) (syncResult, error) {
+	op.ClientID = strings.ToLower(op.ClientID)
+	result := syncResult{ClientID: op.ClientID, Op: op.Op}
+
+	if msg := validateSyncOperation(op); msg != "" {
+		result.Status, result.Reason = syncInvalid, msg
+		return result, nil
+	}
+
+	current, err := wh.workoutStore.GetWorkoutByClientID(userID, op.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	status, reason := resolveSyncConflict(op, current, time.Now())
+	result.Status, result.Reason = status, reason
+	if status != syncApplied {
+		result.Workout = current
+		return result, nil
+	}
+
+	switch {
+	case op.Op == "create" && current == nil:
+		workout := &store.Workout{UserID: userID, ClientID: op.ClientID}
+		op.Workout.applyTo(workout)
+		workout.CreatedAt = op.Workout.CreatedAt
+		_, err = wh.workoutStore.CreateWorkout(workout)
+		if errors.Is(err, store.ErrDuplicateClientID) {
+			// a concurrent sync created it first; the retry sees it
+			result.Status, result.Reason = syncConflict, "concurrent_write"
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		current = workout
+	case op.Op == "update":
+		op.Workout.applyTo(current)
+		err = wh.workoutStore.UpdateWorkout(current, userID)
+	case op.Op == "delete" && current != nil && current.DeletedAt == nil:
+		err = wh.workoutStore.DeleteWorkout(int64(current.ID), userID, current.Version)
+		current = nil
+	}
+	if errors.Is(err, store.ErrVersionConflict) {
+		// someone wrote between our read and write; let the client retry
+		result.Status, result.Reason = syncConflict, "concurrent_write"
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if current != nil {
+		result.WorkoutID, result.Version = current.ID, current.Version
+	}
+	return result, nil
+}
+
+// resolveSyncConflict decides whether op may be applied on top of current
+// (nil when the server has no workout with that client_id), following the
+// rules documented on HandleSync.
+func resolveSyncConflict(op syncOperation, current *store.Workout, now time.Time) (status, reason string) {
+	clientTime := op.ClientUpdatedAt
+	if clientTime.After(now) {
+		clientTime = now
+	}
+
+	switch op.Op {
+	case "create":
+		return syncApplied, ""
+	case "update":
+		if current == nil {
+			return syncConflict, "not_found"
+		}
+		if current.DeletedAt != nil {
+			return syncConflict, "deleted"
+		}
+		if op.BaseVersion == current.Version || clientTime.After(current.UpdatedAt) {
+			return syncApplied, ""
+		}
+		return syncConflict, "stale"
+	case "delete":
+		if current == nil || current.DeletedAt != nil {
+			return syncApplied, ""
+		}
+		if op.BaseVersion == current.Version || clientTime.After(current.UpdatedAt) {
+			return syncApplied, ""
+		}
+		return syncConflict, "modified"
+	}
+	return syncInvalid, "unknown op"
+}
+
+func validateSyncOperation(op syncOperation) string {
+	if op.Op != "create" && op.Op != "update" && op.Op != "delete" {
+		return "op must be create, update or delete"
+	}
+	if !store.ValidClientID(op.ClientID) {
+		return "client_id must be a UUID"
+	}
+	if op.ClientUpdatedAt.IsZero() {
+		return "client_updated_at is required"
+	}
+	if op.Op == "delete" {
+		return ""
+	}
+	if op.Workout == nil {
+		return "workout is required"
+	}
+	if strings.TrimSpace(op.Workout.Title) == "" {
+		return "title is required"
+	}
+	for i := range op.Workout.Entries {
+		if msg := validateEntry(&op.Workout.Entries[i]); msg != "" {
+			return msg
+		}
+	}
+	if err := store.CheckEntryGroups(&store.Workout{Groups: op.Workout.Groups, Entries: op.Workout.Entries}); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func (sw *syncWorkout) applyTo(workout *store.Workout) {
+	workout.Title = sw.Title
+	workout.Description = sw.Description
+	workout.DurationMinutes = sw.DurationMinutes
+	workout.CaloriesBurned = sw.CaloriesBurned
+	workout.Groups = sw.Groups
+	workout.Entries = sw.Entries
+}
+
+// changesSince reads the next page of the change feed. Several changes to
+// the same workout collapse into one carrying its current state.
+func (wh *WorkoutHandler) changesSince(userID int, cursor int64, limit int) ([]syncChange, int64, bool, error) {
+	feed, err := wh.workoutStore.ListChanges(userID, cursor, limit+1)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	hasMore := len(feed) > limit
+	if hasMore {
+		feed = feed[:limit]
+	}
+	if len(feed) > 0 {
+		cursor = feed[len(feed)-1].Seq
+	}
+
+	latest := map[int]int{}
+	for i, change := range feed {
+		latest[change.WorkoutID] = i
+	}
+
+	changes := []syncChange{}
+	for i, change := range feed {
+		if latest[change.WorkoutID] != i {
+			continue
+		}
+
+		c := syncChange{ClientID: change.ClientID, WorkoutID: change.WorkoutID, Deleted: change.Deleted}
+		if !c.Deleted {
+			c.Workout, err = wh.workoutStore.GetWorkoutByID(int64(change.WorkoutID))
+			if errors.Is(err, sql.ErrNoRows) {
+				// deleted after this page's last change
+				c.Deleted, err = true, nil
+			}
+			if err != nil {
+				return nil, 0, false, err
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, cursor, hasMore, nil
+}
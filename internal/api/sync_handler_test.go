@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSyncConflict(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := now.Add(-time.Hour)
+	server := &store.Workout{Version: 3, UpdatedAt: now.Add(-10 * time.Minute)}
+	trashed := &store.Workout{Version: 4, UpdatedAt: deletedAt, DeletedAt: &deletedAt}
+
+	tests := []struct {
+		name       string
+		op         syncOperation
+		current    *store.Workout
+		wantStatus string
+		wantReason string
+	}{
+		{"new create", syncOperation{Op: "create", ClientUpdatedAt: now}, nil, syncApplied, ""},
+		{"retried create", syncOperation{Op: "create", ClientUpdatedAt: now}, server, syncApplied, ""},
+		{"update on current version", syncOperation{Op: "update", BaseVersion: 3, ClientUpdatedAt: now.Add(-time.Hour)}, server, syncApplied, ""},
+		{"stale update but newer edit wins", syncOperation{Op: "update", BaseVersion: 1, ClientUpdatedAt: now.Add(-time.Minute)}, server, syncApplied, ""},
+		{"stale update and older edit", syncOperation{Op: "update", BaseVersion: 1, ClientUpdatedAt: now.Add(-time.Hour)}, server, syncConflict, "stale"},
+		{"update of deleted workout", syncOperation{Op: "update", BaseVersion: 4, ClientUpdatedAt: now}, trashed, syncConflict, "deleted"},
+		{"update of unknown workout", syncOperation{Op: "update", ClientUpdatedAt: now}, nil, syncConflict, "not_found"},
+		{"delete of deleted workout", syncOperation{Op: "delete", ClientUpdatedAt: now}, trashed, syncApplied, ""},
+		{"delete after server edit", syncOperation{Op: "delete", BaseVersion: 2, ClientUpdatedAt: now.Add(-time.Hour)}, server, syncConflict, "modified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, reason := resolveSyncConflict(tt.op, tt.current, now)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestResolveSyncConflictClampsFutureClientTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// the server copy was written "in the future" relative to a client whose
+	// clock runs far ahead; the clamped client time must not beat it
+	server := &store.Workout{Version: 2, UpdatedAt: now}
+	op := syncOperation{Op: "update", BaseVersion: 1, ClientUpdatedAt: now.Add(24 * time.Hour)}
+
+	status, reason := resolveSyncConflict(op, server, now)
+	assert.Equal(t, syncConflict, status)
+	assert.Equal(t, "stale", reason)
+}
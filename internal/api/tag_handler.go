@@ -0,0 +1,271 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+const (
+	maxTagNameLength  = 50
+	defaultTagColor   = "#6b7280"
+	defaultSuggestTag = 10
+	maxSuggestTag     = 50
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagHandler struct {
+	tagStore store.TagStore
+	logger   *log.Logger
+}
+
+func NewTagHandler(tagStore store.TagStore, logger *log.Logger) *TagHandler {
+	return &TagHandler{
+		tagStore: tagStore,
+		logger:   logger,
+	}
+}
+
+type tagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+func (th *TagHandler) HandleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.tagStore.ListTags(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Println("ERROR: listTags:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tags": tags})
+}
+
+func (th *TagHandler) HandleCreateTag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Println("ERROR: decodingCreateTag:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	tag := &store.Tag{Color: defaultTagColor}
+	req.apply(tag)
+	if msg := validateTag(tag); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	err = th.tagStore.CreateTag(middleware.GetUser(r).ID, tag)
+	if errors.Is(err, store.ErrDuplicateTag) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Println("ERROR: createTag:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"tag": tag})
+}
+
+// HandleUpdateTag renames or recolors a tag; fields left out are kept.
+func (th *TagHandler) HandleUpdateTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid tag ID parameter"})
+		return
+	}
+
+	var req tagRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Println("ERROR: decodingUpdateTag:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+	tag, err := th.tagStore.GetTag(userID, tagID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag not found"})
+		return
+	}
+	if err != nil {
+		th.logger.Println("ERROR: getTag:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	req.apply(tag)
+	if msg := validateTag(tag); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	err = th.tagStore.UpdateTag(userID, tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag not found"})
+		return
+	}
+	if errors.Is(err, store.ErrDuplicateTag) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Println("ERROR: updateTag:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tag": tag})
+}
+
+// HandleDeleteTag deletes a tag and removes it from all workouts.
+func (th *TagHandler) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid tag ID parameter"})
+		return
+	}
+
+	err = th.tagStore.DeleteTag(middleware.GetUser(r).ID, tagID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag not found"})
+		return
+	}
+	if err != nil {
+		th.logger.Println("ERROR: deleteTag:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAutocompleteTags suggests tags starting with q, most used first:
+// GET /tags/autocomplete?q=&limit=
+func (th *TagHandler) HandleAutocompleteTags(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.ReadIntParam(r, "limit", defaultSuggestTag)
+	if err != nil || limit < 1 || limit > maxSuggestTag {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 50"})
+		return
+	}
+
+	prefix := strings.TrimSpace(r.URL.Query().Get("q"))
+	tags, err := th.tagStore.SuggestTags(middleware.GetUser(r).ID, prefix, limit)
+	if err != nil {
+		th.logger.Println("ERROR: suggestTags:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tags": tags})
+}
+
+// HandleSetWorkoutTags replaces the tags of a workout: {"tag_ids": [...]}.
+func (th *TagHandler) HandleSetWorkoutTags(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		return
+	}
+
+	var req struct {
+		TagIDs []int64 `json:"tag_ids"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.TagIDs == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "tag_ids is required"})
+		return
+	}
+
+	err = th.tagStore.SetWorkoutTags(middleware.GetUser(r).ID, workoutID, req.TagIDs)
+	th.writeTaggingResult(w, "setWorkoutTags", err)
+}
+
+func (th *TagHandler) HandleAddWorkoutTag(w http.ResponseWriter, r *http.Request) {
+	workoutID, tagID, ok := readTaggingParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := th.tagStore.AddWorkoutTag(middleware.GetUser(r).ID, workoutID, tagID)
+	th.writeTaggingResult(w, "addWorkoutTag", err)
+}
+
+func (th *TagHandler) HandleRemoveWorkoutTag(w http.ResponseWriter, r *http.Request) {
+	workoutID, tagID, ok := readTaggingParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := th.tagStore.RemoveWorkoutTag(middleware.GetUser(r).ID, workoutID, tagID)
+	th.writeTaggingResult(w, "removeWorkoutTag", err)
+}
+
+func (th *TagHandler) writeTaggingResult(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+	case errors.Is(err, store.ErrTagNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+	case err != nil:
+		th.logger.Println("ERROR: "+op+":", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func readTaggingParams(w http.ResponseWriter, r *http.Request) (workoutID, tagID int64, ok bool) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		return 0, 0, false
+	}
+	tagID, err = strconv.ParseInt(chi.URLParam(r, "tagID"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid tag ID parameter"})
+		return 0, 0, false
+	}
+	return workoutID, tagID, true
+}
+
+func (req *tagRequest) apply(tag *store.Tag) {
+	if req.Name != nil {
+		tag.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Color != nil {
+		tag.Color = strings.ToLower(*req.Color)
+	}
+}
+
+// validateTag returns "" when the tag can be stored.
+func validateTag(tag *store.Tag) string {
+	if tag.Name == "" {
+		return "name is required"
+	}
+	if utf8.RuneCountInString(tag.Name) > maxTagNameLength {
+		return "name must be at most " + strconv.Itoa(maxTagNameLength) + " characters"
+	}
+	if !tagColorPattern.MatchString(tag.Color) {
+		return "color must be a hex color like #1e90ff"
+	}
+	return ""
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+const maxWebhookURLLength = 2048
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	logger       *log.Logger
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+		logger:       logger,
+	}
+}
+
+type webhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	AllUsers   *bool    `json:"all_users"`
+	Active     *bool    `json:"active"`
+}
+
+// HandleCreateWebhook subscribes a URL to events:
+// {"url", "event_types", "all_users", "active"}. The response carries the
+// signing secret, which is not shown again.
+func (wh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeCreateWebhook:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	sub := &store.WebhookSubscription{UserID: user.ID, Active: true}
+	req.apply(sub)
+	if !checkWebhook(w, user, nil, sub) {
+		return
+	}
+
+	err = wh.webhookStore.CreateWebhook(sub)
+	if err != nil {
+		wh.logger.Println("ERROR: createWebhook:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// the response holds the signing secret, which must not be stored
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"webhook": sub})
+}
+
+func (wh *WebhookHandler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := wh.webhookStore.ListWebhooks(middleware.GetUser(r).ID)
+	if err != nil {
+		wh.logger.Println("ERROR: listWebhooks:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhooks": subs})
+}
+
+func (wh *WebhookHandler) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := wh.loadOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhook": sub})
+}
+
+// HandleUpdateWebhook changes the fields present in the body.
+func (wh *WebhookHandler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := wh.loadOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeUpdateWebhook:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	stored := *sub
+	req.apply(sub)
+	if !checkWebhook(w, middleware.GetUser(r), &stored, sub) {
+		return
+	}
+
+	err = wh.webhookStore.UpdateWebhook(sub)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: updateWebhook:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"webhook": sub})
+}
+
+// HandleDeleteWebhook removes the subscription with its delivery logs.
+func (wh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid webhook ID parameter"})
+		return
+	}
+
+	err = wh.webhookStore.DeleteWebhook(middleware.GetUser(r).ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook not found"})
+		return
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: deleteWebhook:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListDeliveries lists the subscription's deliveries, newest first:
+// GET /webhooks/{id}/deliveries?limit=&offset=
+func (wh *WebhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := wh.loadOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit, err := utils.ReadIntParam(r, "limit", defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := utils.ReadIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	deliveries, err := wh.webhookStore.ListWebhookDeliveries(int64(sub.ID), limit, offset)
+	if err != nil {
+		wh.logger.Println("ERROR: listWebhookDeliveries:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"deliveries": deliveries})
+}
+
+// HandleGetDelivery returns a delivery with the log of its attempts.
+func (wh *WebhookHandler) HandleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	sub, deliveryID, ok := wh.readDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := wh.webhookStore.GetWebhookDelivery(int64(sub.ID), deliveryID)
+	wh.writeDeliveryResult(w, http.StatusOK, "getWebhookDelivery", delivery, err)
+}
+
+// HandleRedeliver sends a delivery again, for instance after the receiver
+// was fixed. Its retries start over.
+func (wh *WebhookHandler) HandleRedeliver(w http.ResponseWriter, r *http.Request) {
+	sub, deliveryID, ok := wh.readDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := wh.webhookStore.RedeliverWebhook(int64(sub.ID), deliveryID)
+	wh.writeDeliveryResult(w, http.StatusAccepted, "redeliverWebhook", delivery, err)
+}
+
+func (wh *WebhookHandler) writeDeliveryResult(w http.ResponseWriter, status int, op string, delivery *store.WebhookDelivery, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "delivery not found"})
+	case err != nil:
+		wh.logger.Println("ERROR: "+op+":", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	default:
+		utils.WriteJSON(w, status, utils.Envelope{"delivery": delivery})
+	}
+}
+
+func (wh *WebhookHandler) readDeliveryParams(w http.ResponseWriter, r *http.Request) (*store.WebhookSubscription, int64, bool) {
+	sub, ok := wh.loadOwnedWebhook(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid delivery ID parameter"})
+		return nil, 0, false
+	}
+	return sub, deliveryID, true
+}
+
+// loadOwnedWebhook looks up the {id} URL parameter among the user's
+// subscriptions. When it returns false the error response has been
+// written.
+func (wh *WebhookHandler) loadOwnedWebhook(w http.ResponseWriter, r *http.Request) (*store.WebhookSubscription, bool) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid webhook ID parameter"})
+		return nil, false
+	}
+
+	sub, err := wh.webhookStore.GetWebhook(middleware.GetUser(r).ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook not found"})
+		return nil, false
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: getWebhook:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	return sub, true
+}
+
+func (req *webhookRequest) apply(sub *store.WebhookSubscription) {
+	if req.URL != nil {
+		sub.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.EventTypes != nil {
+		sub.EventTypes = req.EventTypes
+	}
+	if req.AllUsers != nil {
+		sub.AllUsers = *req.AllUsers
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+}
+
+// checkWebhook validates the subscription for user and writes the error
+// response when it returns false. stored is the subscription being
+// updated, nil on create.
+func checkWebhook(w http.ResponseWriter, user *store.User, stored, sub *store.WebhookSubscription) bool {
+	if sub.AllUsers && !user.IsAdmin && !deactivatesAllUsers(stored, sub) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only admins may subscribe to the events of all users"})
+		return false
+	}
+	if msg := validateWebhook(sub); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return false
+	}
+	return true
+}
+
+// deactivatesAllUsers reports whether an update of an all_users subscription
+// only takes it out of use: it ends inactive and asks for no event it
+// didn't before. Users who are no longer admins may still do that, like
+// they may delete it.
+func deactivatesAllUsers(stored, sub *store.WebhookSubscription) bool {
+	if stored == nil || !stored.AllUsers || sub.Active {
+		return false
+	}
+	for _, eventType := range sub.EventTypes {
+		if !slices.Contains(stored.EventTypes, eventType) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhook returns "" when the subscription can be stored.
+func validateWebhook(sub *store.WebhookSubscription) string {
+	if sub.URL == "" {
+		return "url is required"
+	}
+	if len(sub.URL) > maxWebhookURLLength {
+		return "url must be at most 2048 characters"
+	}
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "url must be an absolute http or https URL without credentials"
+	}
+
+	if len(sub.EventTypes) == 0 {
+		return "event_types is required"
+	}
+	for i, eventType := range sub.EventTypes {
+		if !slices.Contains(store.WebhookEventTypes, eventType) {
+			return "event_types must only contain " + strings.Join(store.WebhookEventTypes, ", ")
+		}
+		if slices.Contains(sub.EventTypes[:i], eventType) {
+			return "event_types must not repeat " + eventType
+		}
+		if eventType == store.EventUserRegistered && !sub.AllUsers {
+			return store.EventUserRegistered + " requires all_users"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	valid := func() *store.WebhookSubscription {
+		return &store.WebhookSubscription{URL: "https://example.com/hook", EventTypes: []string{store.EventWorkoutCreated}}
+	}
+	assert.Equal(t, "", validateWebhook(valid()))
+
+	tests := map[string]func(*store.WebhookSubscription){
+		"no url":         func(s *store.WebhookSubscription) { s.URL = "" },
+		"relative url":   func(s *store.WebhookSubscription) { s.URL = "/hook" },
+		"ftp url":        func(s *store.WebhookSubscription) { s.URL = "ftp://example.com/hook" },
+		"credentials":    func(s *store.WebhookSubscription) { s.URL = "https://user:pw@example.com/hook" },
+		"long url":       func(s *store.WebhookSubscription) { s.URL = "https://example.com/" + strings.Repeat("a", 2048) },
+		"no event types": func(s *store.WebhookSubscription) { s.EventTypes = nil },
+		"unknown event":  func(s *store.WebhookSubscription) { s.EventTypes = []string{"workout.liked"} },
+		"repeated event": func(s *store.WebhookSubscription) { s.EventTypes = append(s.EventTypes, store.EventWorkoutCreated) },
+		"registrations":  func(s *store.WebhookSubscription) { s.EventTypes = []string{store.EventUserRegistered} },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			sub := valid()
+			change(sub)
+			assert.NotEqual(t, "", validateWebhook(sub))
+		})
+	}
+
+	sub := valid()
+	sub.EventTypes = []string{store.EventUserRegistered}
+	sub.AllUsers = true
+	assert.Equal(t, "", validateWebhook(sub))
+}
+
+func TestCheckWebhookFormerAdmin(t *testing.T) {
+	user := &store.User{ID: 1}
+	stored := &store.WebhookSubscription{
+		UserID:     1,
+		URL:        "https://example.com/hook",
+		EventTypes: []string{store.EventWorkoutCreated, store.EventUserRegistered},
+		AllUsers:   true,
+		Active:     true,
+	}
+	check := func(change func(*store.WebhookSubscription)) int {
+		sub := *stored
+		sub.EventTypes = slices.Clone(stored.EventTypes)
+		change(&sub)
+		w := httptest.NewRecorder()
+		checkWebhook(w, user, stored, &sub)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, check(func(s *store.WebhookSubscription) { s.Active = false }))
+	assert.Equal(t, http.StatusOK, check(func(s *store.WebhookSubscription) {
+		s.Active, s.EventTypes = false, []string{store.EventWorkoutCreated}
+	}))
+	assert.Equal(t, http.StatusForbidden, check(func(s *store.WebhookSubscription) { s.URL = "https://example.com/other" }))
+	assert.Equal(t, http.StatusForbidden, check(func(s *store.WebhookSubscription) {
+		s.Active = false
+		s.EventTypes = append(s.EventTypes, store.EventWorkoutDeleted)
+	}))
+
+	stored.Active = false
+	assert.Equal(t, http.StatusForbidden, check(func(s *store.WebhookSubscription) { s.Active = true }))
+
+	w := httptest.NewRecorder()
+	assert.False(t, checkWebhook(w, user, nil, &store.WebhookSubscription{URL: stored.URL, EventTypes: stored.EventTypes, AllUsers: true}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
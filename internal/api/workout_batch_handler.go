@@ -0,0 +1,222 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const maxBatchOps = 100
+
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "best_effort"
+)
+
+// errBatchAborted makes RunBatch roll back an atomic batch after one of its
+// operations failed.
+var errBatchAborted = errors.New("batch aborted")
+
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version int             `json:"version"`
+	Workout json.RawMessage `json:"workout"`
+}
+
+type batchResult struct {
+	Index   int            `json:"index"`
+	Op      string         `json:"op"`
+	Status  int            `json:"status"`
+	ID      int            `json:"id,omitempty"`
+	Workout *store.Workout `json:"workout,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// HandleBatchWorkouts runs a list of create, update and delete operations
+// in one transaction. In "atomic" mode (the default) the first failing
+// operation rolls back the whole batch; in "best_effort" mode failed
+// operations are skipped and the rest is committed. Every operation gets
+// the status code it would have had as a single request.
+//
+// Updates take the same body as PUT /workouts/{id}; "version", when set,
+// must match the workout's current version like an If-Match header.
+func (wh *WorkoutHandler) HandleBatchWorkouts(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeBatch:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = batchAtomic
+	}
+	if req.Mode != batchAtomic && req.Mode != batchBestEffort {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mode must be atomic or best_effort"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOps {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a batch needs between 1 and " + strconv.Itoa(maxBatchOps) + " operations"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+	results := make([]batchResult, len(req.Operations))
+	failed := false
+	err = wh.workoutStore.RunBatch(userID, func(batch *store.WorkoutBatch) error {
+		for i, op := range req.Operations {
+			result, err := runBatchOperation(batch, userID, op)
+			if err != nil {
+				if req.Mode == batchAtomic {
+					return err
+				}
+				wh.logger.Println("ERROR: batchOperation:", err)
+				result = batchResult{Status: http.StatusInternalServerError, Error: "internal server error"}
+			}
+			result.Index, result.Op = i, op.Op
+			results[i] = result
+
+			if result.Status >= http.StatusBadRequest {
+				failed = true
+				if req.Mode == batchAtomic {
+					markRolledBack(results, i, req.Operations)
+					return errBatchAborted
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchAborted) {
+		wh.logger.Println("ERROR: runBatch:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case failed && req.Mode == batchAtomic:
+		status = http.StatusUnprocessableEntity
+	case failed:
+		status = http.StatusMultiStatus
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"mode": req.Mode, "results": results})
+}
+
+// runBatchOperation applies one operation. Problems with the operation
+// itself end up in the result; the error is only set for failures of the
+// database.
+func runBatchOperation(batch *store.WorkoutBatch, userID int, op batchOperation) (batchResult, error) {
+	switch op.Op {
+	case "create":
+		var req workoutCreate
+		err := json.Unmarshal(op.Workout, &req)
+		if err != nil {
+			return batchResult{Status: http.StatusBadRequest, Error: "invalid workout"}, nil
+		}
+		workout := req.workout(userID)
+		if msg := validateWorkout(workout); msg != "" {
+			return batchResult{Status: http.StatusUnprocessableEntity, Error: msg}, nil
+		}
+		err = batch.CreateWorkout(workout)
+		if err != nil {
+			return batchResult{}, err
+		}
+		return batchResult{Status: http.StatusCreated, ID: workout.ID, Workout: workout}, nil
+
+	case "update", "delete":
+		workout, err := batch.GetWorkout(op.ID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && workout.UserID != userID) {
+			return batchResult{Status: http.StatusNotFound, ID: int(op.ID), Error: "workout not found"}, nil
+		}
+		if err != nil {
+			return batchResult{}, err
+		}
+		if op.Version != 0 && op.Version != workout.Version {
+			return batchResult{Status: http.StatusPreconditionFailed, ID: workout.ID, Error: "workout has been modified, fetch it again before updating"}, nil
+		}
+
+		if op.Op == "delete" {
+			err = batch.DeleteWorkout(op.ID, userID, workout.Version)
+			if errors.Is(err, store.ErrVersionConflict) {
+				return batchResult{Status: http.StatusConflict, ID: workout.ID, Error: "workout was modified concurrently, please retry"}, nil
+			}
+			if err != nil {
+				return batchResult{}, err
+			}
+			return batchResult{Status: http.StatusNoContent, ID: workout.ID}, nil
+		}
+
+		var update workoutUpdate
+		err = json.Unmarshal(op.Workout, &update)
+		if err != nil {
+			return batchResult{Status: http.StatusBadRequest, ID: workout.ID, Error: "invalid workout"}, nil
+		}
+		update.apply(workout)
+		if msg := validateWorkout(workout); msg != "" {
+			return batchResult{Status: http.StatusUnprocessableEntity, ID: workout.ID, Error: msg}, nil
+		}
+		err = batch.UpdateWorkout(workout, userID)
+		if errors.Is(err, store.ErrVersionConflict) {
+			return batchResult{Status: http.StatusConflict, ID: workout.ID, Error: "workout was modified concurrently, please retry"}, nil
+		}
+		if errors.Is(err, store.ErrInvalidEntryGroups) {
+			return batchResult{Status: http.StatusUnprocessableEntity, ID: workout.ID, Error: err.Error()}, nil
+		}
+		if err != nil {
+			return batchResult{}, err
+		}
+		return batchResult{Status: http.StatusOK, ID: workout.ID, Workout: workout}, nil
+	}
+
+	return batchResult{Status: http.StatusBadRequest, Error: "op must be create, update or delete"}, nil
+}
+
+// markRolledBack rewrites the results of an atomic batch that failed at
+// operation failedAt: earlier operations were undone and later ones never
+// ran.
+func markRolledBack(results []batchResult, failedAt int, ops []batchOperation) {
+	for i, op := range ops {
+		switch {
+		case i < failedAt:
+			result := batchResult{Index: i, Op: op.Op, Status: http.StatusFailedDependency, Error: "rolled back"}
+			if op.Op != "create" {
+				result.ID = results[i].ID
+			}
+			results[i] = result
+		case i > failedAt:
+			results[i] = batchResult{Index: i, Op: op.Op, Status: http.StatusFailedDependency, Error: "not executed"}
+		}
+	}
+}
+
+const visibilityError = "visibility must be private, followers or public"
+
+// validateWorkout returns "" when the workout can be stored.
+func validateWorkout(workout *store.Workout) string {
+	if strings.TrimSpace(workout.Title) == "" {
+		return "title is required"
+	}
+	if workout.Visibility != "" && !store.ValidVisibility(workout.Visibility) {
+		return visibilityError
+	}
+	for i := range workout.Entries {
+		if msg := validateEntry(&workout.Entries[i]); msg != "" {
+			return "entries/" + strconv.Itoa(i) + ": " + msg
+		}
+	}
+	if err := store.CheckEntryGroups(workout); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkRolledBack(t *testing.T) {
+	ops := []batchOperation{{Op: "create"}, {Op: "update", ID: 7}, {Op: "delete", ID: 9}, {Op: "create"}}
+	results := []batchResult{
+		{Index: 0, Op: "create", Status: http.StatusCreated, ID: 41},
+		{Index: 1, Op: "update", Status: http.StatusOK, ID: 7},
+		{Index: 2, Op: "delete", Status: http.StatusNotFound, ID: 9, Error: "workout not found"},
+		{},
+	}
+
+	markRolledBack(results, 2, ops)
+
+	assert.Equal(t, batchResult{Index: 0, Op: "create", Status: http.StatusFailedDependency, Error: "rolled back"}, results[0])
+	assert.Equal(t, batchResult{Index: 1, Op: "update", Status: http.StatusFailedDependency, ID: 7, Error: "rolled back"}, results[1])
+	assert.Equal(t, http.StatusNotFound, results[2].Status)
+	assert.Equal(t, batchResult{Index: 3, Op: "create", Status: http.StatusFailedDependency, Error: "not executed"}, results[3])
+}
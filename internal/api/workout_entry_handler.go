@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+func (wh *WorkoutHandler) HandleListEntries(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries": nonNilEntries(workout.Entries)})
+}
+
+func (wh *WorkoutHandler) HandleCreateEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	var entry store.WorkoutEntry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeEntry:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	entry.ID = 0
+	if msg := validateEntry(&entry); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	err = wh.workoutStore.CreateEntry(workout, &entry, middleware.GetUser(r).ID)
+	if !wh.handleEntryWriteError(w, r, err) {
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"entry": entry})
+}
+
+// HandleUpdateEntry changes the fields present in the body and leaves the
+// rest alone. An explicit null clears reps, duration_seconds or weight.
+func (wh *WorkoutHandler) HandleUpdateEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := findEntry(w, r, workout)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	// decoding onto the stored entry only overwrites the fields in the body
+	updated := *entry
+	err := json.NewDecoder(r.Body).Decode(&updated)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeEntry:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	updated.ID = entry.ID
+	updated.WorkoutID = entry.WorkoutID
+	updated.CreatedAt = entry.CreatedAt
+	if msg := validateEntry(&updated); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	err = wh.workoutStore.UpdateEntry(workout, &updated, middleware.GetUser(r).ID)
+	if !wh.handleEntryWriteError(w, r, err) {
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entry": updated})
+}
+
+func (wh *WorkoutHandler) HandleDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := findEntry(w, r, workout)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	err := wh.workoutStore.DeleteEntry(workout, int64(entry.ID), middleware.GetUser(r).ID)
+	if !wh.handleEntryWriteError(w, r, err) {
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleReorderEntries takes {"entry_ids": [...]} listing every entry of the
+// workout in its new order.
+func (wh *WorkoutHandler) HandleReorderEntries(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	var req struct {
+		EntryIDs []int64 `json:"entry_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Println("ERROR: decodeReorder:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	err = wh.workoutStore.ReorderEntries(workout, req.EntryIDs, middleware.GetUser(r).ID)
+	if errors.Is(err, store.ErrInvalidEntryOrder) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if !wh.handleEntryWriteError(w, r, err) {
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries": nonNilEntries(workout.Entries)})
+}
+
+// handleEntryWriteError writes the response for a failed entry write and
+// reports whether the handler may continue.
+func (wh *WorkoutHandler) handleEntryWriteError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return true
+	}
+	if writeVersionConflict(w, r, err) {
+		return false
+	}
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "entry not found"})
+		return false
+	}
+	if errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return false
+	}
+
+	wh.logger.Println("ERROR: writeEntry:", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	return false
+}
+
+// findEntry looks up the {entryID} URL parameter among the workout's
+// entries. When it returns false the error response has been written.
+func findEntry(w http.ResponseWriter, r *http.Request, workout *store.Workout) (*store.WorkoutEntry, bool) {
+	entryID, err := strconv.Atoi(chi.URLParam(r, "entryID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid entry ID parameter"})
+		return nil, false
+	}
+
+	for i := range workout.Entries {
+		if workout.Entries[i].ID == entryID {
+			return &workout.Entries[i], true
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "entry not found"})
+	return nil, false
+}
+
+// validateEntry mirrors the valid_workout_entry check constraint so clients
+// get a 422 instead of a database error. It returns "" when the entry is
+// valid.
+func validateEntry(entry *store.WorkoutEntry) string {
+	if strings.TrimSpace(entry.ExerciseName) == "" {
+		return "exercise_name is required"
+	}
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return "exactly one of reps or duration_seconds is required"
+	}
+	return ""
+}
@@ -1,53 +1,104 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 
+	"github.com/Anezz12/femProject/internal/middleware"
 	"github.com/Anezz12/femProject/internal/store"
 	"github.com/Anezz12/femProject/internal/utils"
 )
 
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
+	followStore  store.FollowStore
 	logger       *log.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, followStore store.FollowStore, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutStore: workoutStore,
+		followStore:  followStore,
 		logger:       logger,
 	}
 }
 
+// viewedWorkout is what users other than the owner see of a workout: the
+// share link view, plus the ids and counts they need to comment and react.
+type viewedWorkout struct {
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	sharedWorkout
+	Entries      []viewedEntry  `json:"entries"`
+	CommentCount int            `json:"comment_count"`
+	Reactions    map[string]int `json:"reactions"`
+}
+
+type viewedEntry struct {
+	ID int `json:"id"`
+	sharedEntry
+}
+
+func newViewedWorkout(workout *store.Workout) *viewedWorkout {
+	shared := newSharedWorkout(workout)
+	viewed := &viewedWorkout{
+		ID:            workout.ID,
+		UserID:        workout.UserID,
+		sharedWorkout: *shared,
+		Entries:       make([]viewedEntry, 0, len(shared.Entries)),
+		CommentCount:  workout.CommentCount,
+		Reactions:     workout.Reactions,
+	}
+	for i, entry := range shared.Entries {
+		viewed.Entries = append(viewed.Entries, viewedEntry{ID: workout.Entries[i].ID, sharedEntry: entry})
+	}
+	return viewed
+}
+
 func (wh *WorkoutHandler) HandleGetWorkByID(w http.ResponseWriter, r *http.Request) {
-	workoutID, err := utils.ReadIDParam(r)
-	if err != nil {
-		wh.logger.Println("ERROR: getWorkoutByID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+	workout, ok := loadVisibleWorkout(w, r, wh.workoutStore, wh.followStore, wh.logger)
+	if !ok {
 		return
 	}
 
-	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
-	if err != nil {
-		wh.logger.Println("ERROR: getWorkoutByID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	etag := workoutCacheETag(workout)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
+	if workout.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": newViewedWorkout(workout)})
+		return
+	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
-	var workout store.Workout
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	var req workoutCreate
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		wh.logger.Println("ERROR: decodeWorkout:", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Failed to create workout"})
 		return
 	}
-	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+
+	workout := req.workout(middleware.GetUser(r).ID)
+	if msg := validateWorkout(workout); msg != "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": msg})
+		return
+	}
+
+	createdWorkout, err := wh.workoutStore.CreateWorkout(workout)
+	if errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.logger.Println("ERROR: createWorkout:", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
@@ -58,81 +109,265 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
-	workoutID, err := utils.ReadIDParam(r)
+	existingWorkout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(w, r, existingWorkout) {
+		return
+	}
+
+	// at this point we can assume we are able to find an existing workout
+	var updateWorkoutRequest workoutUpdate
+	err := json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
 	if err != nil {
-		wh.logger.Println("ERROR: getWorkoutByID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		wh.logger.Println("ERROR: decodeWorkout:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if updateWorkoutRequest.Visibility != nil && !store.ValidVisibility(*updateWorkoutRequest.Visibility) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": visibilityError})
 		return
 	}
 
-	existingWorkout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	updateWorkoutRequest.apply(existingWorkout)
+
+	err = wh.workoutStore.UpdateWorkout(existingWorkout, middleware.GetUser(r).ID)
+	if writeVersionConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		wh.logger.Println("ERROR: getWorkoutByID:", err)
+		wh.logger.Println("ERROR: updateWorkout:", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	if existingWorkout == nil {
-		http.Error(w, "Workout not found", http.StatusNotFound)
+	w.Header().Set("ETag", workoutETag(existingWorkout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+}
+
+func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
 		return
 	}
 
-	// at this point we can assume we are able to find an existing workout
-	var updateWorkoutRequest struct {
-		Title           *string              `json:"title"`
-		Description     *string              `json:"description"`
-		DurationMinutes *int                 `json:"duration_minutes"`
-		CaloriesBurned  *int                 `json:"calories_burned"`
-		Entries         []store.WorkoutEntry `json:"entries"`
+	// the delete is only conditional when the client asks for it
+	expectedVersion := 0
+	if r.Header.Get("If-Match") != "" {
+		if !checkIfMatch(w, r, workout) {
+			return
+		}
+		expectedVersion = workout.Version
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
+	err := wh.workoutStore.DeleteWorkout(int64(workout.ID), workout.UserID, expectedVersion)
+	if writeVersionConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
 	if err != nil {
-		wh.logger.Println("ERROR: decodeWorkout:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		wh.logger.Println("ERROR: deleteWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	if updateWorkoutRequest.Title != nil {
-		existingWorkout.Title = *updateWorkoutRequest.Title
-	}
-	if updateWorkoutRequest.Description != nil {
-		existingWorkout.Description = *updateWorkoutRequest.Description
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "Workout deleted successfully"})
+}
+
+func (wh *WorkoutHandler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	workouts, err := wh.workoutStore.ListDeletedWorkouts(middleware.GetUser(r).ID)
+	if err != nil {
+		wh.logger.Println("ERROR: listDeletedWorkouts:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
 	}
-	if updateWorkoutRequest.DurationMinutes != nil {
-		existingWorkout.DurationMinutes = *updateWorkoutRequest.DurationMinutes
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+}
+
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Println("ERROR: restoreWorkout:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		return
 	}
-	if updateWorkoutRequest.CaloriesBurned != nil {
-		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
+
+	err = wh.workoutStore.RestoreWorkout(workoutID, middleware.GetUser(r).ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found in trash"})
+		return
 	}
-	if updateWorkoutRequest.Entries != nil {
-		existingWorkout.Entries = updateWorkoutRequest.Entries
+	if err != nil {
+		wh.logger.Println("ERROR: restoreWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 	if err != nil {
-		wh.logger.Println("ERROR: updateWorkout:", err)
+		wh.logger.Println("ERROR: getWorkoutByID:", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
-func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
+// workoutCreate is the body of a new workout. The server decides the rest:
+// ids, the owner, the client_id and the creation time, which only imports
+// and offline sync may set, and the activity, which only comes from an
+// uploaded file.
+type workoutCreate struct {
+	Title           string               `json:"title"`
+	Description     string               `json:"description"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	CaloriesBurned  int                  `json:"calories_burned"`
+	Visibility      string               `json:"visibility"`
+	Groups          []store.EntryGroup   `json:"groups"`
+	Entries         []store.WorkoutEntry `json:"entries"`
+}
+
+func (c *workoutCreate) workout(userID int) *store.Workout {
+	return &store.Workout{
+		UserID:          userID,
+		Title:           c.Title,
+		Description:     c.Description,
+		DurationMinutes: c.DurationMinutes,
+		CaloriesBurned:  c.CaloriesBurned,
+		Visibility:      c.Visibility,
+		Groups:          c.Groups,
+		Entries:         c.Entries,
+	}
+}
+
+// workoutUpdate is the body of a PUT: fields left out keep their value and
+// entries, when present, replace all existing entries. Groups, when
+// present, replace the groups; entries refer to them by position either
+// way, and groups left without entries are dropped.
+type workoutUpdate struct {
+	Title           *string              `json:"title"`
+	Description     *string              `json:"description"`
+	DurationMinutes *int                 `json:"duration_minutes"`
+	CaloriesBurned  *int                 `json:"calories_burned"`
+	Visibility      *string              `json:"visibility"`
+	Groups          []store.EntryGroup   `json:"groups"`
+	Entries         []store.WorkoutEntry `json:"entries"`
+}
+
+func (u *workoutUpdate) apply(workout *store.Workout) {
+	if u.Title != nil {
+		workout.Title = *u.Title
+	}
+	if u.Description != nil {
+		workout.Description = *u.Description
+	}
+	if u.DurationMinutes != nil {
+		workout.DurationMinutes = *u.DurationMinutes
+	}
+	if u.CaloriesBurned != nil {
+		workout.CaloriesBurned = *u.CaloriesBurned
+	}
+	if u.Visibility != nil {
+		workout.Visibility = *u.Visibility
+	}
+	if u.Groups != nil {
+		workout.Groups = u.Groups
+	}
+	if u.Entries != nil {
+		workout.Entries = u.Entries
+	}
+}
+
+// loadOwnedWorkout reads the {id} URL parameter and loads that workout for
+// the current user. When it returns false the error response has already
+// been written. Workouts of other users are reported as not found.
+func (wh *WorkoutHandler) loadOwnedWorkout(w http.ResponseWriter, r *http.Request) (*store.Workout, bool) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Println("ERROR: deleteWorkout:", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID parameter"})
+		return nil, false
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && workout.UserID != middleware.GetUser(r).ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return nil, false
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: getWorkoutByID:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	return workout, true
+}
+
+// HandleCloneWorkout starts a new session from an existing workout. The
+// optional body can rename it, reset or scale the weights and leave out
+// entries: {"title", "reset_weights", "increase_percent", "drop_entry_ids"}.
+func (wh *WorkoutHandler) HandleCloneWorkout(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title           string  `json:"title"`
+		ResetWeights    bool    `json:"reset_weights"`
+		IncreasePercent float64 `json:"increase_percent"`
+		DropEntryIDs    []int   `json:"drop_entry_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		wh.logger.Println("ERROR: decodeClone:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+	if req.ResetWeights && req.IncreasePercent != 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "reset_weights and increase_percent cannot be combined"})
+		return
+	}
+	if req.IncreasePercent <= -100 || req.IncreasePercent > 100 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "increase_percent must be above -100 and at most 100"})
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	clone, err := wh.workoutStore.CloneWorkout(int64(workout.ID), store.CloneOptions{
+		UserID:          middleware.GetUser(r).ID,
+		Title:           req.Title,
+		ResetWeights:    req.ResetWeights,
+		IncreasePercent: req.IncreasePercent,
+		DropEntryIDs:    req.DropEntryIDs,
+	})
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "drop_entry_ids may only list entries of this workout"})
+		return
+	}
+	if errors.Is(err, store.ErrWeightOutOfRange) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "increase_percent pushes a weight out of range"})
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
 	if err != nil {
-		wh.logger.Println("ERROR: deleteWorkout:", err)
+		wh.logger.Println("ERROR: cloneWorkout:", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "Workout deleted successfully"})
+	w.Header().Set("ETag", workoutETag(clone))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": clone})
 }
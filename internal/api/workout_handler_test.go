@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryWorkoutStore struct {
+	store.WorkoutStore
+
+	workouts map[int64]*store.Workout
+}
+
+func (m *memoryWorkoutStore) GetWorkoutByID(id int64) (*store.Workout, error) {
+	workout, ok := m.workouts[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return workout, nil
+}
+
+func TestHandleGetWorkoutByIDStripsFollowerView(t *testing.T) {
+	workouts := &memoryWorkoutStore{workouts: map[int64]*store.Workout{
+		7: {
+			ID:         7,
+			UserID:     1,
+			ClientID:   "4f1c1a52-8d1e-4d2c-9a55-0a3c8c2b1f10",
+			Version:    4,
+			Title:      "Long run",
+			Visibility: store.VisibilityFollowers,
+			Tags:       []store.Tag{{ID: 1, Name: "injury rehab"}},
+			Entries:    []store.WorkoutEntry{{ID: 11, WorkoutID: 7, ExerciseName: "Strides", Sets: 4}},
+			Activity: &store.WorkoutActivity{
+				Sport:            "running",
+				DistanceMeters:   15000,
+				Route:            [][2]float64{{52.37, 4.89}},
+				HeartRateSamples: []store.HeartRateSample{{OffsetSeconds: 0, BPM: 120}},
+			},
+			CommentCount: 2,
+			Reactions:    map[string]int{"🔥": 1},
+		},
+	}}
+	follows := &memoryFollowStore{accepted: map[[2]int]bool{{2, 1}: true}}
+	wh := NewWorkoutHandler(workouts, follows, log.New(&strings.Builder{}, "", 0))
+
+	get := func(user *store.User) map[string]any {
+		r := chi.NewRouter()
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, middleware.SetUser(r, user))
+			})
+		})
+		r.Get("/workouts/{id}", wh.HandleGetWorkByID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/workouts/7", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Workout map[string]any `json:"workout"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Workout
+	}
+
+	viewed := get(&store.User{ID: 2})
+	for _, field := range []string{"client_id", "version", "visibility", "tags"} {
+		assert.NotContains(t, viewed, field)
+	}
+	assert.Equal(t, 7.0, viewed["id"])
+	assert.Equal(t, 1.0, viewed["user_id"])
+	assert.Equal(t, "Long run", viewed["title"])
+	assert.Equal(t, 2.0, viewed["comment_count"])
+	assert.Equal(t, map[string]any{"🔥": 1.0}, viewed["reactions"])
+
+	entry := viewed["entries"].([]any)[0].(map[string]any)
+	assert.Equal(t, 11.0, entry["id"])
+	assert.Equal(t, "Strides", entry["exercise_name"])
+
+	activity := viewed["activity"].(map[string]any)
+	assert.NotContains(t, activity, "route")
+	assert.NotContains(t, activity, "heart_rate_samples")
+	assert.Equal(t, 15000.0, activity["distance_meters"])
+
+	owned := get(&store.User{ID: 1})
+	assert.Equal(t, "4f1c1a52-8d1e-4d2c-9a55-0a3c8c2b1f10", owned["client_id"])
+	assert.Contains(t, owned["activity"], "route")
+}
+
+func TestWorkoutCreateIgnoresServerFields(t *testing.T) {
+	body := `{
+		"id": 9,
+		"user_id": 4,
+		"client_id": "not-a-uuid",
+		"title": "Push",
+		"created_at": "2001-01-01T00:00:00Z",
+		"activity": {"sport": "running", "route": [[52.37, 4.89]]},
+		"entries": [{"exercise_name": "Bench", "sets": 3, "reps": 5}]
+	}`
+	var req workoutCreate
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+
+	workout := req.workout(2)
+	assert.Equal(t, 0, workout.ID)
+	assert.Equal(t, 2, workout.UserID)
+	assert.Empty(t, workout.ClientID)
+	assert.True(t, workout.CreatedAt.IsZero())
+	assert.Nil(t, workout.Activity)
+	assert.Equal(t, "Push", workout.Title)
+	assert.Len(t, workout.Entries, 1)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Anezz12/femProject/internal/activity"
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const (
+	maxActivityUploadBytes = 20 << 20
+	splitDistanceMeters    = 1000
+	routeToleranceMeters   = 10
+)
+
+// HandleImportWorkout accepts a multipart upload with a GPX or TCX file in
+// the "file" field and stores it as a cardio workout. Optional "title" and
+// "calories_burned" fields override what we derive from the file.
+func (wh *WorkoutHandler) HandleImportWorkout(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxActivityUploadBytes)
+	err := r.ParseMultipartForm(maxActivityUploadBytes)
+	if err != nil {
+		wh.logger.Println("ERROR: parseImportForm:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid upload, expected multipart form with a file field"})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		wh.logger.Println("ERROR: importFormFile:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	act, err := activity.Parse(header.Filename, file)
+	if err != nil {
+		wh.logger.Println("ERROR: parseActivity:", err)
+		if errors.Is(err, activity.ErrUnsupportedFormat) {
+			utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "only GPX and TCX files are supported"})
+			return
+		}
+		if errors.Is(err, activity.ErrNoTrackPoints) {
+			utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "activity file has no timed track points"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "could not parse activity file"})
+		return
+	}
+
+	caloriesBurned := 0
+	if value := r.FormValue("calories_burned"); value != "" {
+		caloriesBurned, err = strconv.Atoi(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "calories_burned must be a number"})
+			return
+		}
+	}
+
+	workout := workoutFromActivity(act, r.FormValue("title"), caloriesBurned)
+	workout.UserID = middleware.GetUser(r).ID
+
+	createdWorkout, err := wh.workoutStore.CreateWorkout(workout)
+	if err != nil {
+		wh.logger.Println("ERROR: createImportedWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
+
+func workoutFromActivity(act *activity.Activity, title string, caloriesBurned int) *store.Workout {
+	summary := act.Summarize(splitDistanceMeters, routeToleranceMeters)
+
+	if title == "" {
+		title = act.Name
+	}
+	if title == "" {
+		title = fmt.Sprintf("%s on %s", act.Sport, summary.StartedAt.Format("2006-01-02"))
+	}
+
+	duration := summary.DurationSeconds
+	return &store.Workout{
+		Title:           title,
+		Description:     fmt.Sprintf("Imported from %s file", act.Format),
+		DurationMinutes: int(math.Round(float64(duration) / 60)),
+		CaloriesBurned:  caloriesBurned,
+		Entries: []store.WorkoutEntry{
+			{
+				ExerciseName:    act.Sport,
+				Sets:            1,
+				DurationSeconds: &duration,
+				Notes:           fmt.Sprintf("%.2f km", summary.DistanceMeters/1000),
+				OrderIndex:      1,
+			},
+		},
+		Activity: &store.WorkoutActivity{
+			SourceFormat:        act.Format,
+			Sport:               act.Sport,
+			StartedAt:           summary.StartedAt,
+			DistanceMeters:      summary.DistanceMeters,
+			DurationSeconds:     duration,
+			ElevationGainMeters: summary.ElevationGainMeters,
+			ElevationLossMeters: summary.ElevationLossMeters,
+			AvgHeartRate:        summary.AvgHeartRate,
+			MaxHeartRate:        summary.MaxHeartRate,
+			HeartRateSamples:    heartRateSamples(summary.HeartRateSamples),
+			Splits:              activitySplits(summary.Splits),
+			Route:               summary.Route,
+		},
+	}
+}
+
+func heartRateSamples(samples []activity.HeartRateSample) []store.HeartRateSample {
+	converted := make([]store.HeartRateSample, 0, len(samples))
+	for _, s := range samples {
+		converted = append(converted, store.HeartRateSample{OffsetSeconds: s.OffsetSeconds, BPM: s.BPM})
+	}
+	return converted
+}
+
+func activitySplits(splits []activity.Split) []store.ActivitySplit {
+	converted := make([]store.ActivitySplit, 0, len(splits))
+	for _, s := range splits {
+		converted = append(converted, store.ActivitySplit{
+			Index:               s.Index,
+			DistanceMeters:      s.DistanceMeters,
+			DurationSeconds:     s.DurationSeconds,
+			ElevationGainMeters: s.ElevationGainMeters,
+			AvgHeartRate:        s.AvgHeartRate,
+		})
+	}
+	return converted
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// readWorkoutFilter builds the current user's filter from the from, to, tag
+// and tag_mode query parameters. tag can be repeated; with tag_mode=all a
+// workout needs every tag, with any (the default) one of them is enough.
+func readWorkoutFilter(r *http.Request) (store.WorkoutFilter, error) {
+	var err error
+	filter := store.WorkoutFilter{UserID: middleware.GetUser(r).ID}
+
+	filter.From, err = utils.ReadTimeParam(r, "from", false)
+	if err != nil {
+		return filter, err
+	}
+	filter.To, err = utils.ReadTimeParam(r, "to", true)
+	if err != nil {
+		return filter, err
+	}
+
+	query := r.URL.Query()
+	for _, value := range query["tag"] {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 1 {
+			return filter, errors.New("invalid tag parameter, expected a tag ID")
+		}
+		filter.TagIDs = append(filter.TagIDs, id)
+	}
+
+	switch query.Get("tag_mode") {
+	case "", "any":
+	case "all":
+		filter.MatchAllTags = true
+	default:
+		return filter, errors.New("tag_mode must be any or all")
+	}
+
+	return filter, nil
+}
+
+// HandleListWorkouts lists the user's workouts, newest first:
+// GET /workouts?from=&to=&tag=&tag_mode=&limit=&offset=
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := utils.ReadIntParam(r, "limit", defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := utils.ReadIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	workouts, err := wh.workoutStore.ListWorkouts(filter, limit, offset)
+	if err != nil {
+		wh.logger.Println("ERROR: listWorkouts:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+}
+
+// HandleWorkoutStats sums up the workouts matching the same filters as
+// GET /workouts, broken down by tag.
+func (wh *WorkoutHandler) HandleWorkoutStats(w http.ResponseWriter, r *http.Request) {
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	stats, err := wh.workoutStore.GetWorkoutStats(filter)
+	if err != nil {
+		wh.logger.Println("ERROR: getWorkoutStats:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"stats": stats})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWorkoutFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    store.WorkoutFilter
+		wantErr bool
+	}{
+		{name: "no filters", query: "", want: store.WorkoutFilter{UserID: 3}},
+		{name: "any tag", query: "tag=4&tag=9", want: store.WorkoutFilter{UserID: 3, TagIDs: []int64{4, 9}}},
+		{name: "all tags", query: "tag=4&tag_mode=all", want: store.WorkoutFilter{UserID: 3, TagIDs: []int64{4}, MatchAllTags: true}},
+		{name: "bad tag", query: "tag=legs", wantErr: true},
+		{name: "bad mode", query: "tag=4&tag_mode=some", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/workouts?"+tt.query, nil)
+			r = middleware.SetUser(r, &store.User{ID: 3})
+
+			filter, err := readWorkoutFilter(r)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	assert.Equal(t, "", validateTag(&store.Tag{Name: "Legs", Color: "#1e90ff"}))
+	assert.Equal(t, "name is required", validateTag(&store.Tag{Color: "#1e90ff"}))
+	assert.NotEqual(t, "", validateTag(&store.Tag{Name: "Legs", Color: "blue"}))
+	assert.NotEqual(t, "", validateTag(&store.Tag{Name: string(make([]rune, 51)), Color: "#1e90ff"}))
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Anezz12/femProject/internal/jsonpatch"
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const maxPatchBytes = 1 << 20
+
+// patchableWorkout is the document PATCH requests are applied to. Entries
+// and groups are matched to stored rows by their "id", so a patch that
+// removes or moves one array element only touches that row.
+type patchableWorkout struct {
+	Title           string               `json:"title"`
+	Description     string               `json:"description"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	CaloriesBurned  int                  `json:"calories_burned"`
+	Visibility      string               `json:"visibility"`
+	Groups          []store.EntryGroup   `json:"groups"`
+	Entries         []store.WorkoutEntry `json:"entries"`
+}
+
+// HandlePatchWorkout applies a JSON Merge Patch (RFC 7396) or a JSON Patch
+// (RFC 6902) to a workout, chosen by the request Content-Type. New entries
+// are those without an id, and those a JSON Patch adds or copies; entries
+// left out of the result are deleted.
+func (wh *WorkoutHandler) HandlePatchWorkout(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != jsonpatch.MergePatchContentType && mediaType != jsonpatch.JSONPatchContentType) {
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchContentType+", "+jsonpatch.JSONPatchContentType)
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "Content-Type must be " + jsonpatch.MergePatchContentType + " or " + jsonpatch.JSONPatchContentType})
+		return
+	}
+
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+	if err != nil {
+		wh.logger.Println("ERROR: readPatch:", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	doc, err := json.Marshal(patchableWorkout{
+		Title:           workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		Visibility:      workout.Visibility,
+		Groups:          nonNilGroups(workout.Groups),
+		Entries:         nonNilEntries(workout.Entries),
+	})
+	if err != nil {
+		wh.logger.Println("ERROR: marshalWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if mediaType == jsonpatch.MergePatchContentType {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		// added and copied entries and groups are new ones
+		doc, err = jsonpatch.Apply(doc, patch,
+			jsonpatch.Identity{Array: "/entries", Key: "id"},
+			jsonpatch.Identity{Array: "/groups", Key: "id"},
+		)
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var patched patchableWorkout
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&patched)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "patched workout is invalid: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(patched.Title) == "" {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "title is required"})
+		return
+	}
+	if !store.ValidVisibility(patched.Visibility) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": visibilityError})
+		return
+	}
+	for i := range patched.Entries {
+		if msg := validateEntry(&patched.Entries[i]); msg != "" {
+			utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "entries/" + strconv.Itoa(i) + ": " + msg})
+			return
+		}
+	}
+
+	workout.Title = patched.Title
+	workout.Description = patched.Description
+	workout.DurationMinutes = patched.DurationMinutes
+	workout.CaloriesBurned = patched.CaloriesBurned
+	workout.Visibility = patched.Visibility
+	workout.Groups = patched.Groups
+	workout.Entries = patched.Entries
+	renumberEntries(workout.Entries)
+	err = store.CheckEntryGroups(workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = wh.workoutStore.PatchWorkout(workout, middleware.GetUser(r).ID)
+	if writeVersionConflict(w, r, err) {
+		return
+	}
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "entries may only reference existing entry ids of this workout"})
+		return
+	}
+	if errors.Is(err, store.ErrInvalidEntryGroups) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: patchWorkout:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	patchedWorkout, err := wh.workoutStore.GetWorkoutByID(int64(workout.ID))
+	if err != nil {
+		wh.logger.Println("ERROR: getWorkoutByID:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(patchedWorkout))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": patchedWorkout})
+}
+
+func nonNilEntries(entries []store.WorkoutEntry) []store.WorkoutEntry {
+	if entries == nil {
+		return []store.WorkoutEntry{}
+	}
+	return entries
+}
+
+func nonNilGroups(groups []store.EntryGroup) []store.EntryGroup {
+	if groups == nil {
+		return []store.EntryGroup{}
+	}
+	return groups
+}
+
+// renumberEntries makes order_index follow the array order when a patch
+// moved or inserted elements. If the order already agrees, the indexes are
+// left alone so unchanged entries are not rewritten.
+func renumberEntries(entries []store.WorkoutEntry) {
+	inOrder := sort.SliceIsSorted(entries, func(i, j int) bool {
+		return entries[i].OrderIndex < entries[j].OrderIndex
+	})
+	if inOrder {
+		return
+	}
+	for i := range entries {
+		entries[i].OrderIndex = i + 1
+	}
+}
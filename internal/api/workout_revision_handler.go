@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+	"github.com/go-chi/chi"
+)
+
+type revisionSummary struct {
+	Revision  int                 `json:"revision"`
+	AuthorID  *int                `json:"author_id"`
+	CreatedAt time.Time           `json:"created_at"`
+	Changes   []store.FieldChange `json:"changes"`
+}
+
+// HandleListRevisions lists every revision with the changes it made
+// relative to the one before. With ?from=N&to=M it instead returns the diff
+// between those two revisions.
+func (wh *WorkoutHandler) HandleListRevisions(w http.ResponseWriter, r *http.Request) {
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := wh.workoutStore.ListRevisions(int64(workout.ID))
+	if err != nil {
+		wh.logger.Println("ERROR: listRevisions:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") != "" || query.Get("to") != "" {
+		from, errFrom := strconv.Atoi(query.Get("from"))
+		to, errTo := strconv.Atoi(query.Get("to"))
+		if errFrom != nil || errTo != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from and to must both be revision numbers"})
+			return
+		}
+
+		var a, b *store.WorkoutRevision
+		for _, rev := range revisions {
+			if rev.Revision == from {
+				a = rev
+			}
+			if rev.Revision == to {
+				b = rev
+			}
+		}
+		if a == nil || b == nil {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "revision not found"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+			"from":    from,
+			"to":      to,
+			"changes": store.DiffSnapshots(a.Snapshot, b.Snapshot),
+		})
+		return
+	}
+
+	summaries := make([]revisionSummary, 0, len(revisions))
+	previous := store.WorkoutSnapshot{Entries: []store.EntrySnapshot{}}
+	for _, rev := range revisions {
+		summaries = append(summaries, revisionSummary{
+			Revision:  rev.Revision,
+			AuthorID:  rev.AuthorID,
+			CreatedAt: rev.CreatedAt,
+			Changes:   store.DiffSnapshots(previous, rev.Snapshot),
+		})
+		previous = rev.Snapshot
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revisions": summaries})
+}
+
+// HandleRestoreRevision rolls the workout back to an earlier revision. The
+// rollback is itself recorded as a new revision, so it can be undone.
+func (wh *WorkoutHandler) HandleRestoreRevision(w http.ResponseWriter, r *http.Request) {
+	revisionNumber, err := strconv.Atoi(chi.URLParam(r, "rev"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid revision parameter"})
+		return
+	}
+
+	workout, ok := wh.loadOwnedWorkout(w, r)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(w, r, workout) {
+		return
+	}
+
+	revision, err := wh.workoutStore.GetRevision(int64(workout.ID), revisionNumber)
+	if err != nil {
+		wh.logger.Println("ERROR: getRevision:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if revision == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "revision not found"})
+		return
+	}
+
+	revision.Snapshot.Apply(workout)
+	err = wh.workoutStore.UpdateWorkout(workout, middleware.GetUser(r).ID)
+	if writeVersionConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		wh.logger.Println("ERROR: restoreRevision:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	restored, err := wh.workoutStore.GetWorkoutByID(int64(workout.ID))
+	if err != nil {
+		wh.logger.Println("ERROR: getWorkoutByID:", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(restored))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": restored})
+}
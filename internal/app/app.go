@@ -1,27 +1,62 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/Anezz12/femProject/internal/api"
+	"github.com/Anezz12/femProject/internal/jobs"
+	"github.com/Anezz12/femProject/internal/live"
 	"github.com/Anezz12/femProject/internal/middleware"
+	"github.com/Anezz12/femProject/internal/outbox"
+	"github.com/Anezz12/femProject/internal/scheduler"
 	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/webhook"
 	migrations "github.com/Anezz12/femProject/migration"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DB             *sql.DB
+	Logger           *log.Logger
+	WorkoutHandler   *api.WorkoutHandler
+	UserHandler      *api.UserHandler
+	TokenHandler     *api.TokenHandler
+	AccountHandler   *api.AccountHandler
+	TagHandler       *api.TagHandler
+	LiveHandler      *api.LiveSessionHandler
+	EventHandler     *api.EventHandler
+	WebhookHandler   *api.WebhookHandler
+	JobHandler       *api.JobHandler
+	StatsHandler     *api.StatsHandler
+	FollowHandler    *api.FollowHandler
+	CommentHandler   *api.CommentHandler
+	ShareHandler     *api.ShareHandler
+	Middleware       middleware.UserMiddleware
+	Idempotency      *middleware.IdempotencyMiddleware
+	WorkoutStore     store.WorkoutStore
+	IdempotencyStore store.IdempotencyStore
+	TokenStore       store.TokenStore
+	AccountStore     store.AccountStore
+	JobStore         store.JobStore
+	SchedulerStore   store.SchedulerStore
+	ShareStore       store.ShareStore
+	LiveHub          *live.Hub
+	Webhooks         *webhook.Worker
+	Events           *outbox.Bus
+	Outbox           *outbox.Dispatcher
+	Jobs             *jobs.Pool
+	Scheduler        *scheduler.Scheduler
+	DB               *sql.DB
 }
 
+// IdempotencyWindow is how long a response stored for an Idempotency-Key
+// is replayed to retries.
+const IdempotencyWindow = 24 * time.Hour
+
 func NewApplication() (*Application, error) {
 	pgDB, err := store.Open()
 	if err != nil {
@@ -39,20 +74,79 @@ func NewApplication() (*Application, error) {
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	accountStore := store.NewPostgresAccountStore(pgDB)
+	idempotencyStore := store.NewPostgresIdempotencyStore(pgDB)
+	tagStore := store.NewPostgresTagStore(pgDB)
+	liveSessionStore := store.NewPostgresLiveSessionStore(pgDB)
+	activityStore := store.NewPostgresActivityStore(pgDB)
+	webhookStore := store.NewPostgresWebhookStore(pgDB)
+	outboxStore := store.NewPostgresOutboxStore(pgDB)
+	jobStore := store.NewPostgresJobStore(pgDB)
+	schedulerStore := store.NewPostgresSchedulerStore(pgDB)
+	followStore := store.NewPostgresFollowStore(pgDB)
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	shareStore := store.NewPostgresShareStore(pgDB)
 
 	// our handlers would be initialized here
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	workoutHandler := api.NewWorkoutHandler(workoutStore, followStore, logger)
 	userHandler := api.NewUserHandler(userStore, logger)
 	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	accountHandler := api.NewAccountHandler(accountStore, logger)
+	tagHandler := api.NewTagHandler(tagStore, logger)
+	liveHub := live.NewHub(store.NewPostgresNotifier(pgDB), logger)
+	liveHandler := api.NewLiveSessionHandler(liveSessionStore, workoutStore, liveHub, logger)
+	eventHandler := api.NewEventHandler(activityStore, logger)
+	webhookHandler := api.NewWebhookHandler(webhookStore, logger)
+	jobHandler := api.NewJobHandler(jobStore, logger)
+	statsHandler := api.NewStatsHandler(schedulerStore, logger)
+	followHandler := api.NewFollowHandler(followStore, logger)
+	commentHandler := api.NewCommentHandler(commentStore, workoutStore, followStore, logger)
+	shareHandler := api.NewShareHandler(shareStore, workoutStore, followStore, logger)
 	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	idempotencyMiddleware := &middleware.IdempotencyMiddleware{
+		Store:  idempotencyStore,
+		Window: IdempotencyWindow,
+		Logger: logger,
+	}
+
+	// in-process consumers subscribe to events here
+	events := outbox.NewBus()
+
+	// job handlers are registered here
+	jobPool := jobs.NewPool(jobStore, logger)
+	jobs.Handle(jobPool, store.JobBuildDataExport, accountHandler.BuildDataExport)
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middlewareHandler,
-		DB:             pgDB,
+		Logger:           logger,
+		WorkoutHandler:   workoutHandler,
+		UserHandler:      userHandler,
+		TokenHandler:     tokenHandler,
+		AccountHandler:   accountHandler,
+		TagHandler:       tagHandler,
+		LiveHandler:      liveHandler,
+		EventHandler:     eventHandler,
+		WebhookHandler:   webhookHandler,
+		JobHandler:       jobHandler,
+		StatsHandler:     statsHandler,
+		FollowHandler:    followHandler,
+		CommentHandler:   commentHandler,
+		ShareHandler:     shareHandler,
+		Middleware:       middlewareHandler,
+		Idempotency:      idempotencyMiddleware,
+		WorkoutStore:     workoutStore,
+		IdempotencyStore: idempotencyStore,
+		TokenStore:       tokenStore,
+		AccountStore:     accountStore,
+		JobStore:         jobStore,
+		SchedulerStore:   schedulerStore,
+		ShareStore:       shareStore,
+		LiveHub:          liveHub,
+		Webhooks:         webhook.NewWorker(webhookStore, logger),
+		Events:           events,
+		Outbox:           outbox.NewDispatcher(outboxStore, logger, events, &webhook.Sink{Store: webhookStore}),
+		Jobs:             jobPool,
+		Scheduler:        scheduler.New(schedulerStore, logger),
+		DB:               pgDB,
 	}
 
 	return app, nil
@@ -60,5 +154,43 @@ func NewApplication() (*Application, error) {
 
 func (app *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Status is available\n")
+	fmt.Fprintln(w, "Status is available")
+}
+
+// finishedJobRetention is how long succeeded jobs stay listed.
+const finishedJobRetention = 7 * 24 * time.Hour
+
+// ScheduleMaintenance registers the periodic cleanup tasks: workouts leave
+// the trash after trashRetention.
+func (app *Application) ScheduleMaintenance(trashRetention time.Duration) {
+	app.Scheduler.Add("purge_expired_tokens", scheduler.MustParse("*/15 * * * *"), app.purgeTask("expired tokens", app.TokenStore.PurgeExpiredTokens))
+	app.Scheduler.Add("purge_trash", scheduler.MustParse("30 * * * *"), app.purgeTask("workouts from trash", func() (int64, error) {
+		return app.WorkoutStore.PurgeDeletedWorkouts(trashRetention)
+	}))
+	app.Scheduler.Add("purge_idempotency_keys", scheduler.MustParse("45 * * * *"), app.purgeTask("expired idempotency keys", func() (int64, error) {
+		return app.IdempotencyStore.PurgeIdempotencyKeys(IdempotencyWindow)
+	}))
+	app.Scheduler.Add("purge_data_exports", scheduler.MustParse("@hourly"), app.purgeTask("expired data exports", app.AccountStore.PurgeExpiredDataExports))
+	app.Scheduler.Add("purge_finished_jobs", scheduler.MustParse("0 4 * * *"), app.purgeTask("finished jobs", func() (int64, error) {
+		return app.JobStore.PurgeFinishedJobs(finishedJobRetention)
+	}))
+	app.Scheduler.Add("purge_workout_shares", scheduler.MustParse("15 4 * * *"), app.purgeTask("expired or revoked share links", app.ShareStore.PurgeExpiredShares))
+	app.Scheduler.Add("refresh_daily_stats", scheduler.MustParse("*/10 * * * *"), func(ctx context.Context) error {
+		return app.SchedulerStore.RefreshDailyStats()
+	})
+}
+
+// purgeTask wraps a store purge as a scheduled task that logs how many
+// rows it removed.
+func (app *Application) purgeTask(what string, purge func() (int64, error)) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := purge()
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			app.Logger.Printf("INFO: purged %d %s", purged, what)
+		}
+		return nil
+	}
 }
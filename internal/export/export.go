@@ -0,0 +1,209 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// Version is bumped whenever a column is added, removed or changes meaning,
+// so consumers can detect layout changes from the response headers.
+const Version = 1
+
+const (
+	GranularityEntry = "entry"
+	GranularitySet   = "set"
+)
+
+var entryColumns = []string{
+	"workout_id",
+	"workout_title",
+	"workout_description",
+	"workout_date",
+	"duration_minutes",
+	"calories_burned",
+	"entry_id",
+	"order_index",
+	"exercise_name",
+	"sets",
+	"reps",
+	"duration_seconds",
+	"weight",
+	"notes",
+}
+
+var setColumns = []string{
+	"workout_id",
+	"workout_title",
+	"workout_description",
+	"workout_date",
+	"duration_minutes",
+	"calories_burned",
+	"entry_id",
+	"order_index",
+	"exercise_name",
+	"set_number",
+	"reps",
+	"duration_seconds",
+	"weight",
+	"notes",
+}
+
+// Writer receives rows in column order. Values are nil, int, float64,
+// string or time.Time.
+type Writer interface {
+	WriteRow(row []any) error
+	Flush() error
+	Close() error
+}
+
+type format struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer, columns []string) (Writer, error)
+}
+
+var formats = map[string]format{
+	"csv":    {"text/csv; charset=utf-8", "csv", newCSVWriter},
+	"json":   {"application/json", "json", newJSONWriter},
+	"ndjson": {"application/x-ndjson", "ndjson", newNDJSONWriter},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", newXLSXWriter},
+}
+
+type Exporter struct {
+	Columns     []string
+	ContentType string
+	Extension   string
+	format      format
+	granularity string
+	writer      Writer
+}
+
+func New(formatName, granularity string) (*Exporter, error) {
+	f, ok := formats[formatName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export format %q", formatName)
+	}
+
+	var columns []string
+	switch granularity {
+	case GranularityEntry, "":
+		granularity = GranularityEntry
+		columns = entryColumns
+	case GranularitySet:
+		columns = setColumns
+	default:
+		return nil, fmt.Errorf("unsupported granularity %q", granularity)
+	}
+
+	return &Exporter{
+		Columns:     columns,
+		ContentType: f.contentType,
+		Extension:   f.extension,
+		format:      f,
+		granularity: granularity,
+	}, nil
+}
+
+// Start writes any preamble (CSV header, JSON array opening, workbook
+// parts). It is split from New so callers can set headers first.
+func (e *Exporter) Start(w io.Writer) error {
+	writer, err := e.format.newWriter(w, e.Columns)
+	if err != nil {
+		return err
+	}
+	e.writer = writer
+	return nil
+}
+
+func (e *Exporter) WriteWorkout(workout *store.Workout) error {
+	for _, row := range e.rows(workout) {
+		err := e.writer.WriteRow(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush pushes buffered rows to the underlying writer so clients see
+// progress while a long export is still running.
+func (e *Exporter) Flush() error {
+	return e.writer.Flush()
+}
+
+func (e *Exporter) Close() error {
+	return e.writer.Close()
+}
+
+func (e *Exporter) rows(workout *store.Workout) [][]any {
+	base := []any{
+		workout.ID,
+		workout.Title,
+		workout.Description,
+		workout.CreatedAt,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+	}
+
+	// workouts without entries still get a row so they aren't lost
+	if len(workout.Entries) == 0 {
+		row := append(append([]any{}, base...), make([]any, len(e.Columns)-len(base))...)
+		return [][]any{row}
+	}
+
+	var rows [][]any
+	for _, entry := range workout.Entries {
+		entryFields := func(count int) []any {
+			row := append([]any{}, base...)
+			return append(row,
+				entry.ID,
+				entry.OrderIndex,
+				entry.ExerciseName,
+				count,
+				intOrNil(entry.Reps),
+				intOrNil(entry.DurationSeconds),
+				floatOrNil(entry.Weight),
+				entry.Notes,
+			)
+		}
+
+		if e.granularity == GranularityEntry {
+			rows = append(rows, entryFields(entry.Sets))
+			continue
+		}
+		for set := 1; set <= entry.Sets; set++ {
+			rows = append(rows, entryFields(set))
+		}
+	}
+	return rows
+}
+
+func intOrNil(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func floatOrNil(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return fmt.Sprintf("%g", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
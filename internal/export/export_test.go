@@ -0,0 +1,106 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWorkout() *store.Workout {
+	reps := 5
+	weight := 100.0
+	seconds := 60
+	return &store.Workout{
+		ID:              7,
+		Title:           "leg day",
+		DurationMinutes: 45,
+		CreatedAt:       time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC),
+		Entries: []store.WorkoutEntry{
+			{ID: 1, ExerciseName: "Squat", Sets: 3, Reps: &reps, Weight: &weight, OrderIndex: 1},
+			{ID: 2, ExerciseName: "Plank", Sets: 1, DurationSeconds: &seconds, OrderIndex: 2},
+		},
+	}
+}
+
+func runExport(t *testing.T, format, granularity string, workouts ...*store.Workout) []byte {
+	var buf bytes.Buffer
+	exporter, err := New(format, granularity)
+	require.NoError(t, err)
+	require.NoError(t, exporter.Start(&buf))
+	for _, w := range workouts {
+		require.NoError(t, exporter.WriteWorkout(w))
+	}
+	require.NoError(t, exporter.Close())
+	return buf.Bytes()
+}
+
+func TestExportCSVPerSet(t *testing.T) {
+	out := runExport(t, "csv", GranularitySet, testWorkout())
+
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, records, 5)
+	assert.Equal(t, setColumns, records[0])
+	assert.Equal(t, []string{"7", "leg day", "", "2025-02-01T09:00:00Z", "45", "0", "1", "1", "Squat", "3", "5", "", "100", ""}, records[3])
+	assert.Equal(t, "60", records[4][11])
+}
+
+func TestExportJSONAndNDJSON(t *testing.T) {
+	empty := &store.Workout{ID: 8, Title: "rest day", CreatedAt: time.Now()}
+
+	var rows []map[string]any
+	out := runExport(t, "json", GranularityEntry, testWorkout(), empty)
+	require.NoError(t, json.Unmarshal(out, &rows))
+	require.Len(t, rows, 3)
+	assert.Equal(t, "Squat", rows[0]["exercise_name"])
+	assert.Nil(t, rows[2]["entry_id"])
+
+	out = runExport(t, "ndjson", GranularityEntry, testWorkout())
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	lines := 0
+	for scanner.Scan() {
+		var row map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestExportXLSX(t *testing.T) {
+	out := runExport(t, "xlsx", GranularityEntry, testWorkout())
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			sheet, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+	}
+	require.NotNil(t, sheet)
+	assert.Equal(t, 3, bytes.Count(sheet, []byte("<row>")))
+	assert.Contains(t, string(sheet), "<c><v>100</v></c>")
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	_, err := New("pdf", "")
+	assert.Error(t, err)
+
+	_, err = New("csv", "rep")
+	assert.Error(t, err)
+}
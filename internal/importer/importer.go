@@ -0,0 +1,298 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+type RowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+type Result struct {
+	Rows      int              `json:"rows"`
+	Workouts  []*store.Workout `json:"workouts"`
+	Errors    []RowError       `json:"errors"`
+	Unmatched []string         `json:"unmatched_exercises"`
+}
+
+type set struct {
+	exercise string
+	weight   *float64
+	reps     *int
+	seconds  *int
+	notes    string
+}
+
+// Parse reads a CSV export and groups its rows into workouts. Rows that fail
+// to parse are reported in Result.Errors and left out; an error is returned
+// only when the file as a whole can't be read with the given mapping.
+func Parse(r io.Reader, m Mapping, matcher *Matcher) (*Result, error) {
+	err := m.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if m.Delimiter != "" {
+		reader.Comma = []rune(m.Delimiter)[0]
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, required := range []string{m.Date, m.Exercise} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("column %q not found in header", required)
+		}
+	}
+
+	result := &Result{Errors: []RowError{}, Unmatched: []string{}}
+	workouts := map[string]*store.Workout{}
+	unmatched := map[string]bool{}
+	rowNumber := 1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		rowNumber++
+		if err != nil {
+			result.Errors = append(result.Errors, RowError{Row: rowNumber, Message: err.Error()})
+			continue
+		}
+		result.Rows++
+
+		field := func(column string) string {
+			i, ok := columns[column]
+			if column == "" || !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		fail := func(column, format string, args ...any) {
+			result.Errors = append(result.Errors, RowError{Row: rowNumber, Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+
+		date, err := parseDate(field(m.Date), m.DateLayout)
+		if err != nil {
+			fail(m.Date, "invalid date %q", field(m.Date))
+			continue
+		}
+
+		s, err := parseSet(field, m)
+		if err != nil {
+			var colErr *columnError
+			if errors.As(err, &colErr) {
+				fail(colErr.column, "%s", colErr.message)
+			} else {
+				fail("", "%s", err.Error())
+			}
+			continue
+		}
+
+		name, ok := matcher.Match(s.exercise)
+		if !ok {
+			unmatched[name] = true
+		}
+		s.exercise = name
+
+		title := field(m.WorkoutName)
+		key := date.Format(time.RFC3339) + "|" + title
+		workout, ok := workouts[key]
+		if !ok {
+			if title == "" {
+				title = "Imported workout"
+			}
+			workout = &store.Workout{
+				Title:       title,
+				Description: field(m.WorkoutNotes),
+				CreatedAt:   date,
+			}
+			workout.DurationMinutes = parseWorkoutDuration(field(m.WorkoutDuration), field(m.EndDate), date, m.DateLayout)
+			workouts[key] = workout
+			result.Workouts = append(result.Workouts, workout)
+		}
+		addSet(workout, s)
+	}
+
+	for name := range unmatched {
+		result.Unmatched = append(result.Unmatched, name)
+	}
+	sort.Strings(result.Unmatched)
+
+	return result, nil
+}
+
+type columnError struct {
+	column  string
+	message string
+}
+
+func (e *columnError) Error() string {
+	return e.column + ": " + e.message
+}
+
+func parseSet(field func(string) string, m Mapping) (set, error) {
+	s := set{
+		exercise: field(m.Exercise),
+		notes:    field(m.Notes),
+	}
+	if s.exercise == "" {
+		return s, &columnError{m.Exercise, "exercise name is empty"}
+	}
+
+	if value := field(m.Weight); value != "" {
+		weight, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return s, &columnError{m.Weight, fmt.Sprintf("invalid weight %q", value)}
+		}
+		if weight != 0 {
+			s.weight = &weight
+		}
+	}
+
+	if value := field(m.Reps); value != "" {
+		reps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return s, &columnError{m.Reps, fmt.Sprintf("invalid reps %q", value)}
+		}
+		if reps > 0 {
+			n := int(reps)
+			s.reps = &n
+		}
+	}
+
+	// the database allows reps or a duration, never both
+	if value := field(m.Seconds); value != "" && s.reps == nil {
+		seconds, err := parseSeconds(value)
+		if err != nil {
+			return s, &columnError{m.Seconds, fmt.Sprintf("invalid duration %q", value)}
+		}
+		if seconds > 0 {
+			s.seconds = &seconds
+		}
+	}
+
+	if s.reps == nil && s.seconds == nil {
+		return s, errors.New("row has neither reps nor a duration")
+	}
+
+	return s, nil
+}
+
+// addSet appends the set to the workout, folding it into the previous entry
+// when it is the same exercise at the same reps, time and weight.
+func addSet(workout *store.Workout, s set) {
+	if n := len(workout.Entries); n > 0 {
+		last := &workout.Entries[n-1]
+		if last.ExerciseName == s.exercise &&
+			equalInt(last.Reps, s.reps) &&
+			equalInt(last.DurationSeconds, s.seconds) &&
+			equalFloat(last.Weight, s.weight) {
+			last.Sets++
+			if s.notes != "" && !strings.Contains(last.Notes, s.notes) {
+				last.Notes = strings.TrimPrefix(last.Notes+"; "+s.notes, "; ")
+			}
+			return
+		}
+	}
+
+	workout.Entries = append(workout.Entries, store.WorkoutEntry{
+		ExerciseName:    s.exercise,
+		Sets:            1,
+		Reps:            s.reps,
+		DurationSeconds: s.seconds,
+		Weight:          s.weight,
+		Notes:           s.notes,
+		OrderIndex:      len(workout.Entries) + 1,
+	})
+}
+
+func parseDate(value, layout string) (time.Time, error) {
+	layouts := []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+	if layout != "" {
+		layouts = append([]string{layout}, layouts...)
+	}
+	for _, l := range layouts {
+		t, err := time.ParseInLocation(l, value, time.UTC)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+// parseSeconds accepts plain seconds ("90") as well as clock values
+// ("1:30", "01:02:30") used by some apps.
+func parseSeconds(value string) (int, error) {
+	if !strings.Contains(value, ":") {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, err
+		}
+		return int(math.Round(f)), nil
+	}
+
+	total := 0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, err
+		}
+		total = total*60 + n
+	}
+	return total, nil
+}
+
+// parseWorkoutDuration understands "1h 5m", "45m", plain seconds, or an end
+// timestamp. Unknown durations come back as 0 minutes.
+func parseWorkoutDuration(duration, end string, start time.Time, layout string) int {
+	if duration != "" {
+		if seconds, err := strconv.Atoi(duration); err == nil {
+			return int(math.Round(float64(seconds) / 60))
+		}
+		if d, err := time.ParseDuration(strings.ReplaceAll(duration, " ", "")); err == nil {
+			return int(math.Round(d.Minutes()))
+		}
+	}
+	if end != "" {
+		if t, err := parseDate(end, layout); err == nil && t.After(start) {
+			return int(math.Round(t.Sub(start).Minutes()))
+		}
+	}
+	return 0
+}
+
+func equalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const strongCSV = `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2024-03-01 18:00:00,Push Day,1h 5m,Bench Press (Barbell),1,80,8,0,0,,felt good,
+2024-03-01 18:00:00,Push Day,1h 5m,Bench Press (Barbell),2,80,8,0,0,,felt good,
+2024-03-01 18:00:00,Push Day,1h 5m,Bench Press (Barbell),3,85,6,0,0,heavy,felt good,
+2024-03-01 18:00:00,Push Day,1h 5m,Plank,1,0,0,0,60,,felt good,
+2024-03-03 09:30:00,Leg Day,45m,Squat (Barbell),1,100,5,0,0,,,
+2024-03-03 09:30:00,Leg Day,45m,Squat (Barbell),2,abc,5,0,0,,,
+not a date,Leg Day,45m,Squat (Barbell),3,100,5,0,0,,,
+2024-03-03 09:30:00,Leg Day,45m,Zercher Carry,1,60,0,0,0,,,
+`
+
+func TestParseStrongPreset(t *testing.T) {
+	mapping, err := Preset("strong")
+	require.NoError(t, err)
+
+	result, err := Parse(strings.NewReader(strongCSV), mapping, NewMatcher([]string{"Squats"}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 8, result.Rows)
+	require.Len(t, result.Workouts, 2)
+
+	push := result.Workouts[0]
+	assert.Equal(t, "Push Day", push.Title)
+	assert.Equal(t, "felt good", push.Description)
+	assert.Equal(t, 65, push.DurationMinutes)
+	assert.Equal(t, 2024, push.CreatedAt.Year())
+	require.Len(t, push.Entries, 3)
+
+	assert.Equal(t, "Bench Press", push.Entries[0].ExerciseName)
+	assert.Equal(t, 2, push.Entries[0].Sets)
+	assert.Equal(t, 8, *push.Entries[0].Reps)
+	assert.Equal(t, 1, push.Entries[1].Sets)
+	assert.Equal(t, "heavy", push.Entries[1].Notes)
+
+	assert.Nil(t, push.Entries[2].Reps)
+	require.NotNil(t, push.Entries[2].DurationSeconds)
+	assert.Equal(t, 60, *push.Entries[2].DurationSeconds)
+	assert.Equal(t, 3, push.Entries[2].OrderIndex)
+
+	legs := result.Workouts[1]
+	assert.Equal(t, 45, legs.DurationMinutes)
+	require.Len(t, legs.Entries, 1)
+	// the user's own spelling is preferred
+	assert.Equal(t, "Squats", legs.Entries[0].ExerciseName)
+
+	require.Len(t, result.Errors, 3)
+	assert.Equal(t, 7, result.Errors[0].Row)
+	assert.Equal(t, "Weight", result.Errors[0].Column)
+	assert.Equal(t, 8, result.Errors[1].Row)
+	assert.Equal(t, "Date", result.Errors[1].Column)
+	assert.Equal(t, 9, result.Errors[2].Row)
+
+	assert.Empty(t, result.Unmatched)
+}
+
+func TestParseCustomMapping(t *testing.T) {
+	csv := "day;lift;kg;reps\n2024-05-01;Deadlifts;140;5\n2024-05-01;Farmer Walk;40;20\n"
+	mapping := Mapping{Date: "day", Exercise: "lift", Weight: "kg", Reps: "reps", Delimiter: ";"}
+
+	result, err := Parse(strings.NewReader(csv), mapping, NewMatcher(nil))
+	require.NoError(t, err)
+
+	require.Len(t, result.Workouts, 1)
+	assert.Equal(t, "Imported workout", result.Workouts[0].Title)
+	assert.Equal(t, "Deadlift", result.Workouts[0].Entries[0].ExerciseName)
+	assert.Equal(t, []string{"Farmer Walk"}, result.Unmatched)
+}
+
+func TestParseMissingColumn(t *testing.T) {
+	mapping, err := Preset("hevy")
+	require.NoError(t, err)
+
+	_, err = Parse(strings.NewReader("Date,Exercise\n"), mapping, NewMatcher(nil))
+	assert.Error(t, err)
+}
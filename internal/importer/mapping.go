@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Mapping tells the importer which CSV header holds which field. Every row
+// of the CSV is one set; rows sharing Date and WorkoutName form one workout.
+type Mapping struct {
+	Date            string `json:"date"`
+	DateLayout      string `json:"date_layout"`
+	WorkoutName     string `json:"workout_name"`
+	WorkoutNotes    string `json:"workout_notes"`
+	WorkoutDuration string `json:"workout_duration"`
+	EndDate         string `json:"end_date"`
+	Exercise        string `json:"exercise"`
+	Weight          string `json:"weight"`
+	Reps            string `json:"reps"`
+	Seconds         string `json:"seconds"`
+	Notes           string `json:"notes"`
+	Delimiter       string `json:"delimiter"`
+}
+
+var presets = map[string]Mapping{
+	"strong": {
+		Date:            "Date",
+		DateLayout:      "2006-01-02 15:04:05",
+		WorkoutName:     "Workout Name",
+		WorkoutNotes:    "Workout Notes",
+		WorkoutDuration: "Duration",
+		Exercise:        "Exercise Name",
+		Weight:          "Weight",
+		Reps:            "Reps",
+		Seconds:         "Seconds",
+		Notes:           "Notes",
+	},
+	"hevy": {
+		Date:         "start_time",
+		DateLayout:   "2 Jan 2006, 15:04",
+		EndDate:      "end_time",
+		WorkoutName:  "title",
+		WorkoutNotes: "description",
+		Exercise:     "exercise_title",
+		Weight:       "weight_kg",
+		Reps:         "reps",
+		Seconds:      "duration_seconds",
+		Notes:        "exercise_notes",
+	},
+	"fitnotes": {
+		Date:       "Date",
+		DateLayout: "2006-01-02",
+		Exercise:   "Exercise",
+		Weight:     "Weight",
+		Reps:       "Reps",
+		Seconds:    "Time",
+		Notes:      "Comment",
+	},
+}
+
+func Preset(name string) (Mapping, error) {
+	m, ok := presets[name]
+	if !ok {
+		return Mapping{}, fmt.Errorf("unknown preset %q", name)
+	}
+	return m, nil
+}
+
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Merge returns m with every non-empty field of override applied on top, so
+// callers can start from a preset and only fix the columns that differ.
+func (m Mapping) Merge(override Mapping) Mapping {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&m.Date, override.Date)
+	set(&m.DateLayout, override.DateLayout)
+	set(&m.WorkoutName, override.WorkoutName)
+	set(&m.WorkoutNotes, override.WorkoutNotes)
+	set(&m.WorkoutDuration, override.WorkoutDuration)
+	set(&m.EndDate, override.EndDate)
+	set(&m.Exercise, override.Exercise)
+	set(&m.Weight, override.Weight)
+	set(&m.Reps, override.Reps)
+	set(&m.Seconds, override.Seconds)
+	set(&m.Notes, override.Notes)
+	set(&m.Delimiter, override.Delimiter)
+	return m
+}
+
+func (m Mapping) Validate() error {
+	if m.Date == "" {
+		return fmt.Errorf("mapping: date column is required")
+	}
+	if m.Exercise == "" {
+		return fmt.Errorf("mapping: exercise column is required")
+	}
+	if m.Reps == "" && m.Seconds == "" {
+		return fmt.Errorf("mapping: reps or seconds column is required")
+	}
+	if len([]rune(m.Delimiter)) > 1 {
+		return fmt.Errorf("mapping: delimiter must be a single character")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var commonExercises = []string{
+	"Bench Press",
+	"Incline Bench Press",
+	"Squat",
+	"Front Squat",
+	"Deadlift",
+	"Romanian Deadlift",
+	"Overhead Press",
+	"Barbell Row",
+	"Pull-Up",
+	"Chin-Up",
+	"Push-Up",
+	"Dip",
+	"Lunge",
+	"Leg Press",
+	"Lat Pulldown",
+	"Bicep Curl",
+	"Tricep Extension",
+	"Plank",
+	"Running",
+	"Cycling",
+	"Rowing",
+}
+
+var exerciseAliases = map[string]string{
+	"ohp":            "Overhead Press",
+	"military press": "Overhead Press",
+	"shoulder press": "Overhead Press",
+	"bent over row":  "Barbell Row",
+	"rdl":            "Romanian Deadlift",
+	"pullup":         "Pull-Up",
+	"chinup":         "Chin-Up",
+	"pushup":         "Push-Up",
+	"back squat":     "Squat",
+}
+
+var (
+	parenthetical = regexp.MustCompile(`\([^)]*\)`)
+	nonAlnum      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Matcher maps exercise names from other apps onto names the user already
+// has in their history, falling back to a built-in list of common lifts.
+type Matcher struct {
+	known map[string]string
+}
+
+func NewMatcher(knownNames []string) *Matcher {
+	m := &Matcher{known: map[string]string{}}
+	for _, name := range commonExercises {
+		m.known[normalizeExercise(name)] = name
+	}
+	for alias, name := range exerciseAliases {
+		m.known[normalizeExercise(alias)] = name
+	}
+	// the user's own spelling wins over the built-in one
+	for _, name := range knownNames {
+		m.known[normalizeExercise(name)] = name
+	}
+	return m
+}
+
+// Match returns the canonical name and whether one was found. Unmatched
+// names are returned trimmed so they can be imported as-is.
+func (m *Matcher) Match(name string) (string, bool) {
+	canonical, ok := m.known[normalizeExercise(name)]
+	if !ok {
+		return strings.TrimSpace(name), false
+	}
+	return canonical, true
+}
+
+// normalizeExercise lowercases, drops equipment suffixes like "(Barbell)",
+// strips punctuation and plural "s" so "Squats" and "Squat (Barbell)" agree.
+func normalizeExercise(name string) string {
+	name = strings.ToLower(name)
+	name = parenthetical.ReplaceAllString(name, " ")
+	name = nonAlnum.ReplaceAllString(name, " ")
+
+	words := strings.Fields(name)
+	for i, w := range words {
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			words[i] = strings.TrimSuffix(w, "s")
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,213 @@
+// Package jobs runs the background jobs queued in the store.
+//
+// Handlers are registered per job type with Handle. A handler's error
+// schedules another attempt after a backoff, until the job's attempts run
+// out and it is dead; Permanent errors make it dead right away. Jobs may
+// run more than once, for instance when a worker dies mid-job, so handlers
+// must be safe to repeat.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+const (
+	// baseBackoff doubles after every failed attempt, up to maxBackoff.
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+	// leaseMargin is added to Timeout for the claim, so a job is never
+	// claimed again while it may still be running.
+	leaseMargin = 30 * time.Second
+)
+
+// Handler runs a job.
+type Handler func(ctx context.Context, job *store.Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Handle registers fn for jobs of jobType, decoding their args into T.
+// Args that don't decode make the job dead.
+func Handle[T any](p *Pool, jobType string, fn func(ctx context.Context, job *store.Job, args T) error) {
+	p.handlers[jobType] = func(ctx context.Context, job *store.Job) error {
+		var args T
+		err := json.Unmarshal(job.Args, &args)
+		if err != nil {
+			return Permanent(fmt.Errorf("decoding args: %w", err))
+		}
+		return fn(ctx, job, args)
+	}
+}
+
+// Enqueue queues a job of jobType with args, to run at runAt or right away
+// when that is zero.
+func Enqueue(jobStore store.JobStore, jobType string, args any, runAt time.Time) (*store.Job, error) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	job := &store.Job{Type: jobType, Args: body, RunAt: runAt}
+	err = jobStore.EnqueueJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Backoff is the wait after the given number of failed attempts, with up
+// to 20% jitter.
+func Backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		wait = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	return wait - time.Duration(rand.Int64N(int64(wait/5)+1))
+}
+
+// Pool runs up to Concurrency jobs at a time, of the types it has handlers
+// for. Pools in other processes can share the store.
+type Pool struct {
+	Store       store.JobStore
+	Logger      *log.Logger
+	Concurrency int
+	// Interval is how often the queue is checked while idle.
+	Interval time.Duration
+	// Timeout bounds a single run of a job.
+	Timeout time.Duration
+	// ShutdownTimeout is how long Run waits for running jobs once its
+	// context is done, before canceling them.
+	ShutdownTimeout time.Duration
+
+	handlers map[string]Handler
+}
+
+func NewPool(jobStore store.JobStore, logger *log.Logger) *Pool {
+	return &Pool{
+		Store:           jobStore,
+		Logger:          logger,
+		Concurrency:     4,
+		Interval:        2 * time.Second,
+		Timeout:         5 * time.Minute,
+		ShutdownTimeout: 20 * time.Second,
+		handlers:        map[string]Handler{},
+	}
+}
+
+// Run works the queue until ctx is done, then stops claiming jobs and
+// returns once the running ones have finished.
+func (p *Pool) Run(ctx context.Context) {
+	types := make([]string, 0, len(p.handlers))
+	for jobType := range p.handlers {
+		types = append(types, jobType)
+	}
+	slices.Sort(types)
+
+	// running jobs outlive ctx, up to ShutdownTimeout
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	finished := make(chan struct{}, p.Concurrency)
+	running := 0
+	for ctx.Err() == nil {
+		if free := p.Concurrency - running; free > 0 && len(types) > 0 {
+			jobs, err := p.Store.ClaimJobs(types, free, p.Timeout+leaseMargin)
+			if err != nil {
+				p.Logger.Println("ERROR: claimJobs:", err)
+			}
+			for _, job := range jobs {
+				running++
+				go func() {
+					defer func() { finished <- struct{}{} }()
+					p.run(jobCtx, job)
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		case <-finished:
+			running--
+		}
+	}
+
+	timeout := time.After(p.ShutdownTimeout)
+	for running > 0 {
+		select {
+		case <-finished:
+			running--
+		case <-timeout:
+			p.Logger.Printf("INFO: canceling %d running jobs", running)
+			cancelJobs()
+		}
+	}
+}
+
+// run makes one attempt at the job and records its outcome.
+func (p *Pool) run(ctx context.Context, job *store.Job) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	err := p.call(ctx, job)
+	if err == nil {
+		err = p.Store.CompleteJob(job.ID)
+		if err != nil {
+			p.Logger.Printf("ERROR: completeJob %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	var runAt *time.Time
+	var permanent *permanentError
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanent) {
+		at := time.Now().Add(Backoff(job.Attempts))
+		runAt = &at
+	}
+	p.Logger.Printf("ERROR: job %d (%s) attempt %d: %v", job.ID, job.Type, job.Attempts, err)
+
+	err = p.Store.FailJob(job, err.Error(), runAt)
+	if err != nil {
+		// the lease runs out and the job is claimed again
+		p.Logger.Printf("ERROR: failJob %d: %v", job.ID, err)
+		return
+	}
+	if job.Status == store.JobDead {
+		p.Logger.Printf("INFO: job %d (%s) is dead after %d attempts", job.ID, job.Type, job.Attempts)
+	}
+}
+
+// call runs the job's handler, turning a panic into an error.
+func (p *Pool) call(ctx context.Context, job *store.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	handler, ok := p.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %q", job.Type))
+	}
+	return handler(ctx, job)
+}
@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryJobStore struct {
+	store.JobStore
+
+	mu   sync.Mutex
+	jobs []*store.Job
+}
+
+func (m *memoryJobStore) EnqueueJob(job *store.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.ID = int64(len(m.jobs) + 1)
+	job.Status = store.JobPending
+	job.MaxAttempts = cmp.Or(job.MaxAttempts, store.DefaultJobMaxAttempts)
+	if job.Args == nil {
+		job.Args = json.RawMessage(`{}`)
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	m.jobs = append(m.jobs, job)
+	return nil
+}
+
+func (m *memoryJobStore) ClaimJobs(types []string, limit int, lease time.Duration) ([]*store.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	claimed := []*store.Job{}
+	for _, job := range m.jobs {
+		if len(claimed) < limit && job.Status == store.JobPending && !job.RunAt.After(time.Now()) && slices.Contains(types, job.Type) {
+			job.Status = store.JobRunning
+			job.Attempts++
+			claimed = append(claimed, job)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryJobStore) CompleteJob(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[id-1].Status = store.JobSucceeded
+	return nil
+}
+
+func (m *memoryJobStore) FailJob(job *store.Job, reason string, runAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.LastError = &reason
+	job.Status = store.JobDead
+	if runAt != nil {
+		job.Status = store.JobPending
+		job.RunAt = *runAt
+	}
+	return nil
+}
+
+func (m *memoryJobStore) get(id int64) store.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.jobs[id-1]
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func newTestPool(memory *memoryJobStore) *Pool {
+	p := NewPool(memory, log.New(io.Discard, "", 0))
+	p.Interval = 5 * time.Millisecond
+	return p
+}
+
+func TestPoolRunsJobs(t *testing.T) {
+	memory := &memoryJobStore{}
+	p := newTestPool(memory)
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	Handle(p, "greet", func(ctx context.Context, job *store.Job, args greeting) error {
+		mu.Lock()
+		defer mu.Unlock()
+		names = append(names, args.Name)
+		switch args.Name {
+		case "flaky":
+			return errors.New("try again")
+		case "broken":
+			return Permanent(errors.New("never works"))
+		case "panicky":
+			panic("oops")
+		}
+		return nil
+	})
+
+	for _, name := range []string{"ada", "flaky", "broken", "panicky"} {
+		_, err := Enqueue(memory, "greet", greeting{Name: name}, time.Time{})
+		require.NoError(t, err)
+	}
+	later, err := Enqueue(memory, "greet", greeting{Name: "later"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, memory.EnqueueJob(&store.Job{Type: "greet", Args: json.RawMessage(`"not an object"`)}))
+	require.NoError(t, memory.EnqueueJob(&store.Job{Type: "unknown"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return memory.get(6).Status == store.JobDead
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, store.JobSucceeded, memory.get(1).Status)
+
+	flaky := memory.get(2)
+	assert.Equal(t, store.JobPending, flaky.Status)
+	assert.Equal(t, "try again", *flaky.LastError)
+	assert.WithinDuration(t, time.Now().Add(baseBackoff), flaky.RunAt, baseBackoff/5+time.Second)
+
+	assert.Equal(t, store.JobDead, memory.get(3).Status)
+	assert.Equal(t, 1, memory.get(3).Attempts)
+	assert.Equal(t, store.JobPending, memory.get(4).Status)
+	assert.Equal(t, "panic: oops", *memory.get(4).LastError)
+	assert.Equal(t, 0, memory.get(later.ID).Attempts, "delayed jobs wait for their time")
+	assert.Contains(t, *memory.get(6).LastError, "decoding args")
+	assert.Equal(t, store.JobPending, memory.get(7).Status, "other pools may handle unknown types")
+	assert.ElementsMatch(t, []string{"ada", "flaky", "broken", "panicky"}, names)
+}
+
+func TestPoolMakesJobsDeadAfterMaxAttempts(t *testing.T) {
+	memory := &memoryJobStore{}
+	p := newTestPool(memory)
+	Handle(p, "fail", func(ctx context.Context, job *store.Job, args struct{}) error {
+		return errors.New("nope")
+	})
+	require.NoError(t, memory.EnqueueJob(&store.Job{Type: "fail", MaxAttempts: 2}))
+
+	job := memory.jobs[0]
+	job.Status, job.Attempts = store.JobRunning, 1
+	p.run(context.Background(), job)
+	assert.Equal(t, store.JobPending, job.Status)
+
+	job.Status, job.Attempts = store.JobRunning, 2
+	p.run(context.Background(), job)
+	assert.Equal(t, store.JobDead, job.Status)
+}
+
+func TestPoolWaitsForRunningJobsOnShutdown(t *testing.T) {
+	memory := &memoryJobStore{}
+	p := newTestPool(memory)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	Handle(p, "slow", func(ctx context.Context, job *store.Job, args struct{}) error {
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	require.NoError(t, memory.EnqueueJob(&store.Job{Type: "slow"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Run returned while a job was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	assert.Equal(t, store.JobSucceeded, memory.get(1).Status)
+}
+
+func TestPoolCancelsJobsAfterShutdownTimeout(t *testing.T) {
+	memory := &memoryJobStore{}
+	p := newTestPool(memory)
+	p.ShutdownTimeout = 10 * time.Millisecond
+
+	started := make(chan struct{})
+	Handle(p, "stuck", func(ctx context.Context, job *store.Job, args struct{}) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.NoError(t, memory.EnqueueJob(&store.Job{Type: "stuck"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	job := memory.get(1)
+	assert.Equal(t, store.JobPending, job.Status, "a canceled job is retried")
+	assert.Equal(t, context.Canceled.Error(), *job.LastError)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: baseBackoff, 3: 4 * baseBackoff, 12: maxBackoff, 50: maxBackoff} {
+		got := Backoff(attempts)
+		assert.LessOrEqual(t, got, want, "attempts %d", attempts)
+		assert.GreaterOrEqual(t, got, want*4/5, "attempts %d", attempts)
+	}
+}
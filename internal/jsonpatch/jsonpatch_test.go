@@ -0,0 +1,137 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace field", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"remove field", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"arrays are replaced", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"nested objects merge", `{"e":null}`, `{"a":{"bb":{"ccc":null}}}`, `{"e":null,"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "add to array",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "append with dash",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":"baz"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "replace nested value",
+			doc:   `{"entries":[{"sets":3}]}`,
+			patch: `[{"op":"replace","path":"/entries/0/sets","value":5}]`,
+			want:  `{"entries":[{"sets":5}]}`,
+		},
+		{
+			name:  "move array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "copy and escaped pointer",
+			doc:   `{"a/b":1}`,
+			patch: `[{"op":"copy","from":"/a~1b","path":"/c"}]`,
+			want:  `{"a/b":1,"c":1}`,
+		},
+		{
+			name:  "test passes",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"remove","path":"/baz"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"","value":{"b":2}}]`,
+			want:  `{"b":2}`,
+		},
+		{
+			name:    "test fails",
+			doc:     `{"baz":"qux"}`,
+			patch:   `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "index out of range",
+			doc:     `{"foo":["bar"]}`,
+			patch:   `[{"op":"remove","path":"/foo/3"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown op",
+			doc:     `{}`,
+			patch:   `[{"op":"frobnicate","path":"/a"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestApplyDropsIdentityOfInsertedObjects(t *testing.T) {
+	doc := `{"entries":[{"id":1,"name":"row"}],"other":[{"id":1}]}`
+	patch := `[
+		{"op":"copy","from":"/entries/0","path":"/entries/-"},
+		{"op":"add","path":"/entries/0","value":{"id":1,"name":"squat"}},
+		{"op":"copy","from":"/entries/1","path":"/other/-"},
+		{"op":"move","from":"/entries/1","path":"/entries/2"},
+		{"op":"replace","path":"/entries/2","value":{"id":1,"name":"deadlift"}}
+	]`
+
+	got, err := Apply([]byte(doc), []byte(patch), Identity{Array: "/entries", Key: "id"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"entries":[{"name":"squat"},{"name":"row"},{"id":1,"name":"deadlift"}],
+		"other":[{"id":1},{"id":1,"name":"row"}]
+	}`, string(got))
+}
@@ -0,0 +1,280 @@
+// Package live runs workout sessions in progress: it applies the events
+// devices send to a session's state, fans them out to the other devices of
+// the user and turns a finished session into a workout.
+package live
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// Event types.
+const (
+	// EventSetCompleted records a set of EntryID. Reps, DurationSeconds and
+	// Weight default to the entry's targets.
+	EventSetCompleted = "set_completed"
+	// EventSetUndone removes the last completed set of EntryID.
+	EventSetUndone = "set_undone"
+	// EventRestStarted starts a rest timer of Seconds, replacing a running
+	// one.
+	EventRestStarted = "rest_started"
+	// EventRestSkipped stops the rest timer.
+	EventRestSkipped = "rest_skipped"
+	// EventEntryAdded appends Entry to the session.
+	EventEntryAdded = "entry_added"
+	// EventEntryUpdated replaces the plan of Entry.ID; its completed sets
+	// are kept.
+	EventEntryUpdated = "entry_updated"
+	// EventEntryRemoved drops EntryID with its completed sets.
+	EventEntryRemoved = "entry_removed"
+	// EventSessionUpdated changes Title and Description when given.
+	EventSessionUpdated = "session_updated"
+)
+
+// DefaultTitle names sessions started without a template or title.
+const DefaultTitle = "Live workout"
+
+// ErrInvalidEvent is returned for events that don't apply to the session.
+// The wrapping error says why.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Event is a change to a live session sent by one of its devices. ID is
+// chosen by the client and echoed back so it can match the broadcast to
+// what it sent.
+type Event struct {
+	ID              string           `json:"id,omitempty"`
+	Type            string           `json:"type"`
+	EntryID         int              `json:"entry_id,omitempty"`
+	Reps            *int             `json:"reps,omitempty"`
+	DurationSeconds *int             `json:"duration_seconds,omitempty"`
+	Weight          *float64         `json:"weight,omitempty"`
+	Seconds         int              `json:"seconds,omitempty"`
+	Entry           *store.LiveEntry `json:"entry,omitempty"`
+	Title           *string          `json:"title,omitempty"`
+	Description     *string          `json:"description,omitempty"`
+	// At is when the server applied the event.
+	At time.Time `json:"at"`
+}
+
+// NewState starts the state of a session, copying the plan of template
+// when given. title overrides the template's title.
+func NewState(template *store.Workout, title string) store.LiveSessionState {
+	state := store.LiveSessionState{
+		Title:       DefaultTitle,
+		Groups:      []store.EntryGroup{},
+		Entries:     []store.LiveEntry{},
+		NextEntryID: 1,
+	}
+	if template != nil {
+		state.Title = template.Title
+		state.Description = template.Description
+		for _, group := range template.Groups {
+			group.ID = 0
+			state.Groups = append(state.Groups, group)
+		}
+		for _, entry := range template.Entries {
+			state.Entries = append(state.Entries, store.LiveEntry{
+				ID:              state.NextEntryID,
+				ExerciseName:    entry.ExerciseName,
+				TargetSets:      entry.Sets,
+				Reps:            entry.Reps,
+				DurationSeconds: entry.DurationSeconds,
+				Weight:          entry.Weight,
+				Notes:           entry.Notes,
+				Group:           entry.Group,
+				CompletedSets:   []store.CompletedSet{},
+			})
+			state.NextEntryID++
+		}
+	}
+	if strings.TrimSpace(title) != "" {
+		state.Title = title
+	}
+	return state
+}
+
+// Apply changes state by e at now. On error state is left as it was.
+func Apply(state *store.LiveSessionState, e *Event, now time.Time) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{ErrInvalidEvent}, args...)...)
+	}
+	e.At = now
+
+	switch e.Type {
+	case EventSetCompleted:
+		entry := findEntry(state, e.EntryID)
+		if entry == nil {
+			return invalid("entry %d not found", e.EntryID)
+		}
+		set := store.CompletedSet{
+			Reps:            orDefault(e.Reps, entry.Reps),
+			DurationSeconds: orDefault(e.DurationSeconds, entry.DurationSeconds),
+			Weight:          orDefault(e.Weight, entry.Weight),
+			CompletedAt:     now,
+		}
+		if (set.Reps == nil) == (set.DurationSeconds == nil) {
+			return invalid("exactly one of reps or duration_seconds is required")
+		}
+		if negative(set.Reps) || negative(set.DurationSeconds) || (set.Weight != nil && *set.Weight < 0) {
+			return invalid("reps, duration_seconds and weight can't be negative")
+		}
+		entry.CompletedSets = append(entry.CompletedSets, set)
+
+	case EventSetUndone:
+		entry := findEntry(state, e.EntryID)
+		if entry == nil {
+			return invalid("entry %d not found", e.EntryID)
+		}
+		if len(entry.CompletedSets) == 0 {
+			return invalid("entry %d has no completed sets", e.EntryID)
+		}
+		entry.CompletedSets = entry.CompletedSets[:len(entry.CompletedSets)-1]
+
+	case EventRestStarted:
+		if e.Seconds <= 0 {
+			return invalid("seconds must be positive")
+		}
+		rest := &store.RestTimer{
+			DurationSeconds: e.Seconds,
+			StartedAt:       now,
+			EndsAt:          now.Add(time.Duration(e.Seconds) * time.Second),
+		}
+		if e.EntryID != 0 {
+			if findEntry(state, e.EntryID) == nil {
+				return invalid("entry %d not found", e.EntryID)
+			}
+			entryID := e.EntryID
+			rest.EntryID = &entryID
+		}
+		state.Rest = rest
+
+	case EventRestSkipped:
+		state.Rest = nil
+
+	case EventEntryAdded:
+		if e.Entry == nil {
+			return invalid("entry is required")
+		}
+		entry := *e.Entry
+		entry.ID = state.NextEntryID
+		entry.CompletedSets = []store.CompletedSet{}
+		entries := append(slices.Clone(state.Entries), entry)
+		if msg := checkEntry(state, entries, &entry); msg != "" {
+			return invalid("%s", msg)
+		}
+		state.Entries = entries
+		state.NextEntryID++
+		e.Entry = &entry
+
+	case EventEntryUpdated:
+		if e.Entry == nil {
+			return invalid("entry is required")
+		}
+		current := findEntry(state, e.Entry.ID)
+		if current == nil {
+			return invalid("entry %d not found", e.Entry.ID)
+		}
+		entry := *e.Entry
+		entry.CompletedSets = current.CompletedSets
+		entries := slices.Clone(state.Entries)
+		for i := range entries {
+			if entries[i].ID == entry.ID {
+				entries[i] = entry
+			}
+		}
+		if msg := checkEntry(state, entries, &entry); msg != "" {
+			return invalid("%s", msg)
+		}
+		state.Entries = entries
+		e.Entry = &entry
+
+	case EventEntryRemoved:
+		for i := range state.Entries {
+			if state.Entries[i].ID == e.EntryID {
+				state.Entries = append(state.Entries[:i], state.Entries[i+1:]...)
+				if state.Rest != nil && state.Rest.EntryID != nil && *state.Rest.EntryID == e.EntryID {
+					state.Rest.EntryID = nil
+				}
+				return nil
+			}
+		}
+		return invalid("entry %d not found", e.EntryID)
+
+	case EventSessionUpdated:
+		if e.Title != nil {
+			if strings.TrimSpace(*e.Title) == "" {
+				return invalid("title can't be empty")
+			}
+			state.Title = *e.Title
+		}
+		if e.Description != nil {
+			state.Description = *e.Description
+		}
+
+	default:
+		return invalid("unknown type %q", e.Type)
+	}
+	return nil
+}
+
+// checkEntry validates the plan of an added or updated entry, given the
+// entries the session would have with it, and returns "" when it is valid.
+func checkEntry(state *store.LiveSessionState, entries []store.LiveEntry, entry *store.LiveEntry) string {
+	if strings.TrimSpace(entry.ExerciseName) == "" {
+		return "exercise_name is required"
+	}
+	if entry.Reps != nil && entry.DurationSeconds != nil {
+		return "only one of reps or duration_seconds may be set"
+	}
+	if entry.TargetSets < 0 || negative(entry.Reps) || negative(entry.DurationSeconds) {
+		return "target_sets, reps and duration_seconds can't be negative"
+	}
+	if entry.Group != nil && (*entry.Group < 0 || *entry.Group >= len(state.Groups)) {
+		return fmt.Sprintf("group %d does not exist", *entry.Group)
+	}
+
+	// the entries of a group stay consecutive, as in a stored workout
+	closed := map[int]bool{}
+	previous := -1
+	for _, e := range entries {
+		current := -1
+		if e.Group != nil {
+			current = *e.Group
+		}
+		if current != previous {
+			if previous >= 0 {
+				closed[previous] = true
+			}
+			if current >= 0 && closed[current] {
+				return fmt.Sprintf("the entries of group %d must be consecutive", current)
+			}
+		}
+		previous = current
+	}
+	return ""
+}
+
+func findEntry(state *store.LiveSessionState, id int) *store.LiveEntry {
+	for i := range state.Entries {
+		if state.Entries[i].ID == id {
+			return &state.Entries[i]
+		}
+	}
+	return nil
+}
+
+func orDefault[T any](v, fallback *T) *T {
+	if v != nil {
+		return v
+	}
+	return fallback
+}
+
+func negative(i *int) bool {
+	return i != nil && *i < 0
+}
@@ -0,0 +1,226 @@
+package live
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func templateState() store.LiveSessionState {
+	return NewState(&store.Workout{
+		Title:  "Push day",
+		Groups: []store.EntryGroup{{ID: 7, Kind: store.GroupSuperset, Rounds: 3}},
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", Sets: 3, Reps: intPtr(8), Weight: floatPtr(80)},
+			{ExerciseName: "Dips", Sets: 3, Reps: intPtr(12), Group: intPtr(0)},
+			{ExerciseName: "Plank", Sets: 2, DurationSeconds: intPtr(60), Group: intPtr(0)},
+		},
+	}, "")
+}
+
+func TestNewState(t *testing.T) {
+	state := templateState()
+	assert.Equal(t, "Push day", state.Title)
+	assert.Equal(t, 0, state.Groups[0].ID)
+	require.Len(t, state.Entries, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{state.Entries[0].ID, state.Entries[1].ID, state.Entries[2].ID})
+	assert.Equal(t, 4, state.NextEntryID)
+	assert.Equal(t, 3, state.Entries[0].TargetSets)
+
+	blank := NewState(nil, "")
+	assert.Equal(t, DefaultTitle, blank.Title)
+	assert.Empty(t, blank.Entries)
+	assert.Equal(t, "Legs", NewState(nil, "Legs").Title)
+}
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		events  []Event
+		wantErr string
+		check   func(t *testing.T, state store.LiveSessionState)
+	}{
+		{
+			name:   "set defaults to the targets",
+			events: []Event{{Type: EventSetCompleted, EntryID: 1}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				require.Len(t, state.Entries[0].CompletedSets, 1)
+				set := state.Entries[0].CompletedSets[0]
+				assert.Equal(t, 8, *set.Reps)
+				assert.Equal(t, 80.0, *set.Weight)
+				assert.Equal(t, now, set.CompletedAt)
+			},
+		},
+		{
+			name:   "set overrides the targets",
+			events: []Event{{Type: EventSetCompleted, EntryID: 1, Reps: intPtr(6), Weight: floatPtr(85)}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				set := state.Entries[0].CompletedSets[0]
+				assert.Equal(t, 6, *set.Reps)
+				assert.Equal(t, 85.0, *set.Weight)
+			},
+		},
+		{
+			name:    "set of unknown entry",
+			events:  []Event{{Type: EventSetCompleted, EntryID: 9}},
+			wantErr: "entry 9 not found",
+		},
+		{
+			name:   "undo removes the last set",
+			events: []Event{{Type: EventSetCompleted, EntryID: 1}, {Type: EventSetCompleted, EntryID: 1, Reps: intPtr(5)}, {Type: EventSetUndone, EntryID: 1}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				require.Len(t, state.Entries[0].CompletedSets, 1)
+				assert.Equal(t, 8, *state.Entries[0].CompletedSets[0].Reps)
+			},
+		},
+		{
+			name:    "undo without sets",
+			events:  []Event{{Type: EventSetUndone, EntryID: 1}},
+			wantErr: "entry 1 has no completed sets",
+		},
+		{
+			name:   "rest timer",
+			events: []Event{{Type: EventRestStarted, EntryID: 1, Seconds: 90}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				require.NotNil(t, state.Rest)
+				assert.Equal(t, now.Add(90*time.Second), state.Rest.EndsAt)
+				assert.Equal(t, 1, *state.Rest.EntryID)
+			},
+		},
+		{
+			name:   "skipped rest",
+			events: []Event{{Type: EventRestStarted, Seconds: 90}, {Type: EventRestSkipped}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				assert.Nil(t, state.Rest)
+			},
+		},
+		{
+			name:    "rest without seconds",
+			events:  []Event{{Type: EventRestStarted}},
+			wantErr: "seconds must be positive",
+		},
+		{
+			name:   "added entry gets the next id",
+			events: []Event{{Type: EventEntryAdded, Entry: &store.LiveEntry{ID: 1, ExerciseName: "Push-up", TargetSets: 2}}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				require.Len(t, state.Entries, 4)
+				assert.Equal(t, 4, state.Entries[3].ID)
+				assert.Equal(t, 5, state.NextEntryID)
+			},
+		},
+		{
+			name:    "added entry splits a group",
+			events:  []Event{{Type: EventEntryAdded, Entry: &store.LiveEntry{ExerciseName: "Push-up", Group: intPtr(0)}}, {Type: EventEntryAdded, Entry: &store.LiveEntry{ExerciseName: "Curl"}}, {Type: EventEntryAdded, Entry: &store.LiveEntry{ExerciseName: "Row", Group: intPtr(0)}}},
+			wantErr: "the entries of group 0 must be consecutive",
+		},
+		{
+			name:   "updated entry keeps its sets",
+			events: []Event{{Type: EventSetCompleted, EntryID: 1}, {Type: EventEntryUpdated, Entry: &store.LiveEntry{ID: 1, ExerciseName: "Incline Bench", TargetSets: 4, Reps: intPtr(10)}}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				assert.Equal(t, "Incline Bench", state.Entries[0].ExerciseName)
+				assert.Len(t, state.Entries[0].CompletedSets, 1)
+			},
+		},
+		{
+			name:    "updated entry without a name",
+			events:  []Event{{Type: EventEntryUpdated, Entry: &store.LiveEntry{ID: 1}}},
+			wantErr: "exercise_name is required",
+		},
+		{
+			name:   "removed entry",
+			events: []Event{{Type: EventRestStarted, EntryID: 2, Seconds: 60}, {Type: EventEntryRemoved, EntryID: 2}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				require.Len(t, state.Entries, 2)
+				assert.Equal(t, 3, state.Entries[1].ID)
+				assert.Nil(t, state.Rest.EntryID)
+			},
+		},
+		{
+			name:   "session renamed",
+			events: []Event{{Type: EventSessionUpdated, Title: func() *string { s := "Chest"; return &s }()}},
+			check: func(t *testing.T, state store.LiveSessionState) {
+				assert.Equal(t, "Chest", state.Title)
+			},
+		},
+		{
+			name:    "unknown type",
+			events:  []Event{{Type: "jump"}},
+			wantErr: `unknown type "jump"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := templateState()
+			var err error
+			for i := range tt.events {
+				err = Apply(&state, &tt.events[i], now)
+				if err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				require.ErrorIs(t, err, ErrInvalidEvent)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, state)
+		})
+	}
+}
+
+func TestApplyLeavesStateOnError(t *testing.T) {
+	state := templateState()
+	before := templateState()
+
+	err := Apply(&state, &Event{Type: EventEntryUpdated, Entry: &store.LiveEntry{ID: 2, ExerciseName: "Dips", Group: intPtr(3)}}, time.Now())
+	require.ErrorIs(t, err, ErrInvalidEvent)
+	assert.Equal(t, before, state)
+}
+
+func TestToWorkout(t *testing.T) {
+	started := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	session := &store.LiveSession{UserID: 4, StartedAt: started, State: templateState()}
+
+	events := []Event{
+		{Type: EventSetCompleted, EntryID: 1},
+		{Type: EventSetCompleted, EntryID: 1},
+		{Type: EventSetCompleted, EntryID: 1, Reps: intPtr(6)},
+		{Type: EventSetCompleted, EntryID: 3},
+	}
+	for i := range events {
+		require.NoError(t, Apply(&session.State, &events[i], started))
+	}
+
+	workout := ToWorkout(session, started.Add(41*time.Minute+10*time.Second))
+	assert.Equal(t, 4, workout.UserID)
+	assert.Equal(t, "Push day", workout.Title)
+	assert.Equal(t, 42, workout.DurationMinutes)
+	assert.Equal(t, started, workout.CreatedAt)
+
+	require.Len(t, workout.Entries, 3)
+	assert.Equal(t, "Bench Press", workout.Entries[0].ExerciseName)
+	assert.Equal(t, 2, workout.Entries[0].Sets)
+	assert.Equal(t, 8, *workout.Entries[0].Reps)
+	assert.Equal(t, 1, workout.Entries[1].Sets)
+	assert.Equal(t, 6, *workout.Entries[1].Reps)
+	assert.Equal(t, "Plank", workout.Entries[2].ExerciseName)
+	assert.Equal(t, 60, *workout.Entries[2].DurationSeconds)
+	assert.Equal(t, 0, *workout.Entries[2].Group)
+	assert.Equal(t, []int{0, 1, 2}, []int{workout.Entries[0].OrderIndex, workout.Entries[1].OrderIndex, workout.Entries[2].OrderIndex})
+	assert.NoError(t, store.CheckEntryGroups(workout))
+}
@@ -0,0 +1,347 @@
+package live
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// Message types sent to the devices of a session.
+const (
+	// MessageSnapshot carries the whole session, sent when a device joins.
+	MessageSnapshot = "snapshot"
+	// MessageEvent carries an applied event and the seq it produced.
+	MessageEvent = "event"
+	// MessageError answers an event of this device that was rejected.
+	MessageError = "error"
+	// MessageEnded carries the session once it is finished or abandoned;
+	// the connection is closed after it.
+	MessageEnded = "session_ended"
+)
+
+// clientBuffer is how many messages may queue up for a device before it is
+// dropped as too slow.
+const clientBuffer = 64
+
+const (
+	// relayChannel is the notification channel hubs exchange messages on.
+	relayChannel = "live_sessions"
+	// relayRetryDelay is how long Run waits before listening again after
+	// the listener failed.
+	relayRetryDelay = 5 * time.Second
+)
+
+type Message struct {
+	Type    string             `json:"type"`
+	Seq     int64              `json:"seq,omitempty"`
+	Event   *Event             `json:"event,omitempty"`
+	Session *store.LiveSession `json:"session,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// Client is one connected device. Messages is closed when the client
+// leaves, is dropped for falling behind or the session ends.
+type Client struct {
+	Messages chan Message
+}
+
+// Notifier passes messages between the instances of the server.
+type Notifier interface {
+	Notify(channel, payload string) error
+	Listen(ctx context.Context, channel string, fn func(payload string)) error
+}
+
+// Hub fans out the messages of each live session to its connected devices
+// and serializes the writes to a session. With a Notifier it also relays
+// broadcasts to the hubs of the other instances, so the devices of one
+// session may connect to any of them; the seq guard of
+// SaveLiveSessionState keeps writers on different instances from
+// overwriting each other.
+type Hub struct {
+	mu       sync.Mutex
+	rooms    map[int64]*room
+	notifier Notifier
+	instance string
+	logger   *log.Logger
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// relayed is a broadcast sent to the other instances. Message is left out
+// when it is too large for a notification; the session's devices are then
+// dropped to reconnect for a new snapshot.
+type relayed struct {
+	Instance  string   `json:"instance"`
+	SessionID int64    `json:"session_id"`
+	Message   *Message `json:"message,omitempty"`
+}
+
+type room struct {
+	clients map[*Client]bool
+	writes  sync.Mutex
+	// refs counts holders and waiters of writes, so the room isn't
+	// removed while they use it
+	refs int
+}
+
+// NewHub returns a hub relaying through notifier. A nil notifier keeps
+// sessions within this process, which then needs every device of a session
+// routed to it.
+func NewHub(notifier Notifier, logger *log.Logger) *Hub {
+	instance := make([]byte, 16)
+	rand.Read(instance)
+	return &Hub{
+		rooms:    map[int64]*room{},
+		notifier: notifier,
+		instance: hex.EncodeToString(instance),
+		logger:   logger,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Shutdown tells the connections of every device to close. The server
+// doesn't track hijacked connections, so without it they would hold up a
+// graceful shutdown until it times out; devices reconnect, to another
+// instance or once this one is back. It is meant for
+// http.Server.RegisterOnShutdown.
+func (h *Hub) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.shutdown)
+	})
+}
+
+// Done is closed once Shutdown is called. Connections should close when
+// it is.
+func (h *Hub) Done() <-chan struct{} {
+	return h.shutdown
+}
+
+// Run receives the broadcasts of other instances until ctx ends. Devices
+// connected while the listener was down may have missed messages, so they
+// are dropped whenever it fails.
+func (h *Hub) Run(ctx context.Context) {
+	if h.notifier == nil {
+		return
+	}
+	for {
+		err := h.notifier.Listen(ctx, relayChannel, h.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Println("ERROR: listenLiveSessions:", err)
+		h.dropAll()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relayRetryDelay):
+		}
+	}
+}
+
+// Lock blocks until the caller is the only writer of the session and
+// returns the function that releases it.
+func (h *Hub) Lock(sessionID int64) (unlock func()) {
+	h.mu.Lock()
+	r := h.room(sessionID)
+	r.refs++
+	h.mu.Unlock()
+
+	r.writes.Lock()
+	return func() {
+		r.writes.Unlock()
+
+		h.mu.Lock()
+		r.refs--
+		h.removeIfUnused(sessionID, r)
+		h.mu.Unlock()
+	}
+}
+
+// Join connects a device to the session. Call it while holding the lock of
+// the session so no message is missed between reading the snapshot and
+// joining.
+func (h *Hub) Join(sessionID int64) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := &Client{Messages: make(chan Message, clientBuffer)}
+	h.room(sessionID).clients[c] = true
+	return c
+}
+
+// Leave disconnects a device. It is safe to call after the client was
+// dropped.
+func (h *Hub) Leave(sessionID int64, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[sessionID]
+	if !ok || !r.clients[c] {
+		return
+	}
+	delete(r.clients, c)
+	close(c.Messages)
+	h.removeIfUnused(sessionID, r)
+}
+
+// Send queues msg for a single device, dropping it if its queue is full.
+func (h *Hub) Send(sessionID int64, c *Client, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.rooms[sessionID]; ok && r.clients[c] {
+		h.send(sessionID, r, c, msg)
+	}
+}
+
+// Broadcast queues msg for every device of the session, on every
+// instance. It never blocks: devices that can't keep up are dropped and
+// have to reconnect for a new snapshot.
+func (h *Hub) Broadcast(sessionID int64, msg Message) {
+	h.broadcast(sessionID, msg)
+	h.relay(sessionID, msg)
+}
+
+// End sends msg to every device of the session, on every instance, and
+// disconnects them.
+func (h *Hub) End(sessionID int64, msg Message) {
+	h.end(sessionID, &msg)
+	h.relay(sessionID, msg)
+}
+
+func (h *Hub) broadcast(sessionID int64, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[sessionID]
+	if !ok {
+		return
+	}
+	for c := range r.clients {
+		h.send(sessionID, r, c, msg)
+	}
+}
+
+// end disconnects the devices of the session, sending them msg first when
+// given.
+func (h *Hub) end(sessionID int64, msg *Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rooms[sessionID]
+	if !ok {
+		return
+	}
+	for c := range r.clients {
+		if msg != nil {
+			select {
+			case c.Messages <- *msg:
+			default:
+			}
+		}
+		delete(r.clients, c)
+		close(c.Messages)
+	}
+	h.removeIfUnused(sessionID, r)
+}
+
+// dropAll disconnects every device so they reconnect for a new snapshot.
+func (h *Hub) dropAll() {
+	h.mu.Lock()
+	sessionIDs := make([]int64, 0, len(h.rooms))
+	for sessionID := range h.rooms {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	h.mu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		h.end(sessionID, nil)
+	}
+}
+
+// relay passes msg on to the other instances.
+func (h *Hub) relay(sessionID int64, msg Message) {
+	if h.notifier == nil {
+		return
+	}
+
+	payload, err := json.Marshal(relayed{Instance: h.instance, SessionID: sessionID, Message: &msg})
+	if err == nil && len(payload) > store.MaxNotifyPayload {
+		payload, err = json.Marshal(relayed{Instance: h.instance, SessionID: sessionID})
+	}
+	if err == nil {
+		err = h.notifier.Notify(relayChannel, string(payload))
+	}
+	if err != nil {
+		h.logger.Println("ERROR: relayLiveMessage:", err)
+	}
+}
+
+// receive delivers a message relayed by another instance to the devices
+// connected here.
+func (h *Hub) receive(payload string) {
+	var in relayed
+	err := json.Unmarshal([]byte(payload), &in)
+	if err != nil {
+		h.logger.Println("ERROR: decodeRelayedLiveMessage:", err)
+		return
+	}
+	if in.Instance == h.instance {
+		return
+	}
+
+	switch {
+	case in.Message == nil:
+		h.end(in.SessionID, nil)
+	case in.Message.Type == MessageEnded:
+		h.end(in.SessionID, in.Message)
+	default:
+		h.broadcast(in.SessionID, *in.Message)
+	}
+}
+
+// Connected returns the number of devices connected to the session.
+func (h *Hub) Connected(sessionID int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.rooms[sessionID]; ok {
+		return len(r.clients)
+	}
+	return 0
+}
+
+func (h *Hub) send(sessionID int64, r *room, c *Client, msg Message) {
+	select {
+	case c.Messages <- msg:
+	default:
+		delete(r.clients, c)
+		close(c.Messages)
+		h.removeIfUnused(sessionID, r)
+	}
+}
+
+// room returns the room of the session, creating it. h.mu must be held.
+func (h *Hub) room(sessionID int64) *room {
+	r, ok := h.rooms[sessionID]
+	if !ok {
+		r = &room{clients: map[*Client]bool{}}
+		h.rooms[sessionID] = r
+	}
+	return r
+}
+
+// removeIfUnused forgets the room once nobody uses it. h.mu must be held.
+func (h *Hub) removeIfUnused(sessionID int64, r *room) {
+	if r.refs == 0 && len(r.clients) == 0 && h.rooms[sessionID] == r {
+		delete(h.rooms, sessionID)
+	}
+}
@@ -0,0 +1,121 @@
+package live
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(c *Client) []Message {
+	var msgs []Message
+	for msg := range c.Messages {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestHubBroadcast(t *testing.T) {
+	hub := NewHub(nil, nil)
+	phone := hub.Join(1)
+	watch := hub.Join(1)
+	other := hub.Join(2)
+
+	hub.Broadcast(1, Message{Type: MessageEvent, Seq: 1})
+	hub.Send(1, phone, Message{Type: MessageError, Error: "nope"})
+	assert.Equal(t, 2, hub.Connected(1))
+
+	hub.Leave(1, phone)
+	hub.Leave(1, phone)
+	hub.End(1, Message{Type: MessageEnded, Seq: 2})
+	hub.Leave(2, other)
+
+	assert.Equal(t, []Message{{Type: MessageEvent, Seq: 1}, {Type: MessageError, Error: "nope"}}, drain(phone))
+	assert.Equal(t, []Message{{Type: MessageEvent, Seq: 1}, {Type: MessageEnded, Seq: 2}}, drain(watch))
+	assert.Empty(t, drain(other))
+	assert.Empty(t, hub.rooms)
+}
+
+func TestHubDropsSlowClients(t *testing.T) {
+	hub := NewHub(nil, nil)
+	slow := hub.Join(1)
+
+	for i := 0; i <= clientBuffer; i++ {
+		hub.Broadcast(1, Message{Type: MessageEvent, Seq: int64(i + 1)})
+	}
+
+	msgs := drain(slow)
+	require.Len(t, msgs, clientBuffer)
+	assert.Equal(t, 0, hub.Connected(1))
+	assert.Empty(t, hub.rooms)
+}
+
+func TestHubLockSerializesWriters(t *testing.T) {
+	hub := NewHub(nil, nil)
+
+	var wg sync.WaitGroup
+	counter := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := hub.Lock(1)
+			defer unlock()
+			v := counter
+			counter = v + 1
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, counter)
+	assert.Empty(t, hub.rooms)
+}
+
+// memoryNotifier delivers every notification to all listening hubs right
+// away, like Postgres does to every listening instance.
+type memoryNotifier struct {
+	listeners []func(payload string)
+}
+
+func (n *memoryNotifier) Notify(channel, payload string) error {
+	for _, fn := range n.listeners {
+		fn(payload)
+	}
+	return nil
+}
+
+func (n *memoryNotifier) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	return nil
+}
+
+func TestHubRelaysAcrossInstances(t *testing.T) {
+	notifier := &memoryNotifier{}
+	logger := log.New(io.Discard, "", 0)
+	a := NewHub(notifier, logger)
+	b := NewHub(notifier, logger)
+	notifier.listeners = []func(string){a.receive, b.receive}
+
+	phone := a.Join(1)
+	watch := b.Join(1)
+
+	a.Broadcast(1, Message{Type: MessageEvent, Seq: 1})
+	title := strings.Repeat("x", store.MaxNotifyPayload)
+	b.Broadcast(1, Message{Type: MessageEvent, Seq: 2, Event: &Event{Title: &title}})
+	a.End(1, Message{Type: MessageEnded, Seq: 3})
+
+	// the oversized event reaches the other instance only as a drop
+	assert.Equal(t, []Message{{Type: MessageEvent, Seq: 1}}, drain(phone))
+	var seqs []int64
+	for _, msg := range drain(watch) {
+		seqs = append(seqs, msg.Seq)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, seqs)
+	assert.Empty(t, a.rooms)
+	assert.Empty(t, b.rooms)
+}
@@ -0,0 +1,66 @@
+package live
+
+import (
+	"math"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// ToWorkout builds the workout recorded by session, ended at now. Only the
+// sets that were completed count: an entry becomes one workout entry per
+// run of identical consecutive sets, and entries without completed sets
+// are left out along with groups that end up empty.
+func ToWorkout(session *store.LiveSession, now time.Time) *store.Workout {
+	state := session.State
+	workout := &store.Workout{
+		UserID:          session.UserID,
+		Title:           state.Title,
+		Description:     state.Description,
+		DurationMinutes: int(math.Ceil(now.Sub(session.StartedAt).Minutes())),
+		CreatedAt:       session.StartedAt,
+		Groups:          make([]store.EntryGroup, len(state.Groups)),
+		Entries:         []store.WorkoutEntry{},
+	}
+	copy(workout.Groups, state.Groups)
+
+	for _, entry := range state.Entries {
+		for _, run := range setRuns(entry.CompletedSets) {
+			workout.Entries = append(workout.Entries, store.WorkoutEntry{
+				ExerciseName:    entry.ExerciseName,
+				Sets:            len(run),
+				Reps:            run[0].Reps,
+				DurationSeconds: run[0].DurationSeconds,
+				Weight:          run[0].Weight,
+				Notes:           entry.Notes,
+				OrderIndex:      len(workout.Entries),
+				Group:           entry.Group,
+			})
+		}
+	}
+	return workout
+}
+
+// setRuns splits sets into runs with the same reps, duration and weight.
+func setRuns(sets []store.CompletedSet) [][]store.CompletedSet {
+	var runs [][]store.CompletedSet
+	start := 0
+	for i := 1; i <= len(sets); i++ {
+		if i == len(sets) || !sameSet(sets[start], sets[i]) {
+			runs = append(runs, sets[start:i])
+			start = i
+		}
+	}
+	return runs
+}
+
+func sameSet(a, b store.CompletedSet) bool {
+	return equalPtr(a.Reps, b.Reps) && equalPtr(a.DurationSeconds, b.DurationSeconds) && equalPtr(a.Weight, b.Weight)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
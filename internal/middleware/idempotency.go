@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/Anezz12/femProject/internal/utils"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	// requests carrying a key are buffered to fingerprint them, so their
+	// bodies are capped here in addition to whatever the handler enforces
+	maxIdempotentBodyBytes = 32 << 20
+)
+
+type IdempotencyMiddleware struct {
+	Store  store.IdempotencyStore
+	Window time.Duration
+	Logger *log.Logger
+}
+
+// Idempotent makes mutating requests that carry an Idempotency-Key safe to
+// retry. The first request with a key runs normally and its response is
+// stored; a retry within Window with the same method, path and body gets
+// that response replayed, while reusing the key for a different request is
+// rejected with 422. Responses with a 5xx status are not stored so the
+// client can retry them. Handlers whose responses carry credentials mark
+// them Cache-Control: no-store; their bodies are never stored, and retries
+// get a 409 instead of a replay. Must run after Authenticate; anonymous
+// requests are passed through.
+func (im *IdempotencyMiddleware) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "request body too large"})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &store.IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Fingerprint: requestFingerprint(r, body),
+		}
+		existing, err := im.Store.ReserveIdempotencyKey(record, im.Window)
+		if err != nil {
+			im.Logger.Println("ERROR: reserveIdempotencyKey:", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if existing != nil {
+			replay(w, record, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		succeeded := false
+		defer func() {
+			// a panicking or failed handler must not leave the key reserved
+			if succeeded {
+				return
+			}
+			err := im.Store.ReleaseIdempotencyKey(user.ID, key)
+			if err != nil {
+				im.Logger.Println("ERROR: releaseIdempotencyKey:", err)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+		succeeded = true
+
+		record.StatusCode = recorder.status
+		record.Header = w.Header().Clone()
+		if !noStore(record.Header) {
+			record.Body = recorder.body.Bytes()
+		}
+		err = im.Store.CompleteIdempotencyKey(record)
+		if err != nil {
+			// keep the reservation: retries then get a 409 instead of
+			// repeating a request that did take effect
+			im.Logger.Println("ERROR: completeIdempotencyKey:", err)
+		}
+	})
+}
+
+func replay(w http.ResponseWriter, record, existing *store.IdempotencyRecord) {
+	if existing.Method != record.Method || existing.Path != record.Path || !bytes.Equal(existing.Fingerprint, record.Fingerprint) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if existing.StatusCode == 0 {
+		w.Header().Set("Retry-After", "1")
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "a request with this Idempotency-Key is still being processed"})
+		return
+	}
+	if noStore(existing.Header) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "a request with this Idempotency-Key already succeeded; its response held credentials and is not replayed"})
+		return
+	}
+
+	for name, values := range existing.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.Body)
+}
+
+// requestFingerprint hashes what makes two requests "the same" for
+// idempotency purposes.
+func requestFingerprint(r *http.Request, body []byte) []byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	io.WriteString(h, r.Header.Get("Content-Type")+"\n")
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// noStore reports whether the response was marked Cache-Control: no-store.
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder passes the response through to the client while keeping
+// a copy of the status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryIdempotencyStore struct {
+	records map[string]*store.IdempotencyRecord
+}
+
+func (m *memoryIdempotencyStore) ReserveIdempotencyKey(record *store.IdempotencyRecord, window time.Duration) (*store.IdempotencyRecord, error) {
+	if existing, ok := m.records[record.Key]; ok {
+		return existing, nil
+	}
+	stored := *record
+	m.records[record.Key] = &stored
+	return nil, nil
+}
+
+func (m *memoryIdempotencyStore) CompleteIdempotencyKey(record *store.IdempotencyRecord) error {
+	stored := *record
+	m.records[record.Key] = &stored
+	return nil
+}
+
+func (m *memoryIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	delete(m.records, key)
+	return nil
+}
+
+func (m *memoryIdempotencyStore) PurgeIdempotencyKeys(window time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotent(t *testing.T) {
+	calls := 0
+	status := http.StatusCreated
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+
+	im := &IdempotencyMiddleware{
+		Store:  &memoryIdempotencyStore{records: map[string]*store.IdempotencyRecord{}},
+		Window: time.Hour,
+		Logger: log.New(io.Discard, "", 0),
+	}
+	h := im.Idempotent(handler)
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		req = SetUser(req, &store.User{ID: 1})
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := do("abc", `{"title":"legs"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	t.Run("retry replays the stored response", func(t *testing.T) {
+		rr := do("abc", `{"title":"legs"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, `{"title":"legs"}`, rr.Body.String())
+		assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("reusing the key for another body is rejected", func(t *testing.T) {
+		rr := do("abc", `{"title":"arms"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("no-store responses are not replayed", func(t *testing.T) {
+		noStoreHandler := im.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Cache-Control", "private, no-store")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"token":"secret"}`)
+		}))
+		send := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/workouts/1/share", nil)
+			req.Header.Set(IdempotencyKeyHeader, "share")
+			req = SetUser(req, &store.User{ID: 1})
+			rr := httptest.NewRecorder()
+			noStoreHandler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		first := send()
+		assert.Equal(t, `{"token":"secret"}`, first.Body.String())
+		assert.Empty(t, im.Store.(*memoryIdempotencyStore).records["share"].Body)
+
+		rr := send()
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "secret")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("server errors release the key", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		do("def", `{}`)
+		status = http.StatusCreated
+		rr := do("def", `{}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 4, calls)
+	})
+}
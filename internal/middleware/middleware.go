@@ -78,3 +78,16 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireAdmin lets only admins through; like RequireUser it answers 401
+// to anonymous requests.
+func (um *UserMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !GetUser(r).IsAdmin {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must be an admin to access this route"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
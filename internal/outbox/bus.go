@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// Handler consumes events from a Bus. An error makes the bus fail the
+// event, which then reaches every handler again on the retry.
+type Handler func(ctx context.Context, event *store.OutboxEvent) error
+
+// Bus is the in-process sink: it calls the handlers subscribed to an
+// event's type synchronously, in subscription order.
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   []subscription
+}
+
+type subscription struct {
+	id         int
+	eventTypes []string
+	handler    Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Name() string {
+	return "bus"
+}
+
+// Subscribe calls handler for events of the given types, or of every type
+// when none are given, until the returned function is called.
+func (b *Bus) Subscribe(handler Handler, eventTypes ...string) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.subs = append(b.subs, subscription{id: id, eventTypes: eventTypes, handler: handler})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs = slices.DeleteFunc(b.subs, func(s subscription) bool { return s.id == id })
+	}
+}
+
+func (b *Bus) Publish(ctx context.Context, event *store.OutboxEvent) error {
+	b.mu.RLock()
+	subs := slices.Clone(b.subs)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if len(sub.eventTypes) > 0 && !slices.Contains(sub.eventTypes, event.Type) {
+			continue
+		}
+		err := sub.handler(ctx, event)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
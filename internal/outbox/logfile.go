@@ -0,0 +1,46 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// LogFile is a sink appending every event to a file as a line of JSON.
+type LogFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenLogFile opens path for appending, creating it if needed.
+func OpenLogFile(path string) (*LogFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &LogFile{file: file}, nil
+}
+
+func (l *LogFile) Name() string {
+	return "log_file"
+}
+
+func (l *LogFile) Publish(ctx context.Context, event *store.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// a single write, so concurrent appenders don't interleave lines
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *LogFile) Close() error {
+	return l.file.Close()
+}
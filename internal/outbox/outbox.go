@@ -0,0 +1,133 @@
+// Package outbox publishes the domain events that stores write to the
+// outbox table in the transaction of each change.
+//
+// Delivery is at least once: an event is retried until every sink accepts
+// it, and a dispatcher that dies mid-publish leaves it to be published
+// again, so sinks must tolerate duplicates (the event ID identifies them).
+// Events of one aggregate, such as a workout, reach each sink in the order
+// they were written; there is no order across aggregates.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+const (
+	// baseBackoff doubles after every failed attempt, up to maxBackoff. An
+	// event is never given up on, as that would break its aggregate's order.
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// claimLease has to outlast publishing a batch to every sink.
+	claimLease = time.Minute
+)
+
+// Sink receives published events. Name identifies the sink in the outbox
+// and must not change between releases.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event *store.OutboxEvent) error
+}
+
+// Dispatcher moves events from the outbox to its sinks. Several
+// dispatchers, also in other processes, can run against the same store.
+type Dispatcher struct {
+	Store     store.OutboxStore
+	Sinks     []Sink
+	Logger    *log.Logger
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewDispatcher(outboxStore store.OutboxStore, logger *log.Logger, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		Store:     outboxStore,
+		Sinks:     sinks,
+		Logger:    logger,
+		Interval:  time.Second,
+		BatchSize: 100,
+	}
+}
+
+// Run publishes due events until ctx is done, checking every Interval.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		// an aggregate's next event is only claimable once the one before
+		// it is out, so keep going while there is work
+		for ctx.Err() == nil {
+			n, err := d.DispatchDue(ctx)
+			if err != nil {
+				d.Logger.Println("ERROR: dispatchOutbox:", err)
+			}
+			if err != nil || n == 0 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue claims a batch of due events and hands each to the sinks
+// that don't have it yet. It returns how many events it claimed.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	events, err := d.Store.ClaimOutboxEvents(d.BatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		err = d.dispatch(ctx, event)
+		if err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch publishes one event. Only a failure to record the outcome is
+// returned; the claim then runs out and the event is tried again.
+func (d *Dispatcher) dispatch(ctx context.Context, event *store.OutboxEvent) error {
+	publishedTo := slices.Clone(event.PublishedTo)
+	var errs []error
+	for _, sink := range d.Sinks {
+		if slices.Contains(publishedTo, sink.Name()) {
+			continue
+		}
+		err := sink.Publish(ctx, event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		publishedTo = append(publishedTo, sink.Name())
+	}
+
+	if len(errs) == 0 {
+		return d.Store.MarkOutboxEventPublished(event.ID)
+	}
+
+	err := errors.Join(errs...)
+	d.Logger.Printf("ERROR: publishing outbox event %s (%s, attempt %d): %v", event.EventID, event.Type, event.Attempts+1, err)
+	return d.Store.RecordOutboxFailure(event, publishedTo, time.Now().Add(backoff(event.Attempts+1)), err.Error())
+}
+
+// backoff is the wait after the given number of failed attempts.
+func backoff(attempts int) time.Duration {
+	if attempts >= 20 {
+		return maxBackoff
+	}
+	return min(baseBackoff<<(attempts-1), maxBackoff)
+}
@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutboxStore claims like the Postgres store: due events that are
+// the oldest of their aggregate.
+type memoryOutboxStore struct {
+	events []*store.OutboxEvent
+	due    map[int64]time.Time
+}
+
+func (m *memoryOutboxStore) add(id int64, aggregateID int64, eventType string) {
+	if m.due == nil {
+		m.due = map[int64]time.Time{}
+	}
+	m.events = append(m.events, &store.OutboxEvent{
+		ID:            id,
+		EventID:       fmt.Sprintf("e%d", id),
+		AggregateType: store.AggregateWorkout,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Data:          json.RawMessage(`{}`),
+	})
+}
+
+func (m *memoryOutboxStore) ClaimOutboxEvents(limit int, lease time.Duration) ([]*store.OutboxEvent, error) {
+	seen := map[int64]bool{}
+	claimed := []*store.OutboxEvent{}
+	for _, event := range m.events {
+		head := !seen[event.AggregateID]
+		seen[event.AggregateID] = true
+		if head && !m.due[event.ID].After(time.Now()) && len(claimed) < limit {
+			m.due[event.ID] = time.Now().Add(lease)
+			claimed = append(claimed, event)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryOutboxStore) MarkOutboxEventPublished(id int64) error {
+	for i, event := range m.events {
+		if event.ID == id {
+			m.events = append(m.events[:i], m.events[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutboxStore) RecordOutboxFailure(event *store.OutboxEvent, publishedTo []string, nextAttemptAt time.Time, reason string) error {
+	event.Attempts++
+	event.PublishedTo = publishedTo
+	m.due[event.ID] = nextAttemptAt
+	return nil
+}
+
+// retry makes every event due again.
+func (m *memoryOutboxStore) retry() {
+	clear(m.due)
+}
+
+type recordingSink struct {
+	name string
+	fail bool
+	got  []string
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Publish(ctx context.Context, event *store.OutboxEvent) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.got = append(s.got, event.EventID)
+	return nil
+}
+
+func TestDispatcherKeepsAggregateOrder(t *testing.T) {
+	memory := &memoryOutboxStore{}
+	memory.add(1, 10, store.EventWorkoutCreated)
+	memory.add(2, 20, store.EventWorkoutCreated)
+	memory.add(3, 10, store.EventWorkoutUpdated)
+	memory.add(4, 10, store.EventWorkoutDeleted)
+
+	sink := &recordingSink{name: "a"}
+	d := NewDispatcher(memory, log.New(io.Discard, "", 0), sink)
+
+	n, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "one event per aggregate at a time")
+	assert.Equal(t, []string{"e1", "e2"}, sink.got)
+
+	for range 2 {
+		_, err = d.DispatchDue(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"e1", "e2", "e3", "e4"}, sink.got)
+	assert.Empty(t, memory.events)
+}
+
+func TestDispatcherRetriesFailedSinksOnly(t *testing.T) {
+	memory := &memoryOutboxStore{}
+	memory.add(1, 10, store.EventWorkoutCreated)
+	memory.add(2, 10, store.EventWorkoutUpdated)
+
+	healthy := &recordingSink{name: "healthy"}
+	flaky := &recordingSink{name: "flaky", fail: true}
+	d := NewDispatcher(memory, log.New(io.Discard, "", 0), healthy, flaky)
+
+	_, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	require.Len(t, memory.events, 2)
+	assert.Equal(t, 1, memory.events[0].Attempts)
+	assert.Equal(t, []string{"healthy"}, memory.events[0].PublishedTo)
+	assert.WithinDuration(t, time.Now().Add(baseBackoff), memory.due[1], time.Second)
+
+	n, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n, "the failed event holds back its aggregate until it is due")
+
+	flaky.fail = false
+	memory.retry()
+	for range 2 {
+		_, err = d.DispatchDue(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"e1", "e2"}, healthy.got)
+	assert.Equal(t, []string{"e1", "e2"}, flaky.got)
+	assert.Empty(t, memory.events)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, backoff(1))
+	assert.Equal(t, 4*baseBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(10))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	var all, deleted []string
+	bus.Subscribe(func(ctx context.Context, event *store.OutboxEvent) error {
+		all = append(all, event.Type)
+		return nil
+	})
+	unsubscribe := bus.Subscribe(func(ctx context.Context, event *store.OutboxEvent) error {
+		deleted = append(deleted, event.Type)
+		return errors.New("boom")
+	}, store.EventWorkoutDeleted)
+
+	ctx := context.Background()
+	require.NoError(t, bus.Publish(ctx, &store.OutboxEvent{Type: store.EventWorkoutCreated}))
+	assert.Error(t, bus.Publish(ctx, &store.OutboxEvent{Type: store.EventWorkoutDeleted}))
+	unsubscribe()
+	require.NoError(t, bus.Publish(ctx, &store.OutboxEvent{Type: store.EventWorkoutDeleted}))
+
+	assert.Equal(t, []string{store.EventWorkoutCreated, store.EventWorkoutDeleted, store.EventWorkoutDeleted}, all)
+	assert.Equal(t, []string{store.EventWorkoutDeleted}, deleted)
+}
+
+func TestLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	logFile, err := OpenLogFile(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		err = logFile.Publish(ctx, &store.OutboxEvent{EventID: id, Type: store.EventUserRegistered, Data: json.RawMessage(`{"id":1}`)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, logFile.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event store.OutboxEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.JSONEq(t, `{"id":1}`, string(event.Data))
+		ids = append(ids, event.EventID)
+	}
+	assert.Equal(t, []string{"a", "b"}, ids)
+}
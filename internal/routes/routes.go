@@ -10,19 +10,118 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
+		r.Use(app.Idempotency.Idempotent)
+
+		r.Get("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkouts))
+
+		r.Get("/workouts/stats", app.Middleware.RequireUser(app.WorkoutHandler.HandleWorkoutStats))
 
 		r.Get("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkByID))
 
 		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
 
+		r.Post("/workouts/batch", app.Middleware.RequireUser(app.WorkoutHandler.HandleBatchWorkouts))
+
+		r.Post("/workouts/import", app.Middleware.RequireUser(app.WorkoutHandler.HandleImportWorkout))
+
+		r.Get("/workouts/import/presets", app.Middleware.RequireUser(app.WorkoutHandler.HandleListImportPresets))
+
+		r.Post("/workouts/import/csv", app.Middleware.RequireUser(app.WorkoutHandler.HandleImportCSV))
+
+		r.Get("/workouts/export", app.Middleware.RequireUser(app.WorkoutHandler.HandleExportWorkouts))
+
+		r.Get("/workouts/search", app.Middleware.RequireUser(app.WorkoutHandler.HandleSearchWorkouts))
+
+		r.Get("/workouts/trash", app.Middleware.RequireUser(app.WorkoutHandler.HandleListTrash))
+
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreWorkout))
+
+		r.Post("/workouts/{id}/clone", app.Middleware.RequireUser(app.WorkoutHandler.HandleCloneWorkout))
+
+		r.Get("/workouts/{id}/revisions", app.Middleware.RequireUser(app.WorkoutHandler.HandleListRevisions))
+
+		r.Post("/workouts/{id}/revisions/{rev}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreRevision))
+
+		r.Get("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleListEntries))
+		r.Post("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateEntry))
+		r.Post("/workouts/{id}/entries/reorder", app.Middleware.RequireUser(app.WorkoutHandler.HandleReorderEntries))
+		r.Patch("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateEntry))
+		r.Delete("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteEntry))
+
+		r.Get("/workouts/{id}/comments", app.Middleware.RequireUser(app.CommentHandler.HandleListComments))
+		r.Post("/workouts/{id}/comments", app.Middleware.RequireUser(app.CommentHandler.HandleCreateComment))
+		r.Patch("/workouts/{id}/comments/{commentID}", app.Middleware.RequireUser(app.CommentHandler.HandleUpdateComment))
+		r.Delete("/workouts/{id}/comments/{commentID}", app.Middleware.RequireUser(app.CommentHandler.HandleDeleteComment))
+		r.Get("/workouts/{id}/reactions", app.Middleware.RequireUser(app.CommentHandler.HandleListReactions))
+		r.Post("/workouts/{id}/reactions", app.Middleware.RequireUser(app.CommentHandler.HandleAddReaction))
+		r.Delete("/workouts/{id}/reactions", app.Middleware.RequireUser(app.CommentHandler.HandleRemoveReaction))
+
+		r.Post("/workouts/{id}/share", app.Middleware.RequireUser(app.ShareHandler.HandleCreateShare))
+		r.Get("/workouts/{id}/shares", app.Middleware.RequireUser(app.ShareHandler.HandleListShares))
+		r.Delete("/workouts/{id}/shares/{shareID}", app.Middleware.RequireUser(app.ShareHandler.HandleRevokeShare))
+
+		r.Put("/workouts/{id}/tags", app.Middleware.RequireUser(app.TagHandler.HandleSetWorkoutTags))
+		r.Post("/workouts/{id}/tags/{tagID}", app.Middleware.RequireUser(app.TagHandler.HandleAddWorkoutTag))
+		r.Delete("/workouts/{id}/tags/{tagID}", app.Middleware.RequireUser(app.TagHandler.HandleRemoveWorkoutTag))
+
 		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkout))
+		r.Patch("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandlePatchWorkout))
 
 		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
+
+		r.Get("/tags", app.Middleware.RequireUser(app.TagHandler.HandleListTags))
+		r.Post("/tags", app.Middleware.RequireUser(app.TagHandler.HandleCreateTag))
+		r.Get("/tags/autocomplete", app.Middleware.RequireUser(app.TagHandler.HandleAutocompleteTags))
+		r.Patch("/tags/{id}", app.Middleware.RequireUser(app.TagHandler.HandleUpdateTag))
+		r.Delete("/tags/{id}", app.Middleware.RequireUser(app.TagHandler.HandleDeleteTag))
+
+		r.Get("/live-sessions", app.Middleware.RequireUser(app.LiveHandler.HandleListLiveSessions))
+		r.Post("/live-sessions", app.Middleware.RequireUser(app.LiveHandler.HandleStartLiveSession))
+		r.Get("/live-sessions/{id}", app.Middleware.RequireUser(app.LiveHandler.HandleGetLiveSession))
+		r.Get("/live-sessions/{id}/ws", app.Middleware.RequireUser(app.LiveHandler.HandleLiveSessionSocket))
+		r.Post("/live-sessions/{id}/events", app.Middleware.RequireUser(app.LiveHandler.HandleLiveSessionEvent))
+		r.Post("/live-sessions/{id}/finish", app.Middleware.RequireUser(app.LiveHandler.HandleFinishLiveSession))
+		r.Delete("/live-sessions/{id}", app.Middleware.RequireUser(app.LiveHandler.HandleAbandonLiveSession))
+
+		r.Get("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleListWebhooks))
+		r.Post("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleCreateWebhook))
+		r.Get("/webhooks/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleGetWebhook))
+		r.Patch("/webhooks/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleUpdateWebhook))
+		r.Delete("/webhooks/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleDeleteWebhook))
+		r.Get("/webhooks/{id}/deliveries", app.Middleware.RequireUser(app.WebhookHandler.HandleListDeliveries))
+		r.Get("/webhooks/{id}/deliveries/{deliveryID}", app.Middleware.RequireUser(app.WebhookHandler.HandleGetDelivery))
+		r.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", app.Middleware.RequireUser(app.WebhookHandler.HandleRedeliver))
+
+		r.Get("/admin/jobs", app.Middleware.RequireAdmin(app.JobHandler.HandleListJobs))
+		r.Get("/admin/jobs/{id}", app.Middleware.RequireAdmin(app.JobHandler.HandleGetJob))
+		r.Post("/admin/jobs/{id}/retry", app.Middleware.RequireAdmin(app.JobHandler.HandleRetryJob))
+		r.Get("/admin/stats/daily", app.Middleware.RequireAdmin(app.StatsHandler.HandleDailyStats))
+
+		r.Get("/feed", app.Middleware.RequireUser(app.FollowHandler.HandleFeed))
+		r.Post("/users/{username}/follow", app.Middleware.RequireUser(app.FollowHandler.HandleFollow))
+		r.Delete("/users/{username}/follow", app.Middleware.RequireUser(app.FollowHandler.HandleUnfollow))
+		r.Get("/users/me/followers", app.Middleware.RequireUser(app.FollowHandler.HandleListFollowers))
+		r.Post("/users/me/followers/{id}/accept", app.Middleware.RequireUser(app.FollowHandler.HandleAcceptFollower))
+		r.Delete("/users/me/followers/{id}", app.Middleware.RequireUser(app.FollowHandler.HandleRemoveFollower))
+		r.Get("/users/me/following", app.Middleware.RequireUser(app.FollowHandler.HandleListFollowing))
+		r.Put("/users/me/privacy", app.Middleware.RequireUser(app.FollowHandler.HandleSetPrivacy))
+
+		r.Get("/events", app.Middleware.RequireUser(app.EventHandler.HandleEvents))
+
+		r.Post("/sync", app.Middleware.RequireUser(app.WorkoutHandler.HandleSync))
+
+		r.Post("/users/me/data-exports", app.Middleware.RequireUser(app.AccountHandler.HandleRequestDataExport))
+
+		r.Get("/users/me/data-exports/{id}", app.Middleware.RequireUser(app.AccountHandler.HandleGetDataExport))
+
+		r.Delete("/users/me", app.Middleware.RequireUser(app.AccountHandler.HandleEraseAccount))
 	})
 
 	r.Get("/health", app.HealthCheck)
 	r.Post("/users", app.UserHandler.HandleRegisterUser)
 	r.Post("/tokens/authentication", app.TokenHandler.HandlerCreateToken)
+	r.Get("/data-exports/{token}", app.AccountHandler.HandleDownloadDataExport)
+	r.Get("/shared/{token}", app.ShareHandler.HandleGetSharedWorkout)
 
 	return r
 }
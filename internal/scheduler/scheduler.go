@@ -0,0 +1,162 @@
+// Package scheduler runs periodic maintenance tasks on cron-like
+// schedules.
+//
+// Every instance runs a Scheduler, but only the one holding the leader
+// lock in Postgres runs tasks; the others wait to take over should it go
+// away. On top of that each run is claimed by its scheduled time, so a task
+// runs at most once per slot even across a change of leader. Missed slots
+// are not made up: a task next runs at its first slot after the leader
+// starts.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+const (
+	// electionInterval is how often a follower tries to become leader.
+	electionInterval = 30 * time.Second
+	// checkInterval is how often the leader makes sure it still is.
+	checkInterval = time.Minute
+)
+
+type task struct {
+	name     string
+	schedule *Schedule
+	run      func(ctx context.Context) error
+	next     time.Time
+}
+
+type Scheduler struct {
+	Store  store.SchedulerStore
+	Logger *log.Logger
+	// Location is the time zone schedules are read in.
+	Location *time.Location
+
+	tasks []*task
+}
+
+func New(schedulerStore store.SchedulerStore, logger *log.Logger) *Scheduler {
+	return &Scheduler{
+		Store:    schedulerStore,
+		Logger:   logger,
+		Location: time.UTC,
+	}
+}
+
+// Add registers fn to run on schedule. name identifies the task across
+// instances and restarts.
+func (s *Scheduler) Add(name string, schedule *Schedule, fn func(ctx context.Context) error) {
+	s.tasks = append(s.tasks, &task{name: name, schedule: schedule, run: fn})
+}
+
+// Run campaigns for leadership and runs tasks while leading, until ctx is
+// done.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		lead, err := s.Store.TryLead(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.Logger.Println("ERROR: schedulerTryLead:", err)
+		}
+		if lead != nil {
+			s.Logger.Println("INFO: scheduler is leading")
+			s.lead(ctx, lead)
+			err = lead.Release()
+			if err != nil {
+				s.Logger.Println("ERROR: schedulerRelease:", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(electionInterval):
+		}
+	}
+}
+
+// lead runs due tasks until ctx is done or the leadership is lost.
+func (s *Scheduler) lead(ctx context.Context, lead store.Leadership) {
+	now := time.Now().In(s.Location)
+	for _, t := range s.tasks {
+		t.next = t.schedule.Next(now)
+	}
+
+	for {
+		wake := time.Now().Add(checkInterval)
+		for _, t := range s.tasks {
+			if !t.next.IsZero() && t.next.Before(wake) {
+				wake = t.next
+			}
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := lead.Check(ctx)
+		if err != nil {
+			s.Logger.Println("ERROR: scheduler lost leadership:", err)
+			return
+		}
+		s.runDue(ctx, time.Now().In(s.Location))
+	}
+}
+
+// runDue runs the tasks due at now one after the other, each for the slot
+// it was due at.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	for _, t := range s.tasks {
+		if t.next.IsZero() || t.next.After(now) {
+			continue
+		}
+		slot := t.next
+		t.next = t.schedule.Next(now)
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := s.Store.ClaimTaskRun(t.name, slot)
+		if err != nil {
+			s.Logger.Printf("ERROR: claimTaskRun %s: %v", t.name, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		started := time.Now()
+		reason := ""
+		err = call(ctx, t)
+		if err != nil {
+			reason = err.Error()
+			s.Logger.Printf("ERROR: scheduled task %s: %v", t.name, err)
+		} else {
+			s.Logger.Printf("INFO: scheduled task %s done in %s", t.name, time.Since(started).Round(time.Millisecond))
+		}
+
+		err = s.Store.FinishTaskRun(t.name, slot, reason)
+		if err != nil {
+			s.Logger.Printf("ERROR: finishTaskRun %s: %v", t.name, err)
+		}
+	}
+}
+
+// call runs the task, turning a panic into an error.
+func call(ctx context.Context, t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.run(ctx)
+}
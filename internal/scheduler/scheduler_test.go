@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-03-10 12:00", "2026-03-10 12:01"},
+		{"*/15 * * * *", "2026-03-10 12:07", "2026-03-10 12:15"},
+		{"*/15 * * * *", "2026-03-10 12:45", "2026-03-10 13:00"},
+		{"5/20 * * * *", "2026-03-10 12:46", "2026-03-10 13:05"},
+		{"30 3 * * *", "2026-03-10 03:30", "2026-03-11 03:30"},
+		{"0 9-17/4 * * *", "2026-03-10 13:00", "2026-03-10 17:00"},
+		{"0,30 22 * * *", "2026-03-10 22:10", "2026-03-10 22:30"},
+		{"@hourly", "2026-12-31 23:59", "2027-01-01 00:00"},
+		{"@monthly", "2026-01-31 10:00", "2026-02-01 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		// Sunday, written as 7
+		{"0 12 * * 7", "2026-03-10 12:00", "2026-03-15 12:00"},
+		// weekdays
+		{"0 8 * * 1-5", "2026-03-13 09:00", "2026-03-16 08:00"},
+		// either day field matches when both are restricted
+		{"0 0 13 * 5", "2026-03-01 00:00", "2026-03-06 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" from "+tt.from, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, at(tt.want), s.Next(at(tt.from)))
+		})
+	}
+
+	assert.True(t, MustParse("0 0 30 2 *").Next(at("2026-01-01 00:00")).IsZero())
+}
+
+type memorySchedulerStore struct {
+	store.SchedulerStore
+
+	slots    map[string]time.Time
+	finished map[string]string
+}
+
+func (m *memorySchedulerStore) ClaimTaskRun(name string, slot time.Time) (bool, error) {
+	if last, ok := m.slots[name]; ok && !last.Before(slot) {
+		return false, nil
+	}
+	m.slots[name] = slot
+	return true, nil
+}
+
+func (m *memorySchedulerStore) FinishTaskRun(name string, slot time.Time, reason string) error {
+	m.finished[name] = reason
+	return nil
+}
+
+func TestRunDueRunsEachSlotOnce(t *testing.T) {
+	memory := &memorySchedulerStore{slots: map[string]time.Time{}, finished: map[string]string{}}
+	s := New(memory, log.New(io.Discard, "", 0))
+
+	var runs []string
+	s.Add("purge", MustParse("*/15 * * * *"), func(ctx context.Context) error {
+		runs = append(runs, "purge")
+		return nil
+	})
+	s.Add("refresh", MustParse("0 * * * *"), func(ctx context.Context) error {
+		runs = append(runs, "refresh")
+		return errors.New("view is gone")
+	})
+	s.Add("panics", MustParse("* * * * *"), func(ctx context.Context) error {
+		panic("oops")
+	})
+
+	start := at("2026-03-10 11:50")
+	for _, task := range s.tasks {
+		task.next = task.schedule.Next(start)
+	}
+
+	ctx := context.Background()
+	s.runDue(ctx, at("2026-03-10 11:55"))
+	assert.Empty(t, runs)
+	assert.Equal(t, "panic: oops", memory.finished["panics"])
+
+	s.runDue(ctx, at("2026-03-10 12:00"))
+	assert.Equal(t, []string{"purge", "refresh"}, runs)
+	assert.Equal(t, "", memory.finished["purge"])
+	assert.Equal(t, "view is gone", memory.finished["refresh"])
+	assert.Equal(t, at("2026-03-10 12:15"), s.tasks[0].next)
+
+	// another leader already ran the 12:15 slot
+	memory.slots["purge"] = at("2026-03-10 12:15")
+	s.runDue(ctx, at("2026-03-10 12:15"))
+	assert.Equal(t, []string{"purge", "refresh"}, runs)
+
+	// a late wake-up runs a task once, not once per missed slot
+	s.runDue(ctx, at("2026-03-10 13:20"))
+	assert.Equal(t, []string{"purge", "refresh", "purge", "refresh"}, runs)
+	assert.Equal(t, at("2026-03-10 13:30"), s.tasks[0].next)
+}
@@ -0,0 +1,387 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/tokens"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// JobBuildDataExport assembles the archive of a queued data export.
+const JobBuildDataExport = "data_export.build"
+
+// DataExportJobArgs are the arguments of JobBuildDataExport.
+type DataExportJobArgs struct {
+	ExportID int `json:"export_id"`
+	UserID   int `json:"user_id"`
+}
+
+type DataExport struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"-"`
+	Status         string     `json:"status"`
+	Archive        []byte     `json:"-"`
+	Error          string     `json:"error,omitempty"`
+	DownloadExpiry time.Time  `json:"download_expiry"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// userDataSections lists everything we hold about a user. Each query takes
+// the user ID and returns a single JSON value; the result ends up as
+// <name>.json in the data export archive. Tables that store user-owned data
+// must be added here.
+var userDataSections = []struct {
+	name  string
+	query string
+}{
+	{"profile", `
+		SELECT row_to_json(u) FROM (
+			SELECT id, username, email, bio, is_private, created_at, updated_at
+			FROM users WHERE id = $1
+		) u`},
+	{"workouts", `
+		SELECT COALESCE(json_agg(w ORDER BY w.created_at), '[]'::json) FROM (
+			SELECT id, title, description, duration_minutes, calories_burned, visibility, created_at, updated_at
+			FROM workouts WHERE user_id = $1
+		) w`},
+	{"workout_entries", `
+		SELECT COALESCE(json_agg(e ORDER BY e.workout_id, e.order_index), '[]'::json) FROM (
+			SELECT we.id, we.workout_id, we.group_id, we.exercise_name, we.sets, we.reps,
+			       we.duration_seconds, we.weight, we.notes, we.order_index, we.created_at
+			FROM workout_entries we
+			INNER JOIN workouts w ON w.id = we.workout_id
+			WHERE w.user_id = $1
+		) e`},
+	{"workout_entry_groups", `
+		SELECT COALESCE(json_agg(g ORDER BY g.workout_id, g.id), '[]'::json) FROM (
+			SELECT g.id, g.workout_id, g.kind, g.name, g.rounds, g.rest_seconds,
+			       g.exercise_rest_seconds, g.interval_seconds, g.time_cap_seconds, g.created_at
+			FROM workout_entry_groups g
+			INNER JOIN workouts w ON w.id = g.workout_id
+			WHERE w.user_id = $1
+		) g`},
+	{"workout_activities", `
+		SELECT COALESCE(json_agg(a), '[]'::json) FROM (
+			SELECT wa.* FROM workout_activities wa
+			INNER JOIN workouts w ON w.id = wa.workout_id
+			WHERE w.user_id = $1
+		) a`},
+	{"workout_revisions", `
+		SELECT COALESCE(json_agg(r ORDER BY r.workout_id, r.revision), '[]'::json) FROM (
+			SELECT wr.workout_id, wr.revision, wr.author_id, wr.snapshot, wr.created_at
+			FROM workout_revisions wr
+			INNER JOIN workouts w ON w.id = wr.workout_id
+			WHERE w.user_id = $1
+		) r`},
+	{"tags", `
+		SELECT COALESCE(json_agg(t ORDER BY t.id), '[]'::json) FROM (
+			SELECT id, name, color, created_at, updated_at FROM tags WHERE user_id = $1
+		) t`},
+	{"workout_tags", `
+		SELECT COALESCE(json_agg(wt ORDER BY wt.workout_id, wt.tag_id), '[]'::json) FROM (
+			SELECT wt.workout_id, wt.tag_id, wt.created_at
+			FROM workout_tags wt
+			INNER JOIN workouts w ON w.id = wt.workout_id
+			WHERE w.user_id = $1
+		) wt`},
+	{"live_sessions", `
+		SELECT COALESCE(json_agg(l ORDER BY l.id), '[]'::json) FROM (
+			SELECT id, template_workout_id, status, seq, state, workout_id, started_at, updated_at, ended_at
+			FROM live_sessions WHERE user_id = $1
+		) l`},
+	{"activity_events", `
+		SELECT COALESCE(json_agg(e ORDER BY e.id), '[]'::json) FROM (
+			SELECT id, workout_id, type, created_at FROM activity_events WHERE user_id = $1
+		) e`},
+	{"webhook_subscriptions", `
+		SELECT COALESCE(json_agg(s ORDER BY s.id), '[]'::json) FROM (
+			SELECT id, url, event_types, all_users, active, created_at, updated_at
+			FROM webhook_subscriptions WHERE user_id = $1
+		) s`},
+	{"follows", `
+		SELECT COALESCE(json_agg(f ORDER BY f.created_at), '[]'::json) FROM (
+			SELECT follower_id, followee_id, status, created_at, accepted_at
+			FROM follows WHERE follower_id = $1 OR followee_id = $1
+		) f`},
+	{"workout_comments", `
+		SELECT COALESCE(json_agg(c ORDER BY c.id), '[]'::json) FROM (
+			SELECT id, workout_id, entry_id, parent_id, body, created_at, updated_at, edited_at, deleted_at
+			FROM workout_comments WHERE user_id = $1
+		) c`},
+	{"workout_reactions", `
+		SELECT COALESCE(json_agg(r ORDER BY r.id), '[]'::json) FROM (
+			SELECT id, workout_id, entry_id, emoji, created_at
+			FROM workout_reactions WHERE user_id = $1
+		) r`},
+	{"workout_shares", `
+		SELECT COALESCE(json_agg(s ORDER BY s.id), '[]'::json) FROM (
+			SELECT id, workout_id, expires_at, revoked_at, created_at
+			FROM workout_shares WHERE user_id = $1
+		) s`},
+	{"tokens", `
+		SELECT COALESCE(json_agg(t ORDER BY t.expiry), '[]'::json) FROM (
+			SELECT scope, expiry FROM tokens WHERE user_id = $1
+		) t`},
+	{"data_exports", `
+		SELECT COALESCE(json_agg(d ORDER BY d.created_at), '[]'::json) FROM (
+			SELECT id, status, created_at, completed_at FROM data_exports WHERE user_id = $1
+		) d`},
+}
+
+// erasureCounts are recorded in erasure_log before the user row is deleted,
+// so we can show what an erasure removed without keeping the data itself.
+var erasureCounts = []struct {
+	name  string
+	query string
+}{
+	{"workouts", `SELECT COUNT(*) FROM workouts WHERE user_id = $1`},
+	{"workout_entries", `SELECT COUNT(*) FROM workout_entries we INNER JOIN workouts w ON w.id = we.workout_id WHERE w.user_id = $1`},
+	{"workout_entry_groups", `SELECT COUNT(*) FROM workout_entry_groups g INNER JOIN workouts w ON w.id = g.workout_id WHERE w.user_id = $1`},
+	{"workout_revisions", `SELECT COUNT(*) FROM workout_revisions wr INNER JOIN workouts w ON w.id = wr.workout_id WHERE w.user_id = $1`},
+	{"tokens", `SELECT COUNT(*) FROM tokens WHERE user_id = $1`},
+	{"data_exports", `SELECT COUNT(*) FROM data_exports WHERE user_id = $1`},
+	{"idempotency_keys", `SELECT COUNT(*) FROM idempotency_keys WHERE user_id = $1`},
+	{"workout_changes", `SELECT COUNT(*) FROM workout_changes WHERE user_id = $1`},
+	{"tags", `SELECT COUNT(*) FROM tags WHERE user_id = $1`},
+	{"workout_tags", `SELECT COUNT(*) FROM workout_tags wt INNER JOIN workouts w ON w.id = wt.workout_id WHERE w.user_id = $1`},
+	{"live_sessions", `SELECT COUNT(*) FROM live_sessions WHERE user_id = $1`},
+	{"activity_events", `SELECT COUNT(*) FROM activity_events WHERE user_id = $1`},
+	{"webhook_subscriptions", `SELECT COUNT(*) FROM webhook_subscriptions WHERE user_id = $1`},
+	{"webhook_deliveries", `SELECT COUNT(*) FROM webhook_deliveries d INNER JOIN webhook_subscriptions s ON s.id = d.subscription_id WHERE s.user_id = $1 OR d.user_id = $1`},
+	{"outbox", `SELECT COUNT(*) FROM outbox WHERE user_id = $1`},
+	{"follows", `SELECT COUNT(*) FROM follows WHERE follower_id = $1 OR followee_id = $1`},
+	{"workout_comments", `SELECT COUNT(*) FROM workout_comments WHERE user_id = $1`},
+	{"workout_reactions", `SELECT COUNT(*) FROM workout_reactions WHERE user_id = $1`},
+	{"workout_shares", `SELECT COUNT(*) FROM workout_shares WHERE user_id = $1`},
+}
+
+type PostgresAccountStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAccountStore(db *sql.DB) *PostgresAccountStore {
+	return &PostgresAccountStore{db: db}
+}
+
+type AccountStore interface {
+	CreateDataExport(userID int, ttl time.Duration) (*DataExport, *tokens.Token, error)
+	GetDataExport(id int64, userID int) (*DataExport, error)
+	GetDataExportByToken(plaintext string) (*DataExport, error)
+	CompleteDataExport(id int, archive []byte) error
+	FailDataExport(id int, reason string) error
+	CollectUserData(userID int) (map[string]json.RawMessage, error)
+	EraseUser(userID int) (map[string]int64, error)
+	PurgeExpiredDataExports() (int64, error)
+}
+
+// CreateDataExport queues an export, with the job that builds it, and
+// issues the token its archive can be downloaded with. Only the token hash
+// is stored.
+func (s *PostgresAccountStore) CreateDataExport(userID int, ttl time.Duration) (*DataExport, *tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, tokens.ScopeDataExport)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO data_exports (user_id, status, download_hash, download_expiry)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	export := &DataExport{
+		UserID:         userID,
+		Status:         DataExportPending,
+		DownloadExpiry: token.Expiry,
+	}
+	err = tx.QueryRow(query, userID, DataExportPending, token.Hash, token.Expiry).Scan(&export.ID, &export.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args, err := json.Marshal(DataExportJobArgs{ExportID: export.ID, UserID: userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = insertJob(tx, &Job{Type: JobBuildDataExport, Args: args})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return export, token, nil
+}
+
+func (s *PostgresAccountStore) GetDataExport(id int64, userID int) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, COALESCE(error, ''), download_expiry, created_at, completed_at
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2
+	`
+
+	export := &DataExport{}
+	err := s.db.QueryRow(query, id, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Error,
+		&export.DownloadExpiry,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// GetDataExportByToken returns the export, archive included, for a download
+// token that has not expired yet.
+func (s *PostgresAccountStore) GetDataExportByToken(plaintext string) (*DataExport, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		SELECT id, user_id, status, archive, download_expiry, created_at, completed_at
+		FROM data_exports
+		WHERE download_hash = $1 AND download_expiry > $2
+	`
+
+	export := &DataExport{}
+	err := s.db.QueryRow(query, hash[:], time.Now()).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Archive,
+		&export.DownloadExpiry,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *PostgresAccountStore) CompleteDataExport(id int, archive []byte) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, archive = $2, completed_at = NOW()
+		WHERE id = $3
+	`
+	_, err := s.db.Exec(query, DataExportReady, archive, id)
+	return err
+}
+
+func (s *PostgresAccountStore) FailDataExport(id int, reason string) error {
+	query := `
+		UPDATE data_exports
+		SET status = $1, error = $2, completed_at = NOW()
+		WHERE id = $3
+	`
+	_, err := s.db.Exec(query, DataExportFailed, reason, id)
+	return err
+}
+
+// CollectUserData runs every section query inside one read-only
+// transaction so the archive is a consistent snapshot.
+func (s *PostgresAccountStore) CollectUserData(userID int) (map[string]json.RawMessage, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	data := map[string]json.RawMessage{}
+	for _, section := range userDataSections {
+		var value []byte
+		err = tx.QueryRow(section.query, userID).Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		data[section.name] = value
+	}
+
+	return data, tx.Commit()
+}
+
+// EraseUser hard-deletes the user and, through ON DELETE CASCADE, every row
+// they own, including webhook deliveries of their events queued for other
+// users' subscriptions. The per-table counts are written to erasure_log and
+// returned.
+func (s *PostgresAccountStore) EraseUser(userID int) (map[string]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := map[string]int64{}
+	for _, c := range erasureCounts {
+		var n int64
+		err = tx.QueryRow(c.query, userID).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		counts[c.name] = n
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	counts["users"] = rowsAffected
+
+	logged, err := json.Marshal(counts)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO erasure_log (user_id, erased_records) VALUES ($1, $2)`, userID, logged)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, tx.Commit()
+}
+
+// PurgeExpiredDataExports deletes exports, archive and all, once their
+// download link has expired.
+func (s *PostgresAccountStore) PurgeExpiredDataExports() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM data_exports WHERE download_expiry < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
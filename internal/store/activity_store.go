@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of activity events.
+const (
+	EventWorkoutCreated = "workout.created"
+	EventWorkoutUpdated = "workout.updated"
+	EventWorkoutDeleted = "workout.deleted"
+)
+
+// ErrInvalidEventPosition is returned when parsing an event ID that this
+// server didn't hand out.
+var ErrInvalidEventPosition = errors.New("invalid event id")
+
+// ActivityEvent is an entry of the activity log: UserID's workout was
+// created, updated or moved to the trash.
+type ActivityEvent struct {
+	Position   EventPosition `json:"-"`
+	Type       string        `json:"type"`
+	UserID     int           `json:"user_id"`
+	WorkoutID  int           `json:"workout_id"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// EventPosition is a place in the activity log. Events are ordered by the
+// transaction that wrote them, then by id; its string form is the event ID
+// clients resume from.
+type EventPosition struct {
+	TxID int64
+	ID   int64
+}
+
+func (p EventPosition) String() string {
+	return strconv.FormatInt(p.TxID, 10) + "-" + strconv.FormatInt(p.ID, 10)
+}
+
+// ParseEventPosition reads a position written by EventPosition.String.
+func ParseEventPosition(s string) (EventPosition, error) {
+	txID, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return EventPosition{}, ErrInvalidEventPosition
+	}
+	var (
+		p   EventPosition
+		err error
+	)
+	p.TxID, err = strconv.ParseInt(txID, 10, 64)
+	if err != nil {
+		return EventPosition{}, fmt.Errorf("%w: %v", ErrInvalidEventPosition, err)
+	}
+	p.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return EventPosition{}, fmt.Errorf("%w: %v", ErrInvalidEventPosition, err)
+	}
+	return p, nil
+}
+
+type PostgresActivityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresActivityStore(db *sql.DB) *PostgresActivityStore {
+	return &PostgresActivityStore{db: db}
+}
+
+type ActivityStore interface {
+	CurrentEventPosition() (EventPosition, error)
+	ListActivityEvents(viewerID int, after EventPosition, limit int) ([]*ActivityEvent, error)
+}
+
+// CurrentEventPosition returns the position a new reader starts from: past
+// every event already committed, before every event still to come.
+func (s *PostgresActivityStore) CurrentEventPosition() (EventPosition, error) {
+	var xmin int64
+	err := s.db.QueryRow(`SELECT txid_snapshot_xmin(txid_current_snapshot())`).Scan(&xmin)
+	if err != nil {
+		return EventPosition{}, err
+	}
+	return EventPosition{TxID: xmin - 1, ID: math.MaxInt64}, nil
+}
+
+// ListActivityEvents returns up to limit events the viewer may see after
+// the given position, oldest first: those of the viewer's own workouts,
+// and of workouts the users they follow share with followers or made
+// public.
+//
+// Ids are handed out before commit, so a later id can become visible
+// before an earlier one. Only events of transactions older than the
+// oldest running one are returned: that set no longer changes, and paging
+// through it by position can't skip an event.
+func (s *PostgresActivityStore) ListActivityEvents(viewerID int, after EventPosition, limit int) ([]*ActivityEvent, error) {
+	query := `
+		SELECT e.tx_id, e.id, e.type, e.user_id, e.workout_id, e.created_at
+		FROM activity_events e
+		WHERE e.user_id IN (
+		      SELECT $1::bigint
+		      UNION
+		      SELECT followee_id FROM follows WHERE follower_id = $1 AND status = 'accepted')
+		  AND (e.user_id = $1 OR EXISTS (
+		      SELECT 1 FROM workouts w
+		      WHERE w.id = e.workout_id AND w.visibility IN ('followers', 'public')))
+		  AND (e.tx_id, e.id) > ($2, $3)
+		  AND e.tx_id < txid_snapshot_xmin(txid_current_snapshot())
+		ORDER BY e.tx_id, e.id
+		LIMIT $4
+	`
+	rows, err := s.db.Query(query, viewerID, after.TxID, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*ActivityEvent{}
+	for rows.Next() {
+		event := &ActivityEvent{}
+		err = rows.Scan(
+			&event.Position.TxID,
+			&event.Position.ID,
+			&event.Type,
+			&event.UserID,
+			&event.WorkoutID,
+			&event.OccurredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// workoutEventType names the write recordWorkoutChange is recording. It
+// must run before the change itself is recorded: a workout without
+// earlier changes has just been created.
+func workoutEventType(tx *sql.Tx, workoutID int, deleted bool) (string, error) {
+	if deleted {
+		return EventWorkoutDeleted, nil
+	}
+	var changed bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM workout_changes WHERE workout_id = $1)`, workoutID).Scan(&changed)
+	if err != nil {
+		return "", err
+	}
+	if changed {
+		return EventWorkoutUpdated, nil
+	}
+	return EventWorkoutCreated, nil
+}
+
+func recordActivityEvent(tx *sql.Tx, eventType string, userID int64, workoutID int) error {
+	query := `INSERT INTO activity_events (user_id, workout_id, type) VALUES ($1, $2, $3)`
+	_, err := tx.Exec(query, userID, workoutID, eventType)
+	return err
+}
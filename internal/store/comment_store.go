@@ -0,0 +1,355 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrCommentNotFound is returned when a reply refers to a comment that is
+// not on the same workout or was deleted.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Comment is a comment on a workout, or on one of its entries when EntryID
+// is set. Replies are filled in when listing threads. Deleted comments that
+// still have replies are listed with Deleted set and an empty body.
+type Comment struct {
+	ID        int64      `json:"id"`
+	WorkoutID int64      `json:"workout_id"`
+	EntryID   *int64     `json:"entry_id,omitempty"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	Author    UserRef    `json:"author"`
+	Body      string     `json:"body"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+// Reaction is one user's emoji on a workout or one of its entries.
+type Reaction struct {
+	WorkoutID int64     `json:"workout_id"`
+	EntryID   *int64    `json:"entry_id,omitempty"`
+	UserID    int       `json:"-"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionCount sums up the reactions with one emoji. Reacted tells
+// whether the user asking is among them.
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{db: db}
+}
+
+type CommentStore interface {
+	ListComments(workoutID int64, entryID *int64, limit, offset int) ([]*Comment, error)
+	GetComment(workoutID, commentID int64) (*Comment, error)
+	CreateComment(comment *Comment) error
+	UpdateComment(comment *Comment) error
+	DeleteComment(workoutID, commentID int64) error
+	AddReaction(reaction *Reaction) (bool, error)
+	RemoveReaction(reaction *Reaction) error
+	ListReactions(workoutID int64, entryID *int64, userID int) ([]ReactionCount, error)
+}
+
+const commentColumns = `c.id, c.workout_id, c.entry_id, c.parent_id, u.id, u.username, c.body, c.created_at, c.updated_at, c.edited_at, c.deleted_at`
+
+// ListComments returns a page of the workout's threads, oldest first, each
+// with all its replies. entryID narrows the threads to those on one entry.
+func (s *PostgresCommentStore) ListComments(workoutID int64, entryID *int64, limit, offset int) ([]*Comment, error) {
+	query := `
+		WITH RECURSIVE roots AS (
+			SELECT r.id
+			FROM workout_comments r
+			WHERE r.workout_id = $1 AND r.parent_id IS NULL
+			  AND ($2::bigint IS NULL OR r.entry_id = $2)
+			  AND (r.deleted_at IS NULL OR EXISTS (SELECT 1 FROM workout_comments x WHERE x.parent_id = r.id))
+			ORDER BY r.created_at, r.id
+			LIMIT $3 OFFSET $4
+		), thread AS (
+			SELECT wc.* FROM workout_comments wc INNER JOIN roots ON roots.id = wc.id
+			UNION ALL
+			SELECT wc.* FROM workout_comments wc INNER JOIN thread t ON wc.parent_id = t.id
+		)
+		SELECT ` + commentColumns + `
+		FROM thread c
+		INNER JOIN users u ON u.id = c.user_id
+		ORDER BY c.created_at, c.id
+	`
+	rows, err := s.db.Query(query, workoutID, entryID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return threadComments(comments), nil
+}
+
+// GetComment returns a comment of the workout, without its replies. Deleted
+// comments are reported as sql.ErrNoRows.
+func (s *PostgresCommentStore) GetComment(workoutID, commentID int64) (*Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM workout_comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1 AND c.workout_id = $2 AND c.deleted_at IS NULL
+	`
+	return scanComment(s.db.QueryRow(query, commentID, workoutID))
+}
+
+// CreateComment stores the comment authored by comment.Author.ID. A reply
+// is on the same entry as its parent; it returns ErrCommentNotFound when the
+// parent is not a live comment of the workout, and ErrEntryNotFound when
+// EntryID is not an entry of the workout.
+func (s *PostgresCommentStore) CreateComment(comment *Comment) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if comment.ParentID != nil {
+		query := `SELECT entry_id FROM workout_comments WHERE id = $1 AND workout_id = $2 AND deleted_at IS NULL`
+		err = tx.QueryRow(query, *comment.ParentID, comment.WorkoutID).Scan(&comment.EntryID)
+		if err == sql.ErrNoRows {
+			return ErrCommentNotFound
+		}
+		if err != nil {
+			return err
+		}
+	} else if comment.EntryID != nil {
+		err = checkWorkoutEntry(tx, comment.WorkoutID, *comment.EntryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO workout_comments (workout_id, entry_id, parent_id, user_id, body)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRow(query, comment.WorkoutID, comment.EntryID, comment.ParentID, comment.Author.ID, comment.Body).
+		Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateComment replaces the body of a live comment and marks it edited.
+func (s *PostgresCommentStore) UpdateComment(comment *Comment) error {
+	query := `
+		UPDATE workout_comments
+		SET body = $3, updated_at = NOW(), edited_at = NOW()
+		WHERE id = $1 AND workout_id = $2 AND deleted_at IS NULL
+		RETURNING updated_at, edited_at
+	`
+	return s.db.QueryRow(query, comment.ID, comment.WorkoutID, comment.Body).Scan(&comment.UpdatedAt, &comment.EditedAt)
+}
+
+// DeleteComment marks the comment deleted and drops its body. Its replies
+// are kept. It returns sql.ErrNoRows when there is no such live comment.
+func (s *PostgresCommentStore) DeleteComment(workoutID, commentID int64) error {
+	query := `
+		UPDATE workout_comments
+		SET body = '', updated_at = NOW(), deleted_at = NOW()
+		WHERE id = $1 AND workout_id = $2 AND deleted_at IS NULL
+	`
+	return execAffectingOne(s.db, query, commentID, workoutID)
+}
+
+// AddReaction stores the reaction. It returns false, with the reaction as
+// first stored, when the user already reacted that way, and
+// ErrEntryNotFound when EntryID is not an entry of the workout.
+func (s *PostgresCommentStore) AddReaction(reaction *Reaction) (bool, error) {
+	if reaction.EntryID != nil {
+		err := checkWorkoutEntry(s.db, reaction.WorkoutID, *reaction.EntryID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	query := `
+		INSERT INTO workout_reactions (workout_id, entry_id, user_id, emoji)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workout_id, COALESCE(entry_id, 0), user_id, emoji) DO NOTHING
+		RETURNING created_at
+	`
+	err := s.db.QueryRow(query, reaction.WorkoutID, reaction.EntryID, reaction.UserID, reaction.Emoji).Scan(&reaction.CreatedAt)
+	if err != sql.ErrNoRows {
+		return err == nil, err
+	}
+
+	query = `
+		SELECT created_at FROM workout_reactions
+		WHERE workout_id = $1 AND COALESCE(entry_id, 0) = COALESCE($2::bigint, 0) AND user_id = $3 AND emoji = $4
+	`
+	err = s.db.QueryRow(query, reaction.WorkoutID, reaction.EntryID, reaction.UserID, reaction.Emoji).Scan(&reaction.CreatedAt)
+	return false, err
+}
+
+// RemoveReaction takes back the user's reaction. It returns sql.ErrNoRows
+// when there was none.
+func (s *PostgresCommentStore) RemoveReaction(reaction *Reaction) error {
+	query := `
+		DELETE FROM workout_reactions
+		WHERE workout_id = $1 AND COALESCE(entry_id, 0) = COALESCE($2::bigint, 0) AND user_id = $3 AND emoji = $4
+	`
+	return execAffectingOne(s.db, query, reaction.WorkoutID, reaction.EntryID, reaction.UserID, reaction.Emoji)
+}
+
+// ListReactions counts the reactions on the workout, or on one of its
+// entries, most used emoji first.
+func (s *PostgresCommentStore) ListReactions(workoutID int64, entryID *int64, userID int) ([]ReactionCount, error) {
+	query := `
+		SELECT emoji, COUNT(*), BOOL_OR(user_id = $3)
+		FROM workout_reactions
+		WHERE workout_id = $1 AND COALESCE(entry_id, 0) = COALESCE($2::bigint, 0)
+		GROUP BY emoji
+		ORDER BY COUNT(*) DESC, MIN(created_at)
+	`
+	rows, err := s.db.Query(query, workoutID, entryID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []ReactionCount{}
+	for rows.Next() {
+		var count ReactionCount
+		err = rows.Scan(&count.Emoji, &count.Count, &count.Reacted)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// checkWorkoutEntry returns ErrEntryNotFound unless entryID is an entry of
+// the workout.
+func checkWorkoutEntry(q querier, workoutID, entryID int64) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM workout_entries WHERE id = $1 AND workout_id = $2)`
+	err := q.QueryRow(query, entryID, workoutID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// queryFeedbackCounts returns the number of live comments on the workout,
+// entries included, and its reactions by emoji, entries excluded.
+func queryFeedbackCounts(q querier, workoutID int64) (int, map[string]int, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM workout_comments WHERE workout_id = $1 AND deleted_at IS NULL),
+		       COALESCE((
+		           SELECT json_object_agg(emoji, n) FROM (
+		               SELECT emoji, COUNT(*) AS n FROM workout_reactions
+		               WHERE workout_id = $1 AND entry_id IS NULL
+		               GROUP BY emoji
+		           ) r), '{}'::json)
+	`
+	var (
+		comments  int
+		reactions []byte
+	)
+	err := q.QueryRow(query, workoutID).Scan(&comments, &reactions)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	counts := map[string]int{}
+	err = json.Unmarshal(reactions, &counts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return comments, counts, nil
+}
+
+// threadComments nests comments, given oldest first, under their parents
+// and returns the top level ones. Deleted comments are dropped unless a
+// live reply hangs below them.
+func threadComments(comments []*Comment) []*Comment {
+	byID := make(map[int64]*Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	roots := []*Comment{}
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			if parent, ok := byID[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, comment)
+				continue
+			}
+		}
+		roots = append(roots, comment)
+	}
+
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(comments []*Comment) []*Comment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = pruneDeleted(comment.Replies)
+		if comment.Deleted && len(comment.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func scanComment(row rowScanner) (*Comment, error) {
+	comment := &Comment{}
+	var deletedAt *time.Time
+	err := row.Scan(
+		&comment.ID,
+		&comment.WorkoutID,
+		&comment.EntryID,
+		&comment.ParentID,
+		&comment.Author.ID,
+		&comment.Author.Username,
+		&comment.Body,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.EditedAt,
+		&deletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	comment.Deleted = deletedAt != nil
+	return comment, nil
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadComments(t *testing.T) {
+	comment := func(id int64, parent int64, deleted bool) *Comment {
+		c := &Comment{ID: id, Deleted: deleted}
+		if parent != 0 {
+			c.ParentID = &parent
+		}
+		return c
+	}
+
+	// 1 <- 2 <- 3, deleted 4 <- 5, deleted 6 <- deleted 7, 8 whose parent was erased
+	threads := threadComments([]*Comment{
+		comment(1, 0, false),
+		comment(2, 1, false),
+		comment(4, 0, true),
+		comment(3, 2, false),
+		comment(5, 4, false),
+		comment(6, 0, true),
+		comment(7, 6, true),
+		comment(8, 99, false),
+	})
+
+	require.Len(t, threads, 3)
+	assert.Equal(t, int64(1), threads[0].ID)
+	require.Len(t, threads[0].Replies, 1)
+	assert.Equal(t, int64(2), threads[0].Replies[0].ID)
+	require.Len(t, threads[0].Replies[0].Replies, 1)
+	assert.Equal(t, int64(3), threads[0].Replies[0].Replies[0].ID)
+
+	assert.Equal(t, int64(4), threads[1].ID)
+	assert.True(t, threads[1].Deleted)
+	require.Len(t, threads[1].Replies, 1)
+
+	assert.Equal(t, int64(8), threads[2].ID)
+	assert.Empty(t, threads[2].Replies)
+
+	assert.NotNil(t, threadComments(nil))
+}
+
+func TestWorkoutComments(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	workouts := NewPostgresWorkoutStore(db)
+	comments := NewPostgresCommentStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, workouts, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+	)
+	workoutID := int64(workout.ID)
+	entryID := int64(workout.Entries[0].ID)
+
+	root := &Comment{WorkoutID: workoutID, EntryID: &entryID, Author: UserRef{ID: user.ID}, Body: "new PR?"}
+	require.NoError(t, comments.CreateComment(root))
+	reply := &Comment{WorkoutID: workoutID, ParentID: &root.ID, Author: UserRef{ID: user.ID}, Body: "yes"}
+	require.NoError(t, comments.CreateComment(reply))
+	require.NotNil(t, reply.EntryID)
+	assert.Equal(t, entryID, *reply.EntryID)
+
+	missing := entryID + 1000
+	err := comments.CreateComment(&Comment{WorkoutID: workoutID, EntryID: &missing, Author: UserRef{ID: user.ID}, Body: "?"})
+	assert.ErrorIs(t, err, ErrEntryNotFound)
+
+	require.NoError(t, comments.DeleteComment(workoutID, root.ID))
+	err = comments.DeleteComment(workoutID, root.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	threads, err := comments.ListComments(workoutID, &entryID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, threads, 1)
+	assert.True(t, threads[0].Deleted)
+	assert.Empty(t, threads[0].Body)
+	require.Len(t, threads[0].Replies, 1)
+	assert.Equal(t, "yes", threads[0].Replies[0].Body)
+
+	commented, err := workouts.GetWorkoutByID(workoutID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, commented.CommentCount)
+	assert.Equal(t, workout.Version, commented.Version)
+}
+
+func TestWorkoutReactions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	workouts := NewPostgresWorkoutStore(db)
+	comments := NewPostgresCommentStore(db)
+	user := createTestUser(t, db, "melkey")
+	other := createTestUser(t, db, "prime")
+	workout := createTestWorkout(t, workouts, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+	)
+	workoutID := int64(workout.ID)
+	entryID := int64(workout.Entries[0].ID)
+
+	react := func(userID int, entryID *int64, emoji string) bool {
+		added, err := comments.AddReaction(&Reaction{WorkoutID: workoutID, EntryID: entryID, UserID: userID, Emoji: emoji})
+		require.NoError(t, err)
+		return added
+	}
+	assert.True(t, react(user.ID, nil, "🔥"))
+	assert.True(t, react(other.ID, nil, "🔥"))
+	assert.False(t, react(other.ID, nil, "🔥"))
+	assert.True(t, react(other.ID, nil, "💪"))
+	assert.True(t, react(other.ID, &entryID, "🔥"))
+
+	counts, err := comments.ListReactions(workoutID, nil, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []ReactionCount{
+		{Emoji: "🔥", Count: 2, Reacted: true},
+		{Emoji: "💪", Count: 1, Reacted: false},
+	}, counts)
+
+	counts, err = comments.ListReactions(workoutID, &entryID, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []ReactionCount{{Emoji: "🔥", Count: 1, Reacted: true}}, counts)
+
+	require.NoError(t, comments.RemoveReaction(&Reaction{WorkoutID: workoutID, UserID: other.ID, Emoji: "💪"}))
+	reacted, err := workouts.GetWorkoutByID(workoutID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"🔥": 2}, reacted.Reactions)
+}
@@ -0,0 +1,291 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Follow statuses. Following a private account is pending until its owner
+// accepts.
+const (
+	FollowPending  = "pending"
+	FollowAccepted = "accepted"
+)
+
+// UserRef identifies another user without exposing their profile.
+type UserRef struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// Follow is one side of a follow relationship: User is the follower when
+// listing followers and the followed user when listing follows.
+type Follow struct {
+	User       UserRef    `json:"user"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// FeedItem is a followed user's workout with its summary numbers. Volume is
+// computed as in WorkoutStats.
+type FeedItem struct {
+	WorkoutID       int       `json:"workout_id"`
+	Author          UserRef   `json:"author"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	Visibility      string    `json:"visibility"`
+	DurationMinutes int       `json:"duration_minutes"`
+	CaloriesBurned  int       `json:"calories_burned"`
+	EntryCount      int       `json:"entry_count"`
+	TotalVolume     float64   `json:"total_volume"`
+	CommentCount    int       `json:"comment_count"`
+	ReactionCount   int       `json:"reaction_count"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type PostgresFollowStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFollowStore(db *sql.DB) *PostgresFollowStore {
+	return &PostgresFollowStore{db: db}
+}
+
+type FollowStore interface {
+	Follow(followerID int, username string) (*Follow, error)
+	Unfollow(followerID int, username string) error
+	ListFollowers(userID int, status string, limit, offset int) ([]*Follow, error)
+	ListFollowing(userID int, limit, offset int) ([]*Follow, error)
+	AcceptFollower(userID, followerID int) (*Follow, error)
+	RemoveFollower(userID, followerID int) error
+	IsFollowing(followerID, followeeID int) (bool, error)
+	SetPrivate(userID int, private bool) (int64, error)
+	ListFeed(userID int, limit, offset int) ([]*FeedItem, error)
+}
+
+// Follow makes followerID follow the user with that username: right away
+// for public accounts, pending approval for private ones. Following again
+// returns the existing follow unchanged. It returns sql.ErrNoRows when there
+// is no such user.
+func (s *PostgresFollowStore) Follow(followerID int, username string) (*Follow, error) {
+	query := `
+		INSERT INTO follows (follower_id, followee_id, status, accepted_at)
+		SELECT $1, u.id, CASE WHEN u.is_private THEN 'pending' ELSE 'accepted' END,
+		       CASE WHEN u.is_private THEN NULL ELSE NOW() END
+		FROM users u
+		WHERE u.username = $2
+		ON CONFLICT (follower_id, followee_id) DO UPDATE SET status = follows.status
+		RETURNING followee_id, status, created_at, accepted_at
+	`
+	follow := &Follow{User: UserRef{Username: username}}
+	err := s.db.QueryRow(query, followerID, username).
+		Scan(&follow.User.ID, &follow.Status, &follow.CreatedAt, &follow.AcceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
+
+// Unfollow stops following the user, or withdraws a pending request. It
+// returns sql.ErrNoRows when followerID didn't follow them.
+func (s *PostgresFollowStore) Unfollow(followerID int, username string) error {
+	query := `
+		DELETE FROM follows f
+		USING users u
+		WHERE u.id = f.followee_id AND f.follower_id = $1 AND u.username = $2
+	`
+	return execAffectingOne(s.db, query, followerID, username)
+}
+
+// ListFollowers returns the users following userID, newest first. status
+// narrows them to pending requests or accepted followers; "" lists both.
+func (s *PostgresFollowStore) ListFollowers(userID int, status string, limit, offset int) ([]*Follow, error) {
+	query := `
+		SELECT u.id, u.username, f.status, f.created_at, f.accepted_at
+		FROM follows f
+		INNER JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = $1 AND ($2 = '' OR f.status = $2)
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $3 OFFSET $4
+	`
+	return s.queryFollows(query, userID, status, limit, offset)
+}
+
+// ListFollowing returns the users userID follows or asked to follow,
+// newest first.
+func (s *PostgresFollowStore) ListFollowing(userID int, limit, offset int) ([]*Follow, error) {
+	query := `
+		SELECT u.id, u.username, f.status, f.created_at, f.accepted_at
+		FROM follows f
+		INNER JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $2 OFFSET $3
+	`
+	return s.queryFollows(query, userID, limit, offset)
+}
+
+// AcceptFollower approves a pending request to follow userID. Accepting an
+// already accepted follower is a no-op. It returns sql.ErrNoRows when
+// followerID neither follows nor asked to follow userID.
+func (s *PostgresFollowStore) AcceptFollower(userID, followerID int) (*Follow, error) {
+	query := `
+		UPDATE follows f
+		SET status = 'accepted', accepted_at = COALESCE(f.accepted_at, NOW())
+		FROM users u
+		WHERE u.id = f.follower_id AND f.followee_id = $1 AND f.follower_id = $2
+		RETURNING u.id, u.username, f.status, f.created_at, f.accepted_at
+	`
+	follow := &Follow{}
+	err := s.db.QueryRow(query, userID, followerID).
+		Scan(&follow.User.ID, &follow.User.Username, &follow.Status, &follow.CreatedAt, &follow.AcceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
+
+// RemoveFollower rejects a pending request or removes an accepted
+// follower. It returns sql.ErrNoRows when there is neither.
+func (s *PostgresFollowStore) RemoveFollower(userID, followerID int) error {
+	query := `DELETE FROM follows WHERE followee_id = $1 AND follower_id = $2`
+	return execAffectingOne(s.db, query, userID, followerID)
+}
+
+// IsFollowing reports whether followerID is an accepted follower of
+// followeeID.
+func (s *PostgresFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM follows
+			WHERE follower_id = $1 AND followee_id = $2 AND status = 'accepted'
+		)
+	`
+	var following bool
+	err := s.db.QueryRow(query, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+// SetPrivate switches the account between public and private. Making it
+// public accepts every pending request, since those no longer need
+// approval; the number accepted is returned.
+func (s *PostgresFollowStore) SetPrivate(userID int, private bool) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET is_private = $2, updated_at = NOW() WHERE id = $1`, userID, private)
+	if err != nil {
+		return 0, err
+	}
+
+	var accepted int64
+	if !private {
+		result, err := tx.Exec(`
+			UPDATE follows SET status = 'accepted', accepted_at = NOW()
+			WHERE followee_id = $1 AND status = 'pending'
+		`, userID)
+		if err != nil {
+			return 0, err
+		}
+		accepted, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return accepted, tx.Commit()
+}
+
+// ListFeed returns the workouts of the users userID follows, newest first.
+// Only accepted follows count, and only workouts their owners shared with
+// followers or made public.
+func (s *PostgresFollowStore) ListFeed(userID int, limit, offset int) ([]*FeedItem, error) {
+	query := `
+		SELECT w.id, u.id, u.username, w.title, COALESCE(w.description, ''), w.visibility,
+		       w.duration_minutes, COALESCE(w.calories_burned, 0),
+		       (SELECT COUNT(*) FROM workout_entries we WHERE we.workout_id = w.id),
+		       COALESCE((
+		           SELECT SUM(we.sets * we.reps * we.weight)
+		           FROM workout_entries we WHERE we.workout_id = w.id), 0),
+		       (SELECT COUNT(*) FROM workout_comments wc WHERE wc.workout_id = w.id AND wc.deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM workout_reactions wr WHERE wr.workout_id = w.id AND wr.entry_id IS NULL),
+		       w.created_at
+		FROM follows f
+		INNER JOIN workouts w ON w.user_id = f.followee_id
+		INNER JOIN users u ON u.id = w.user_id
+		WHERE f.follower_id = $1 AND f.status = 'accepted'
+		  AND w.deleted_at IS NULL AND w.visibility IN ('followers', 'public')
+		ORDER BY w.created_at DESC, w.id DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*FeedItem{}
+	for rows.Next() {
+		var item FeedItem
+		err = rows.Scan(
+			&item.WorkoutID,
+			&item.Author.ID,
+			&item.Author.Username,
+			&item.Title,
+			&item.Description,
+			&item.Visibility,
+			&item.DurationMinutes,
+			&item.CaloriesBurned,
+			&item.EntryCount,
+			&item.TotalVolume,
+			&item.CommentCount,
+			&item.ReactionCount,
+			&item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (s *PostgresFollowStore) queryFollows(query string, args ...any) ([]*Follow, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []*Follow{}
+	for rows.Next() {
+		var follow Follow
+		err = rows.Scan(&follow.User.ID, &follow.User.Username, &follow.Status, &follow.CreatedAt, &follow.AcceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		follows = append(follows, &follow)
+	}
+	return follows, rows.Err()
+}
+
+// execAffectingOne runs a statement meant to change one row and returns
+// sql.ErrNoRows when it changed none.
+func execAffectingOne(q querier, query string, args ...any) error {
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is a request made with an Idempotency-Key and, once the
+// handler finished, the response it produced. StatusCode is 0 while the
+// original request is still in flight.
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint []byte
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+type PostgresIdempotencyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdempotencyStore(db *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(record *IdempotencyRecord, window time.Duration) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(record *IdempotencyRecord) error
+	ReleaseIdempotencyKey(userID int, key string) error
+	PurgeIdempotencyKeys(window time.Duration) (int64, error)
+}
+
+// ReserveIdempotencyKey claims record.Key for the user. It returns nil when
+// the key was free (or its previous use is older than window) and the
+// caller should run the request; otherwise it returns the existing record.
+func (s *PostgresIdempotencyStore) ReserveIdempotencyKey(record *IdempotencyRecord, window time.Duration) (*IdempotencyRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND created_at < $3
+	`, record.UserID, record.Key, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, method, path, fingerprint)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO NOTHING
+		RETURNING created_at
+	`
+	err = tx.QueryRow(query, record.UserID, record.Key, record.Method, record.Path, record.Fingerprint).Scan(&record.CreatedAt)
+	if err == nil {
+		return nil, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	existing := &IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var (
+		status  sql.NullInt64
+		headers []byte
+	)
+	err = tx.QueryRow(`
+		SELECT method, path, fingerprint, status_code, response_headers, response_body, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, record.UserID, record.Key).Scan(
+		&existing.Method,
+		&existing.Path,
+		&existing.Fingerprint,
+		&status,
+		&headers,
+		&existing.Body,
+		&existing.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.StatusCode = int(status.Int64)
+	if headers != nil {
+		err = json.Unmarshal(headers, &existing.Header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return existing, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response of a reserved key so later
+// retries can replay it.
+func (s *PostgresIdempotencyStore) CompleteIdempotencyKey(record *IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, response_headers = $4, response_body = $5, completed_at = NOW()
+		WHERE user_id = $1 AND key = $2
+	`
+	_, err = s.db.Exec(query, record.UserID, record.Key, record.StatusCode, headers, record.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a reservation whose request failed, so the
+// client can retry with the same key.
+func (s *PostgresIdempotencyStore) ReleaseIdempotencyKey(userID int, key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	return err
+}
+
+func (s *PostgresIdempotencyStore) PurgeIdempotencyKeys(window time.Duration) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE created_at < $1`
+	result, err := s.db.Exec(query, time.Now().Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
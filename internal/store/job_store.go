@@ -0,0 +1,251 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job statuses.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// DefaultJobMaxAttempts is used for jobs enqueued without MaxAttempts.
+const DefaultJobMaxAttempts = 5
+
+// ErrJobNotRetryable is returned when retrying a job that is running or
+// has succeeded.
+var ErrJobNotRetryable = errors.New("job is running or has succeeded")
+
+// Job is a unit of background work. Args is the JSON its handler is
+// called with; a job is run at RunAt or later, and made dead once
+// MaxAttempts attempts failed.
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Args        json.RawMessage `json:"args"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// JobFilter narrows ListJobs; empty fields match every job.
+type JobFilter struct {
+	Status string
+	Type   string
+}
+
+type PostgresJobStore struct {
+	db *sql.DB
+}
+
+func NewPostgresJobStore(db *sql.DB) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+type JobStore interface {
+	EnqueueJob(job *Job) error
+	ClaimJobs(types []string, limit int, lease time.Duration) ([]*Job, error)
+	CompleteJob(id int64) error
+	FailJob(job *Job, reason string, runAt *time.Time) error
+	ListJobs(filter JobFilter, limit, offset int) ([]*Job, error)
+	GetJob(id int64) (*Job, error)
+	RetryJob(id int64) (*Job, error)
+	PurgeFinishedJobs(retention time.Duration) (int64, error)
+}
+
+const jobColumns = `id, type, args, status, attempts, max_attempts, run_at, last_error, created_at, updated_at, finished_at`
+
+// EnqueueJob stores a pending job. A zero RunAt runs it right away.
+func (s *PostgresJobStore) EnqueueJob(job *Job) error {
+	return insertJob(s.db, job)
+}
+
+// ClaimJobs marks up to limit due jobs of the given types as running for
+// lease, oldest first. Jobs whose lease ran out while running are claimed
+// again. Every claim counts as an attempt.
+func (s *PostgresJobStore) ClaimJobs(types []string, limit int, lease time.Duration) ([]*Job, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM jobs
+			WHERE type = ANY($1)
+			  AND ((status = 'pending' AND run_at <= NOW()) OR (status = 'running' AND locked_until <= NOW()))
+			ORDER BY run_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs j
+		SET status = 'running', attempts = j.attempts + 1,
+		    locked_until = NOW() + $3::float8 * INTERVAL '1 second', updated_at = NOW()
+		FROM due
+		WHERE j.id = due.id
+		RETURNING j.id, j.type, j.args, j.status, j.attempts, j.max_attempts, j.run_at,
+		          j.last_error, j.created_at, j.updated_at, j.finished_at
+	`
+	rows, err := s.db.Query(query, types, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+func (s *PostgresJobStore) CompleteJob(id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', locked_until = NULL, updated_at = NOW(), finished_at = NOW()
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(query, id)
+	return err
+}
+
+// FailJob records a failed attempt. The job runs again at runAt, or is
+// dead when that is nil.
+func (s *PostgresJobStore) FailJob(job *Job, reason string, runAt *time.Time) error {
+	status := JobDead
+	if runAt != nil {
+		status = JobPending
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = $2, run_at = COALESCE($3, run_at), locked_until = NULL, last_error = $4,
+		    updated_at = NOW(), finished_at = CASE WHEN $2 = 'dead' THEN NOW() END
+		WHERE id = $1
+		RETURNING run_at, updated_at, finished_at
+	`
+	err := s.db.QueryRow(query, job.ID, status, runAt, reason).Scan(&job.RunAt, &job.UpdatedAt, &job.FinishedAt)
+	if err != nil {
+		return err
+	}
+	job.Status = status
+	job.LastError = &reason
+	return nil
+}
+
+// ListJobs returns the matching jobs, newest first.
+func (s *PostgresJobStore) ListJobs(filter JobFilter, limit, offset int) ([]*Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.Query(query, filter.Status, filter.Type, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+func (s *PostgresJobStore) GetJob(id int64) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+	return scanJob(s.db.QueryRow(query, id))
+}
+
+// RetryJob makes a dead or waiting job run right away, with its attempts
+// starting over. It returns ErrJobNotRetryable for running and succeeded
+// jobs, and sql.ErrNoRows when there is no such job.
+func (s *PostgresJobStore) RetryJob(id int64) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW(), finished_at = NULL
+		WHERE id = $1 AND status IN ('pending', 'dead')
+		RETURNING ` + jobColumns
+	job, err := scanJob(s.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = s.GetJob(id)
+		if err == nil {
+			return nil, ErrJobNotRetryable
+		}
+	}
+	return job, err
+}
+
+// PurgeFinishedJobs deletes succeeded jobs that finished more than
+// retention ago. Dead jobs stay until an admin retries them.
+func (s *PostgresJobStore) PurgeFinishedJobs(retention time.Duration) (int64, error) {
+	query := `DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < $1`
+	result, err := s.db.Exec(query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertJob enqueues the job through q, which may be the transaction of
+// the change that needs it: the job then only exists if the change commits.
+func insertJob(q querier, job *Job) error {
+	if job.Args == nil {
+		job.Args = json.RawMessage(`{}`)
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	query := `
+		INSERT INTO jobs (type, args, max_attempts, run_at)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING ` + jobColumns
+	created, err := scanJob(q.QueryRow(query, job.Type, string(job.Args), job.MaxAttempts, runAt))
+	if err != nil {
+		return err
+	}
+	*job = *created
+	return nil
+}
+
+func scanJobs(rows *sql.Rows) ([]*Job, error) {
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	job := &Job{}
+	var args string
+	err := row.Scan(
+		&job.ID,
+		&job.Type,
+		&args,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.Args = json.RawMessage(args)
+	return job, nil
+}
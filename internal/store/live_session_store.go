@@ -0,0 +1,270 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	LiveSessionActive    = "active"
+	LiveSessionFinished  = "finished"
+	LiveSessionAbandoned = "abandoned"
+)
+
+// ErrLiveSessionEnded is returned for writes to a session that was already
+// finished or abandoned.
+var ErrLiveSessionEnded = errors.New("live session has ended")
+
+// LiveSession is a workout in progress, shared by all devices of its user.
+// Seq is the number of events applied to State so far.
+type LiveSession struct {
+	ID                int64            `json:"id"`
+	UserID            int              `json:"user_id"`
+	TemplateWorkoutID *int64           `json:"template_workout_id,omitempty"`
+	Status            string           `json:"status"`
+	Seq               int64            `json:"seq"`
+	State             LiveSessionState `json:"state"`
+	WorkoutID         *int64           `json:"workout_id,omitempty"`
+	StartedAt         time.Time        `json:"started_at"`
+	UpdatedAt         time.Time        `json:"updated_at"`
+	EndedAt           *time.Time       `json:"ended_at,omitempty"`
+}
+
+// LiveSessionState is what the devices of a session edit together. Entries
+// are planned exercises with the sets done so far; NextEntryID hands out
+// their IDs.
+type LiveSessionState struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Groups      []EntryGroup `json:"groups"`
+	Entries     []LiveEntry  `json:"entries"`
+	Rest        *RestTimer   `json:"rest,omitempty"`
+	NextEntryID int          `json:"next_entry_id"`
+}
+
+// LiveEntry is an exercise of a live session. Reps, DurationSeconds and
+// Weight are the targets for each set; Group works as in WorkoutEntry.
+type LiveEntry struct {
+	ID              int            `json:"id"`
+	ExerciseName    string         `json:"exercise_name"`
+	TargetSets      int            `json:"target_sets"`
+	Reps            *int           `json:"reps,omitempty"`
+	DurationSeconds *int           `json:"duration_seconds,omitempty"`
+	Weight          *float64       `json:"weight,omitempty"`
+	Notes           string         `json:"notes,omitempty"`
+	Group           *int           `json:"group,omitempty"`
+	CompletedSets   []CompletedSet `json:"completed_sets"`
+}
+
+type CompletedSet struct {
+	Reps            *int      `json:"reps,omitempty"`
+	DurationSeconds *int      `json:"duration_seconds,omitempty"`
+	Weight          *float64  `json:"weight,omitempty"`
+	CompletedAt     time.Time `json:"completed_at"`
+}
+
+// RestTimer is a running rest period, optionally after a set of EntryID.
+type RestTimer struct {
+	EntryID         *int      `json:"entry_id,omitempty"`
+	DurationSeconds int       `json:"duration_seconds"`
+	StartedAt       time.Time `json:"started_at"`
+	EndsAt          time.Time `json:"ends_at"`
+}
+
+type PostgresLiveSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLiveSessionStore(db *sql.DB) *PostgresLiveSessionStore {
+	return &PostgresLiveSessionStore{db: db}
+}
+
+type LiveSessionStore interface {
+	CreateLiveSession(session *LiveSession) error
+	GetLiveSession(id int64) (*LiveSession, error)
+	ListLiveSessions(userID int) ([]*LiveSession, error)
+	SaveLiveSessionState(session *LiveSession) error
+	FinishLiveSession(session *LiveSession, workout *Workout) error
+	AbandonLiveSession(session *LiveSession) error
+}
+
+func (s *PostgresLiveSessionStore) CreateLiveSession(session *LiveSession) error {
+	state, err := json.Marshal(session.State)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO live_sessions (user_id, template_workout_id, state)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, seq, started_at, updated_at
+	`
+	return s.db.QueryRow(query, session.UserID, session.TemplateWorkoutID, state).
+		Scan(&session.ID, &session.Status, &session.Seq, &session.StartedAt, &session.UpdatedAt)
+}
+
+func (s *PostgresLiveSessionStore) GetLiveSession(id int64) (*LiveSession, error) {
+	query := `
+		SELECT id, user_id, template_workout_id, status, seq, state, workout_id,
+		       started_at, updated_at, ended_at
+		FROM live_sessions
+		WHERE id = $1
+	`
+	return scanLiveSession(s.db.QueryRow(query, id))
+}
+
+// ListLiveSessions returns the user's active sessions, newest first.
+func (s *PostgresLiveSessionStore) ListLiveSessions(userID int) ([]*LiveSession, error) {
+	query := `
+		SELECT id, user_id, template_workout_id, status, seq, state, workout_id,
+		       started_at, updated_at, ended_at
+		FROM live_sessions
+		WHERE user_id = $1 AND status = 'active'
+		ORDER BY started_at DESC
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*LiveSession{}
+	for rows.Next() {
+		session, err := scanLiveSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// SaveLiveSessionState stores session.State as the result of one more
+// event. session.Seq must be the seq the state was read at; if another
+// write got in between, ErrVersionConflict is returned. On success
+// session.Seq holds the new seq.
+func (s *PostgresLiveSessionStore) SaveLiveSessionState(session *LiveSession) error {
+	state, err := json.Marshal(session.State)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE live_sessions
+		SET state = $1, seq = seq + 1, updated_at = NOW()
+		WHERE id = $2 AND status = 'active' AND seq = $3
+		RETURNING seq, updated_at
+	`
+	err = s.db.QueryRow(query, state, session.ID, session.Seq).Scan(&session.Seq, &session.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return s.liveSessionWriteError(session.ID)
+	}
+	return err
+}
+
+// FinishLiveSession ends the session and stores workout, built from its
+// state, in the same transaction.
+func (s *PostgresLiveSessionStore) FinishLiveSession(session *LiveSession, workout *Workout) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = insertWorkout(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	workoutID := int64(workout.ID)
+	err = endLiveSession(tx, session, LiveSessionFinished, &workoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AbandonLiveSession ends the session without storing a workout.
+func (s *PostgresLiveSessionStore) AbandonLiveSession(session *LiveSession) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = endLiveSession(tx, session, LiveSessionAbandoned, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func endLiveSession(tx *sql.Tx, session *LiveSession, status string, workoutID *int64) error {
+	query := `
+		UPDATE live_sessions
+		SET status = $1, workout_id = $2, seq = seq + 1, updated_at = NOW(), ended_at = NOW()
+		WHERE id = $3 AND status = 'active'
+		RETURNING seq, updated_at, ended_at
+	`
+	err := tx.QueryRow(query, status, workoutID, session.ID).Scan(&session.Seq, &session.UpdatedAt, &session.EndedAt)
+	if err == sql.ErrNoRows {
+		return ErrLiveSessionEnded
+	}
+	if err != nil {
+		return err
+	}
+
+	session.Status, session.WorkoutID = status, workoutID
+	return nil
+}
+
+// liveSessionWriteError explains why a guarded write to an active session
+// touched no rows.
+func (s *PostgresLiveSessionStore) liveSessionWriteError(id int64) error {
+	var status string
+	err := s.db.QueryRow(`SELECT status FROM live_sessions WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status != LiveSessionActive {
+		return ErrLiveSessionEnded
+	}
+	return ErrVersionConflict
+}
+
+func scanLiveSession(row rowScanner) (*LiveSession, error) {
+	var (
+		session LiveSession
+		state   []byte
+	)
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.TemplateWorkoutID,
+		&session.Status,
+		&session.Seq,
+		&state,
+		&session.WorkoutID,
+		&session.StartedAt,
+		&session.UpdatedAt,
+		&session.EndedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(state, &session.State)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// MaxNotifyPayload is the largest payload Postgres accepts for a
+// notification, in bytes.
+const MaxNotifyPayload = 7999
+
+// PostgresNotifier passes messages between the instances sharing the
+// database with LISTEN/NOTIFY. Notifications are not stored: a listener
+// only gets those sent while it listens.
+type PostgresNotifier struct {
+	db *sql.DB
+}
+
+func NewPostgresNotifier(db *sql.DB) *PostgresNotifier {
+	return &PostgresNotifier{db: db}
+}
+
+// Notify sends payload to every listener of channel, this instance's
+// included.
+func (n *PostgresNotifier) Notify(channel, payload string) error {
+	_, err := n.db.Exec(`SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
+
+// Listen calls fn with the payload of every notification on channel until
+// ctx ends or the connection fails. It holds a connection of the pool
+// meanwhile.
+func (n *PostgresNotifier) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := n.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var listenErr error
+	err = conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		_, listenErr = pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+		for listenErr == nil {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				listenErr = err
+				break
+			}
+			fn(notification.Payload)
+		}
+		// the connection is still subscribed, or broken by the cancelled
+		// wait; either way it must not go back to the pool
+		return driver.ErrBadConn
+	})
+	if listenErr == nil {
+		// Raw never got to run the callback
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Aggregates outbox events belong to. Events of one aggregate are
+// published in the order they were written.
+const (
+	AggregateWorkout = "workout"
+	AggregateUser    = "user"
+)
+
+// EventUserUpdated is published when a user changes their profile.
+const EventUserUpdated = "user.updated"
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it describes, so it is published if and only if the change
+// commits. Data is the event's JSON payload; PublishedTo lists the sinks
+// that already have the event.
+type OutboxEvent struct {
+	ID            int64           `json:"-"`
+	EventID       string          `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	UserID        int64           `json:"user_id"`
+	Type          string          `json:"type"`
+	Data          json.RawMessage `json:"data"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Attempts      int             `json:"-"`
+	PublishedTo   []string        `json:"-"`
+}
+
+type PostgresOutboxStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxStore(db *sql.DB) *PostgresOutboxStore {
+	return &PostgresOutboxStore{db: db}
+}
+
+type OutboxStore interface {
+	ClaimOutboxEvents(limit int, lease time.Duration) ([]*OutboxEvent, error)
+	MarkOutboxEventPublished(id int64) error
+	RecordOutboxFailure(event *OutboxEvent, publishedTo []string, nextAttemptAt time.Time, reason string) error
+}
+
+// ClaimOutboxEvents picks up to limit due events and hides them from other
+// dispatchers for lease. Only the oldest event of each aggregate is
+// eligible, so an aggregate's events go out one at a time and in order,
+// even while an earlier one is being retried.
+func (s *PostgresOutboxStore) ClaimOutboxEvents(limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	query := `
+		WITH due AS (
+			SELECT o.id
+			FROM outbox o
+			WHERE o.next_attempt_at <= NOW()
+			  AND NOT EXISTS (
+				SELECT 1 FROM outbox e
+				WHERE e.aggregate_type = o.aggregate_type AND e.aggregate_id = o.aggregate_id AND e.id < o.id
+			  )
+			ORDER BY o.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o
+		SET next_attempt_at = NOW() + $2::float8 * INTERVAL '1 second'
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.event_id, o.aggregate_type, o.aggregate_id, o.user_id, o.event_type,
+		          o.payload, o.created_at, o.attempts, to_json(o.published_to)
+	`
+	rows, err := s.db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*OutboxEvent{}
+	for rows.Next() {
+		var (
+			event       OutboxEvent
+			data        string
+			publishedTo []byte
+		)
+		err = rows.Scan(
+			&event.ID,
+			&event.EventID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.UserID,
+			&event.Type,
+			&data,
+			&event.OccurredAt,
+			&event.Attempts,
+			&publishedTo,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.Data = json.RawMessage(data)
+		// published_to is read as JSON, database/sql can't scan arrays
+		err = json.Unmarshal(publishedTo, &event.PublishedTo)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING comes back in no particular order
+	slices.SortFunc(events, func(a, b *OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+// MarkOutboxEventPublished drops the event once every sink has it, which
+// makes the aggregate's next event eligible.
+func (s *PostgresOutboxStore) MarkOutboxEventPublished(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+// RecordOutboxFailure schedules the event to be tried again at
+// nextAttemptAt, by the sinks not in publishedTo.
+func (s *PostgresOutboxStore) RecordOutboxFailure(event *OutboxEvent, publishedTo []string, nextAttemptAt time.Time, reason string) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, next_attempt_at = $2, published_to = $3, last_error = $4
+		WHERE id = $1
+		RETURNING attempts
+	`
+	err := s.db.QueryRow(query, event.ID, nextAttemptAt, publishedTo, reason).Scan(&event.Attempts)
+	if err != nil {
+		return err
+	}
+	event.PublishedTo = publishedTo
+	return nil
+}
+
+// recordOutboxEvent writes an event about the aggregate to the outbox.
+// Writers must call it inside the transaction of the change, after
+// taking whatever lock orders the aggregate's writes.
+func recordOutboxEvent(tx *sql.Tx, aggregateType string, aggregateID, userID int64, eventType string, data any) error {
+	eventID, err := newEventID()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox (event_id, aggregate_type, aggregate_id, user_id, event_type, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.Exec(query, eventID, aggregateType, aggregateID, userID, eventType, string(payload))
+	return err
+}
+
+// workoutEventData is the payload of workout events: the workout, or its
+// identifiers once it is in the trash.
+func workoutEventData(tx *sql.Tx, eventType string, workoutID int, userID int64, clientID string) (any, error) {
+	if eventType == EventWorkoutDeleted {
+		return map[string]any{"id": workoutID, "user_id": userID, "client_id": clientID}, nil
+	}
+	return getWorkout(tx, int64(workoutID))
+}
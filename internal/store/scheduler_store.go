@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// schedulerLock is the session advisory lock held by the scheduler leader.
+const schedulerLock = 47
+
+// DailyStats are the platform-wide workout numbers of one UTC day.
+type DailyStats struct {
+	Day                  string `json:"day"`
+	Workouts             int    `json:"workouts"`
+	ActiveUsers          int    `json:"active_users"`
+	TotalDurationMinutes int    `json:"total_duration_minutes"`
+	TotalCaloriesBurned  int    `json:"total_calories_burned"`
+}
+
+// Leadership is held by the one scheduler instance allowed to run tasks.
+type Leadership interface {
+	// Check returns an error once the leadership is lost.
+	Check(ctx context.Context) error
+	Release() error
+}
+
+type PostgresSchedulerStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSchedulerStore(db *sql.DB) *PostgresSchedulerStore {
+	return &PostgresSchedulerStore{db: db}
+}
+
+type SchedulerStore interface {
+	TryLead(ctx context.Context) (Leadership, error)
+	ClaimTaskRun(name string, slot time.Time) (bool, error)
+	FinishTaskRun(name string, slot time.Time, reason string) error
+	RefreshDailyStats() error
+	ListDailyStats(from, to *time.Time) ([]DailyStats, error)
+}
+
+// postgresLeadership keeps the connection that holds the advisory lock.
+// Should that connection break, Postgres drops the lock and another
+// instance takes over.
+type postgresLeadership struct {
+	conn *sql.Conn
+}
+
+// TryLead takes the scheduler lock if no other instance holds it. It
+// returns nil when another instance leads.
+func (s *PostgresSchedulerStore) TryLead(ctx context.Context) (Leadership, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1::int, 0)`, schedulerLock).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		return nil, err
+	}
+	return &postgresLeadership{conn: conn}, nil
+}
+
+func (l *postgresLeadership) Check(ctx context.Context) error {
+	return l.conn.PingContext(ctx)
+}
+
+func (l *postgresLeadership) Release() error {
+	_, err := l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1::int, 0)`, schedulerLock)
+	closeErr := l.conn.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// ClaimTaskRun records that the task starts its run for slot. It returns
+// false when that slot, or a later one, was already claimed.
+func (s *PostgresSchedulerStore) ClaimTaskRun(name string, slot time.Time) (bool, error) {
+	query := `
+		INSERT INTO scheduled_task_runs (name, slot)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET slot = EXCLUDED.slot, started_at = NOW(), finished_at = NULL, last_error = NULL
+		WHERE scheduled_task_runs.slot < EXCLUDED.slot
+	`
+	result, err := s.db.Exec(query, name, slot)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// FinishTaskRun records the end of the run claimed for slot; reason is ""
+// when it succeeded.
+func (s *PostgresSchedulerStore) FinishTaskRun(name string, slot time.Time, reason string) error {
+	query := `
+		UPDATE scheduled_task_runs
+		SET finished_at = NOW(), last_error = $3
+		WHERE name = $1 AND slot = $2
+	`
+	_, err := s.db.Exec(query, name, slot, nullableString(reason))
+	return err
+}
+
+// RefreshDailyStats recomputes daily_workout_stats without blocking its
+// readers.
+func (s *PostgresSchedulerStore) RefreshDailyStats() error {
+	_, err := s.db.Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY daily_workout_stats`)
+	return err
+}
+
+// ListDailyStats returns the days in [from, to), oldest first. Either
+// bound may be nil.
+func (s *PostgresSchedulerStore) ListDailyStats(from, to *time.Time) ([]DailyStats, error) {
+	query := `
+		SELECT to_char(day, 'YYYY-MM-DD'), workouts, active_users, total_duration_minutes, total_calories_burned
+		FROM daily_workout_stats
+		WHERE ($1::timestamptz IS NULL OR day >= ($1::timestamptz AT TIME ZONE 'UTC')::date)
+		  AND ($2::timestamptz IS NULL OR day < ($2::timestamptz AT TIME ZONE 'UTC')::date)
+		ORDER BY day
+	`
+	rows, err := s.db.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []DailyStats{}
+	for rows.Next() {
+		var day DailyStats
+		err = rows.Scan(&day.Day, &day.Workouts, &day.ActiveUsers, &day.TotalDurationMinutes, &day.TotalCaloriesBurned)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, day)
+	}
+	return stats, rows.Err()
+}
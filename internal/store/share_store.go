@@ -0,0 +1,125 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/tokens"
+)
+
+// WorkoutShare is a read-only link to a workout. Token is only known right
+// after the share is created; afterwards just its hash is stored.
+type WorkoutShare struct {
+	ID        int64      `json:"id"`
+	WorkoutID int64      `json:"workout_id"`
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type PostgresShareStore struct {
+	db *sql.DB
+}
+
+func NewPostgresShareStore(db *sql.DB) *PostgresShareStore {
+	return &PostgresShareStore{db: db}
+}
+
+type ShareStore interface {
+	CreateShare(workoutID int64, userID int, expiresAt *time.Time) (*WorkoutShare, error)
+	ListShares(workoutID int64) ([]*WorkoutShare, error)
+	RevokeShare(workoutID, shareID int64) error
+	GetSharedWorkout(token string) (*Workout, error)
+	PurgeExpiredShares() (int64, error)
+}
+
+// CreateShare issues a new share token for the workout, valid until
+// expiresAt or, when that is nil, until it is revoked.
+func (s *PostgresShareStore) CreateShare(workoutID int64, userID int, expiresAt *time.Time) (*WorkoutShare, error) {
+	var ttl time.Duration
+	if expiresAt != nil {
+		ttl = time.Until(*expiresAt)
+	}
+	token, err := tokens.GenerateToken(userID, ttl, tokens.ScopeShare)
+	if err != nil {
+		return nil, err
+	}
+
+	share := &WorkoutShare{WorkoutID: workoutID, Token: token.Plaintext}
+	query := `
+		INSERT INTO workout_shares (workout_id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, expires_at, created_at
+	`
+	err = s.db.QueryRow(query, workoutID, userID, token.Hash, expiresAt).Scan(&share.ID, &share.ExpiresAt, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// ListShares returns the workout's shares, revoked and expired ones
+// included, newest first.
+func (s *PostgresShareStore) ListShares(workoutID int64) ([]*WorkoutShare, error) {
+	query := `
+		SELECT id, workout_id, expires_at, revoked_at, created_at
+		FROM workout_shares
+		WHERE workout_id = $1
+		ORDER BY id DESC
+	`
+	rows, err := s.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []*WorkoutShare{}
+	for rows.Next() {
+		var share WorkoutShare
+		err = rows.Scan(&share.ID, &share.WorkoutID, &share.ExpiresAt, &share.RevokedAt, &share.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, &share)
+	}
+	return shares, rows.Err()
+}
+
+// RevokeShare makes the share's token stop working right away. It returns
+// sql.ErrNoRows when the workout has no such share or it was already
+// revoked.
+func (s *PostgresShareStore) RevokeShare(workoutID, shareID int64) error {
+	query := `
+		UPDATE workout_shares SET revoked_at = NOW()
+		WHERE id = $1 AND workout_id = $2 AND revoked_at IS NULL
+	`
+	return execAffectingOne(s.db, query, shareID, workoutID)
+}
+
+// GetSharedWorkout returns the workout a share token gives access to. It
+// returns sql.ErrNoRows for unknown, expired and revoked tokens, and for
+// workouts in the trash.
+func (s *PostgresShareStore) GetSharedWorkout(token string) (*Workout, error) {
+	hash := sha256.Sum256([]byte(token))
+	query := `
+		SELECT workout_id FROM workout_shares
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+	var workoutID int64
+	err := s.db.QueryRow(query, hash[:]).Scan(&workoutID)
+	if err != nil {
+		return nil, err
+	}
+	return getWorkout(s.db, workoutID)
+}
+
+// PurgeExpiredShares deletes shares that expired or were revoked.
+func (s *PostgresShareStore) PurgeExpiredShares() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM workout_shares WHERE revoked_at IS NOT NULL OR expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkoutShares(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	workouts := NewPostgresWorkoutStore(db)
+	shares := NewPostgresShareStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, workouts, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+	)
+
+	share, err := shares.CreateShare(int64(workout.ID), user.ID, nil)
+	require.NoError(t, err)
+	shared, err := shares.GetSharedWorkout(share.Token)
+	require.NoError(t, err)
+	assert.Equal(t, workout.ID, shared.ID)
+	assert.Len(t, shared.Entries, 1)
+
+	_, err = shares.GetSharedWorkout(share.Token + "x")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, shares.RevokeShare(int64(workout.ID), share.ID))
+	_, err = shares.GetSharedWorkout(share.Token)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	expiresAt := time.Now().Add(time.Hour)
+	share, err = shares.CreateShare(int64(workout.ID), user.ID, &expiresAt)
+	require.NoError(t, err)
+	require.NoError(t, workouts.DeleteWorkout(int64(workout.ID), user.ID, 0))
+	_, err = shares.GetSharedWorkout(share.Token)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
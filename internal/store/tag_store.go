@@ -0,0 +1,422 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrDuplicateTag is returned when a user already has a tag with the same
+// name, compared case-insensitively.
+var ErrDuplicateTag = errors.New("tag name already in use")
+
+// ErrTagNotFound is returned when tagging refers to a tag the user doesn't
+// have, or untagging to a tag the workout doesn't carry.
+var ErrTagNotFound = errors.New("tag not found")
+
+type Tag struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Color        string    `json:"color"`
+	WorkoutCount int       `json:"workout_count,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type PostgresTagStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{db: db}
+}
+
+type TagStore interface {
+	CreateTag(userID int, tag *Tag) error
+	ListTags(userID int) ([]*Tag, error)
+	GetTag(userID int, id int64) (*Tag, error)
+	UpdateTag(userID int, tag *Tag) error
+	DeleteTag(userID int, id int64) error
+	SuggestTags(userID int, prefix string, limit int) ([]*Tag, error)
+	SetWorkoutTags(userID int, workoutID int64, tagIDs []int64) error
+	AddWorkoutTag(userID int, workoutID, tagID int64) error
+	RemoveWorkoutTag(userID int, workoutID, tagID int64) error
+}
+
+func (s *PostgresTagStore) CreateTag(userID int, tag *Tag) error {
+	query := `
+		INSERT INTO tags (user_id, name, color)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+	err := s.db.QueryRow(query, userID, tag.Name, tag.Color).Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateTag
+	}
+	return err
+}
+
+// ListTags returns the user's tags by name, each with the number of live
+// workouts carrying it.
+func (s *PostgresTagStore) ListTags(userID int) ([]*Tag, error) {
+	query := `
+		SELECT t.id, t.name, t.color, COUNT(w.id), t.created_at, t.updated_at
+		FROM tags t
+		LEFT JOIN workout_tags wt ON wt.tag_id = t.id
+		LEFT JOIN workouts w ON w.id = wt.workout_id AND w.deleted_at IS NULL
+		WHERE t.user_id = $1
+		GROUP BY t.id
+		ORDER BY LOWER(t.name)
+	`
+	return s.queryTags(query, userID)
+}
+
+func (s *PostgresTagStore) GetTag(userID int, id int64) (*Tag, error) {
+	tag := &Tag{}
+	query := `SELECT id, name, color, created_at, updated_at FROM tags WHERE id = $1 AND user_id = $2`
+	err := s.db.QueryRow(query, id, userID).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// UpdateTag renames or recolors a tag. The workouts carrying it move to
+// their next version, since their tags read differently now. It returns
+// sql.ErrNoRows when the user has no such tag.
+func (s *PostgresTagStore) UpdateTag(userID int, tag *Tag) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE tags
+		SET name = $3, color = $4, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tags other
+		      WHERE other.user_id = $2 AND LOWER(other.name) = LOWER($3) AND other.id <> $1)
+		RETURNING created_at, updated_at
+	`
+	err = tx.QueryRow(query, tag.ID, userID, tag.Name, tag.Color).Scan(&tag.CreatedAt, &tag.UpdatedAt)
+	if err == sql.ErrNoRows {
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM tags WHERE id = $1 AND user_id = $2)`, tag.ID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateTag
+		}
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+
+	err = touchTaggedWorkouts(tx, userID, int64(tag.ID))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTag deletes the tag and removes it from the workouts carrying it,
+// which move to their next version.
+func (s *PostgresTagStore) DeleteTag(userID int, id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// the workouts are touched first: deleting the tag cascades to
+	// workout_tags and would leave nothing to find them by
+	err = touchTaggedWorkouts(tx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	err = execAffectingOne(tx, `DELETE FROM tags WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SuggestTags autocompletes tag names starting with prefix, most used
+// tags first.
+func (s *PostgresTagStore) SuggestTags(userID int, prefix string, limit int) ([]*Tag, error) {
+	query := `
+		SELECT t.id, t.name, t.color, COUNT(wt.workout_id), t.created_at, t.updated_at
+		FROM tags t
+		LEFT JOIN workout_tags wt ON wt.tag_id = t.id
+		WHERE t.user_id = $1 AND LOWER(t.name) LIKE $2
+		GROUP BY t.id
+		ORDER BY COUNT(wt.workout_id) DESC, LOWER(t.name)
+		LIMIT $3
+	`
+	return s.queryTags(query, userID, escapeLike(strings.ToLower(prefix))+"%", limit)
+}
+
+// SetWorkoutTags replaces the tags of a workout. sql.ErrNoRows is returned
+// when the workout is not the user's, ErrTagNotFound when one of the tags
+// isn't.
+func (s *PostgresTagStore) SetWorkoutTags(userID int, workoutID int64, tagIDs []int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	tagIDs = uniqueIDs(tagIDs)
+	err = checkTagging(tx, userID, workoutID, tagIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_tags WHERE workout_id = $1 AND NOT (tag_id = ANY($2::bigint[]))`, workoutID, tagIDs)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO workout_tags (workout_id, tag_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+	`, workoutID, tagIDs)
+	if err != nil {
+		return err
+	}
+
+	err = touchWorkout(tx, workoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresTagStore) AddWorkoutTag(userID int, workoutID, tagID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = checkTagging(tx, userID, workoutID, []int64{tagID})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO workout_tags (workout_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, workoutID, tagID)
+	if err != nil {
+		return err
+	}
+
+	err = touchWorkout(tx, workoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresTagStore) RemoveWorkoutTag(userID int, workoutID, tagID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = checkTagging(tx, userID, workoutID, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM workout_tags WHERE workout_id = $1 AND tag_id = $2`, workoutID, tagID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTagNotFound
+	}
+
+	err = touchWorkout(tx, workoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// touchWorkout moves a workout whose tags changed to its next version and
+// records the change, so ETags and the sync feed pick the new tags up.
+func touchWorkout(tx *sql.Tx, workoutID int64) error {
+	err := bumpWorkoutVersion(tx, &Workout{ID: int(workoutID)})
+	if err != nil {
+		return err
+	}
+	return recordWorkoutChange(tx, int(workoutID))
+}
+
+// touchTaggedWorkouts touches every live workout of the user that carries
+// the tag.
+func touchTaggedWorkouts(tx *sql.Tx, userID int, tagID int64) error {
+	query := `
+		SELECT w.id
+		FROM workout_tags wt
+		INNER JOIN workouts w ON w.id = wt.workout_id
+		WHERE wt.tag_id = $1 AND w.user_id = $2 AND w.deleted_at IS NULL
+		ORDER BY w.id
+	`
+	rows, err := tx.Query(query, tagID, userID)
+	if err != nil {
+		return err
+	}
+	var workoutIDs []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		workoutIDs = append(workoutIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range workoutIDs {
+		err = touchWorkout(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTagging makes sure the workout and all tags belong to the user.
+func checkTagging(tx *sql.Tx, userID int, workoutID int64, tagIDs []int64) error {
+	var owned bool
+	query := `SELECT EXISTS (SELECT 1 FROM workouts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`
+	err := tx.QueryRow(query, workoutID, userID).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return sql.ErrNoRows
+	}
+	if len(tagIDs) == 0 {
+		return nil
+	}
+
+	var found int
+	query = `SELECT COUNT(*) FROM tags WHERE user_id = $1 AND id = ANY($2::bigint[])`
+	err = tx.QueryRow(query, userID, uniqueIDs(tagIDs)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(uniqueIDs(tagIDs)) {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+func queryWorkoutTags(q querier, workoutID int64) ([]Tag, error) {
+	query := `
+		SELECT t.id, t.name, t.color, t.created_at, t.updated_at
+		FROM workout_tags wt
+		INNER JOIN tags t ON t.id = wt.tag_id
+		WHERE wt.workout_id = $1
+		ORDER BY LOWER(t.name)
+	`
+	rows, err := q.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		err = rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *PostgresTagStore) queryTags(query string, args ...any) ([]*Tag, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		tag := &Tag{}
+		err = rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.WorkoutCount, &tag.CreatedAt, &tag.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// escapeLike escapes the LIKE wildcards in user input.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
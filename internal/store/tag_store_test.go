@@ -0,0 +1,64 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkoutTags(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	workouts := NewPostgresWorkoutStore(db)
+	tags := NewPostgresTagStore(db)
+	user := createTestUser(t, db, "melkey")
+	other := createTestUser(t, db, "prime")
+	workout := createTestWorkout(t, workouts, user.ID)
+
+	strength := &Tag{Name: "strength", Color: "#ef4444"}
+	require.NoError(t, tags.CreateTag(user.ID, strength))
+	rehab := &Tag{Name: "injury rehab", Color: "#22c55e"}
+	require.NoError(t, tags.CreateTag(user.ID, rehab))
+	foreign := &Tag{Name: "strength", Color: "#ef4444"}
+	require.NoError(t, tags.CreateTag(other.ID, foreign))
+
+	err := tags.CreateTag(user.ID, &Tag{Name: "strength", Color: "#000000"})
+	assert.ErrorIs(t, err, ErrDuplicateTag)
+
+	err = tags.SetWorkoutTags(user.ID, int64(workout.ID), []int64{int64(foreign.ID)})
+	assert.ErrorIs(t, err, ErrTagNotFound)
+	err = tags.SetWorkoutTags(other.ID, int64(workout.ID), []int64{int64(foreign.ID)})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = tags.SetWorkoutTags(user.ID, int64(workout.ID), []int64{int64(strength.ID), int64(rehab.ID)})
+	require.NoError(t, err)
+	tagged, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Len(t, tagged.Tags, 2)
+	assert.Greater(t, tagged.Version, workout.Version)
+
+	strength.Name = "power"
+	require.NoError(t, tags.UpdateTag(user.ID, strength))
+	renamed, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Greater(t, renamed.Version, tagged.Version)
+	assert.Contains(t, tagNames(renamed.Tags), "power")
+
+	require.NoError(t, tags.RemoveWorkoutTag(user.ID, int64(workout.ID), int64(rehab.ID)))
+	require.NoError(t, tags.DeleteTag(user.ID, int64(strength.ID)))
+	untagged, err := workouts.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Empty(t, untagged.Tags)
+	assert.Greater(t, untagged.Version, renamed.Version)
+}
+
+func tagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
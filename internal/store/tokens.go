@@ -19,6 +19,7 @@ type TokenStore interface {
 	Insert(token *tokens.Token) error
 	CreateToken(UserID int, ttl time.Duration, scope string) (*tokens.Token, error)
 	DeleteAllTokensForUser(UserID int, scope string) error
+	PurgeExpiredTokens() (int64, error)
 }
 
 func (t *PostgresTokenStore) CreateToken(UserID int, ttl time.Duration, scope string) (*tokens.Token, error) {
@@ -46,3 +47,13 @@ func (t *PostgresTokenStore) DeleteAllTokensForUser(UserID int, scope string) er
 	_, err := t.db.Exec(query, UserID, scope)
 	return err
 }
+
+// PurgeExpiredTokens deletes tokens of every scope past their expiry; they
+// can't be used anymore.
+func (t *PostgresTokenStore) PurgeExpiredTokens() (int64, error) {
+	result, err := t.db.Exec(`DELETE FROM tokens WHERE expiry < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
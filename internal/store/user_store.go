@@ -43,6 +43,8 @@ type User struct {
 	Email        string       `json:"email"`
 	PasswordHash PasswordHash `json:"-"`
 	Bio          string       `json:"bio"`
+	IsAdmin      bool         `json:"-"`
+	IsPrivate    bool         `json:"is_private"`
 	CreatedAt    time.Time    `json:"created_at"`
 	UpdatedAt    time.Time    `json:"updated_at"`
 }
@@ -72,24 +74,36 @@ type UserStore interface {
 }
 
 func (s *postgresUserStore) CreateUser(user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO users (username, email, password_hash, bio)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	data := map[string]any{"id": user.ID, "username": user.Username, "created_at": user.CreatedAt}
+	err = recordOutboxEvent(tx, AggregateUser, int64(user.ID), int64(user.ID), EventUserRegistered, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *postgresUserStore) GetUserByName(username string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, bio, created_at, updated_at
+		SELECT id, username, email, password_hash, bio, is_admin, is_private, created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
@@ -103,6 +117,8 @@ func (s *postgresUserStore) GetUserByName(username string) (*User, error) {
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.IsAdmin,
+		&user.IsPrivate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -119,34 +135,40 @@ func (s *postgresUserStore) GetUserByName(username string) (*User, error) {
 }
 
 func (s *postgresUserStore) UpdateUser(user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// bisa juuga menggunakan current_timestamp
 	query := `
 		UPDATE users
 		SET username = $1, email = $2, password_hash = $3, bio = $4, updated_at = NOW()
 		WHERE id = $5
+		RETURNING updated_at
 	`
 
-	result, err := s.db.Exec(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.ID)
+	// the row lock taken here orders the user's outbox events
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.ID).
+		Scan(&user.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	data := map[string]any{"id": user.ID, "username": user.Username, "updated_at": user.UpdatedAt}
+	err = recordOutboxEvent(tx, AggregateUser, int64(user.ID), int64(user.ID), EventUserUpdated, data)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return tx.Commit()
 }
 
 func (s *postgresUserStore) GetUserToken(scope, plaintextPassword string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(plaintextPassword))
 	query := `
-  SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+  SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.is_admin, u.is_private, u.created_at, u.updated_at
   FROM users u
   INNER JOIN tokens t ON t.user_id = u.id
   WHERE t.hash = $1 AND t.scope = $2 and t.expiry > $3
@@ -160,6 +182,8 @@ func (s *postgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.IsAdmin,
+		&user.IsPrivate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
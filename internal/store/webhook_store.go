@@ -0,0 +1,458 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// EventUserRegistered is sent to subscriptions covering all users when an
+// account is created. The workout events are the activity event types.
+const EventUserRegistered = "user.registered"
+
+// WebhookEventTypes lists the events a subscription can ask for.
+var WebhookEventTypes = []string{EventWorkoutCreated, EventWorkoutUpdated, EventWorkoutDeleted, EventUserRegistered}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription sends the listed events to URL. A subscription gets
+// the events of its owner's workouts, or with AllUsers (admins only) those
+// of every user. Secret signs the deliveries; it is only returned when the
+// subscription is created.
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	AllUsers   bool      `json:"all_users"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an event on its way to one subscription. URL and
+// Secret are only filled in for the delivery worker.
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	SubscriptionID int              `json:"subscription_id"`
+	EventID        string           `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int             `json:"last_status_code,omitempty"`
+	LastError      *string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log,omitempty"`
+	URL            string           `json:"-"`
+	Secret         string           `json:"-"`
+}
+
+// WebhookAttempt is one request made for a delivery. StatusCode is nil
+// when no response came back, Error says why.
+type WebhookAttempt struct {
+	StatusCode   *int      `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMS   int       `json:"duration_ms"`
+	AttemptedAt  time.Time `json:"attempted_at"`
+}
+
+// WebhookPayload is the body of every delivery.
+type WebhookPayload struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateWebhook(sub *WebhookSubscription) error
+	ListWebhooks(userID int) ([]*WebhookSubscription, error)
+	GetWebhook(userID int, id int64) (*WebhookSubscription, error)
+	UpdateWebhook(sub *WebhookSubscription) error
+	DeleteWebhook(userID int, id int64) error
+	ListWebhookDeliveries(subscriptionID int64, limit, offset int) ([]*WebhookDelivery, error)
+	GetWebhookDelivery(subscriptionID, id int64) (*WebhookDelivery, error)
+	RedeliverWebhook(subscriptionID, id int64) (*WebhookDelivery, error)
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	RecordWebhookAttempt(delivery *WebhookDelivery, attempt *WebhookAttempt, nextAttemptAt *time.Time) error
+	EnqueueWebhookDeliveries(event *OutboxEvent) (int64, error)
+}
+
+// CreateWebhook stores the subscription with a new signing secret.
+func (s *PostgresWebhookStore) CreateWebhook(sub *WebhookSubscription) error {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (user_id, url, secret, event_types, all_users, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+	err = s.db.QueryRow(query, sub.UserID, sub.URL, secret, sub.EventTypes, sub.AllUsers, sub.Active).
+		Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	sub.Secret = secret
+	return nil
+}
+
+func (s *PostgresWebhookStore) ListWebhooks(userID int) ([]*WebhookSubscription, error) {
+	query := `
+		SELECT id, user_id, url, to_json(event_types), all_users, active, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *PostgresWebhookStore) GetWebhook(userID int, id int64) (*WebhookSubscription, error) {
+	query := `
+		SELECT id, user_id, url, to_json(event_types), all_users, active, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE id = $1 AND user_id = $2
+	`
+	return scanWebhook(s.db.QueryRow(query, id, userID))
+}
+
+// UpdateWebhook changes the URL, events and active flag. It returns
+// sql.ErrNoRows when the user has no such subscription.
+func (s *PostgresWebhookStore) UpdateWebhook(sub *WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $3, event_types = $4, all_users = $5, active = $6, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING created_at, updated_at
+	`
+	return s.db.QueryRow(query, sub.ID, sub.UserID, sub.URL, sub.EventTypes, sub.AllUsers, sub.Active).
+		Scan(&sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (s *PostgresWebhookStore) DeleteWebhook(userID int, id int64) error {
+	result, err := s.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the subscription's deliveries, newest
+// first, without their attempt logs.
+func (s *PostgresWebhookStore) ListWebhookDeliveries(subscriptionID int64, limit, offset int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+		       next_attempt_at, last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.Query(query, subscriptionID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery returns a delivery of the subscription with its
+// attempt log, oldest attempt first.
+func (s *PostgresWebhookStore) GetWebhookDelivery(subscriptionID, id int64) (*WebhookDelivery, error) {
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+		       next_attempt_at, last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE id = $1 AND subscription_id = $2
+	`
+	delivery, err := scanWebhookDelivery(s.db.QueryRow(query, id, subscriptionID))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT status_code, COALESCE(error, ''), COALESCE(response_body, ''), duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = []WebhookAttempt{}
+	for rows.Next() {
+		var attempt WebhookAttempt
+		err = rows.Scan(&attempt.StatusCode, &attempt.Error, &attempt.ResponseBody, &attempt.DurationMS, &attempt.AttemptedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+	return delivery, rows.Err()
+}
+
+// RedeliverWebhook queues the delivery to be sent again right away with a
+// fresh set of retries, whatever its status. Earlier attempts stay in its
+// log.
+func (s *PostgresWebhookStore) RedeliverWebhook(subscriptionID, id int64) (*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), delivered_at = NULL
+		WHERE id = $1 AND subscription_id = $2
+		RETURNING id, subscription_id, event_id, event_type, payload, status, attempts,
+		          next_attempt_at, last_status_code, last_error, created_at, delivered_at
+	`
+	return scanWebhookDelivery(s.db.QueryRow(query, id, subscriptionID))
+}
+
+// ClaimWebhookDeliveries picks up to limit pending deliveries that are due
+// and hides them from other workers for lease. A worker that dies
+// mid-delivery leaves them to be retried once the lease runs out.
+func (s *PostgresWebhookStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			INNER JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.active
+			ORDER BY d.next_attempt_at, d.id
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2::float8 * INTERVAL '1 second'
+		FROM due, webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret
+	`
+	rows, err := s.db.Query(query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery := &WebhookDelivery{Status: DeliveryPending}
+		var payload string
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt logs an attempt and moves the delivery on: a 2xx
+// response completes it, otherwise it is retried at nextAttemptAt, or
+// given up on when that is nil.
+func (s *PostgresWebhookStore) RecordWebhookAttempt(delivery *WebhookDelivery, attempt *WebhookAttempt, nextAttemptAt *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, response_body, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING attempted_at
+	`
+	err = tx.QueryRow(query, delivery.ID, attempt.StatusCode, nullableString(attempt.Error), nullableString(attempt.ResponseBody), attempt.DurationMS).
+		Scan(&attempt.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	status := DeliveryFailed
+	if attempt.StatusCode != nil && *attempt.StatusCode >= 200 && *attempt.StatusCode < 300 {
+		status, nextAttemptAt = DeliverySucceeded, nil
+	} else if nextAttemptAt != nil {
+		status = DeliveryPending
+	}
+
+	query = `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, next_attempt_at = $3,
+		    last_status_code = $4, last_error = $5,
+		    delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id = $1
+		RETURNING attempts, delivered_at
+	`
+	err = tx.QueryRow(query, delivery.ID, status, nextAttemptAt, attempt.StatusCode, nullableString(attempt.Error)).
+		Scan(&delivery.Attempts, &delivery.DeliveredAt)
+	if err != nil {
+		return err
+	}
+	delivery.Status = status
+	delivery.NextAttemptAt = nextAttemptAt
+
+	return tx.Commit()
+}
+
+// EnqueueWebhookDeliveries queues the outbox event for every active
+// subscription of its user (or of all users) that asks for it, and returns
+// how many were queued. A subscription gets each event once, however often
+// it is enqueued.
+func (s *PostgresWebhookStore) EnqueueWebhookDeliveries(event *OutboxEvent) (int64, error) {
+	body, err := json.Marshal(WebhookPayload{
+		ID:         event.EventID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt.UTC(),
+		Data:       event.Data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, user_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $1, $4
+		FROM webhook_subscriptions
+		WHERE active AND $1 = ANY(event_types) AND (user_id = $2 OR all_users)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+	result, err := s.db.Exec(query, event.Type, event.UserID, event.EventID, string(body))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanWebhook(row rowScanner) (*WebhookSubscription, error) {
+	var (
+		sub        WebhookSubscription
+		eventTypes []byte
+	)
+	err := row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.URL,
+		&eventTypes,
+		&sub.AllUsers,
+		&sub.Active,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// event_types is read as JSON, database/sql can't scan arrays
+	err = json.Unmarshal(eventTypes, &sub.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	var payload string
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = json.RawMessage(payload)
+	if delivery.Status != DeliveryPending {
+		delivery.NextAttemptAt = nil
+	}
+	return delivery, nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// WorkoutBatch runs several workout writes in one transaction. Each write
+// runs under its own savepoint, so a failed write is undone on its own and
+// the batch can carry on with the next one.
+type WorkoutBatch struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+// RunBatch calls fn with a batch for the user's workouts and commits what
+// fn wrote if it returns nil. Returning an error rolls back the whole
+// batch.
+func (pg *PostgresWorkoutStore) RunBatch(userID int, fn func(*WorkoutBatch) error) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = fn(&WorkoutBatch{tx: tx})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (b *WorkoutBatch) GetWorkout(id int64) (*Workout, error) {
+	return getWorkout(b.tx, id)
+}
+
+func (b *WorkoutBatch) CreateWorkout(workout *Workout) error {
+	return b.savepoint(func() error {
+		return insertWorkout(b.tx, workout)
+	})
+}
+
+// UpdateWorkout works like PostgresWorkoutStore.UpdateWorkout.
+func (b *WorkoutBatch) UpdateWorkout(workout *Workout, authorID int) error {
+	return b.savepoint(func() error {
+		return replaceWorkout(b.tx, workout, authorID)
+	})
+}
+
+// DeleteWorkout works like PostgresWorkoutStore.DeleteWorkout.
+func (b *WorkoutBatch) DeleteWorkout(id int64, userID int, expectedVersion int) error {
+	return b.savepoint(func() error {
+		return softDeleteWorkout(b.tx, id, userID, expectedVersion)
+	})
+}
+
+func (b *WorkoutBatch) savepoint(fn func() error) error {
+	b.savepoints++
+	name := fmt.Sprintf("batch_op_%d", b.savepoints)
+
+	_, err := b.tx.Exec("SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		_, rollbackErr := b.tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+
+	_, err = b.tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBatch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, store, user.ID)
+
+	t.Run("failed writes are undone on their own", func(t *testing.T) {
+		created := &Workout{UserID: user.ID, Title: "pull day"}
+		err := store.RunBatch(user.ID, func(b *WorkoutBatch) error {
+			err := b.CreateWorkout(created)
+			require.NoError(t, err)
+
+			stale := *workout
+			stale.Version = workout.Version + 1
+			err = b.UpdateWorkout(&stale, user.ID)
+			assert.ErrorIs(t, err, ErrVersionConflict)
+
+			err = b.DeleteWorkout(int64(workout.ID)+1000, user.ID, 0)
+			assert.ErrorIs(t, err, sql.ErrNoRows)
+			return nil
+		})
+		require.NoError(t, err)
+
+		_, err = store.GetWorkoutByID(int64(created.ID))
+		assert.NoError(t, err)
+		current, err := store.GetWorkoutByID(int64(workout.ID))
+		require.NoError(t, err)
+		assert.Equal(t, workout.Version, current.Version)
+	})
+
+	t.Run("an error rolls back the whole batch", func(t *testing.T) {
+		created := &Workout{UserID: user.ID, Title: "leg day"}
+		errAbort := errors.New("abort")
+		err := store.RunBatch(user.ID, func(b *WorkoutBatch) error {
+			err := b.CreateWorkout(created)
+			require.NoError(t, err)
+			err = b.DeleteWorkout(int64(workout.ID), user.ID, 0)
+			require.NoError(t, err)
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		_, err = store.GetWorkoutByID(int64(created.ID))
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		current, err := store.GetWorkoutByID(int64(workout.ID))
+		require.NoError(t, err)
+		assert.Nil(t, current.DeletedAt)
+	})
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"errors"
+	"math"
+)
+
+// maxWeight is the largest value workout_entries.weight (DECIMAL(5, 2))
+// can hold.
+const maxWeight = 999.99
+
+// ErrWeightOutOfRange is returned when a percentage increase pushes a
+// weight past what can be stored.
+var ErrWeightOutOfRange = errors.New("weight out of range")
+
+// CloneOptions control how CloneWorkout copies the entries.
+type CloneOptions struct {
+	// UserID owns the copy.
+	UserID int
+	// Title replaces the original title when set.
+	Title string
+	// ResetWeights clears the weight of every entry.
+	ResetWeights bool
+	// IncreasePercent scales every weight, e.g. 2.5 for +2.5%. Results are
+	// rounded to two decimals.
+	IncreasePercent float64
+	// DropEntryIDs are entries of the original left out of the copy.
+	DropEntryIDs []int
+}
+
+// CloneWorkout copies the workout and its entries into a new workout dated
+// now. GPS activity data is not copied since it belongs to the session that
+// was recorded. Unknown DropEntryIDs yield ErrEntryNotFound.
+func (pg *PostgresWorkoutStore) CloneWorkout(id int64, opts CloneOptions) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, opts.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := getWorkout(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := opts.apply(original)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertWorkout(tx, clone)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// apply builds the unsaved copy of original.
+func (opts CloneOptions) apply(original *Workout) (*Workout, error) {
+	clone := &Workout{
+		UserID:          opts.UserID,
+		Title:           original.Title,
+		Description:     original.Description,
+		DurationMinutes: original.DurationMinutes,
+		CaloriesBurned:  original.CaloriesBurned,
+		Groups:          make([]EntryGroup, len(original.Groups)),
+		Entries:         []WorkoutEntry{},
+	}
+	// groups emptied by dropped entries are removed when the clone is
+	// inserted
+	for i, group := range original.Groups {
+		group.ID = 0
+		group.RestSeconds = copyPtr(group.RestSeconds)
+		group.ExerciseRestSeconds = copyPtr(group.ExerciseRestSeconds)
+		group.IntervalSeconds = copyPtr(group.IntervalSeconds)
+		group.TimeCapSeconds = copyPtr(group.TimeCapSeconds)
+		clone.Groups[i] = group
+	}
+	if opts.Title != "" {
+		clone.Title = opts.Title
+	}
+
+	drop := make(map[int]bool, len(opts.DropEntryIDs))
+	for _, entryID := range opts.DropEntryIDs {
+		drop[entryID] = true
+	}
+
+	for _, entry := range original.Entries {
+		if drop[entry.ID] {
+			delete(drop, entry.ID)
+			continue
+		}
+
+		copied := WorkoutEntry{
+			ExerciseName:    entry.ExerciseName,
+			Sets:            entry.Sets,
+			Reps:            copyPtr(entry.Reps),
+			DurationSeconds: copyPtr(entry.DurationSeconds),
+			Notes:           entry.Notes,
+			OrderIndex:      len(clone.Entries) + 1,
+			Group:           copyPtr(entry.Group),
+		}
+		if entry.Weight != nil && !opts.ResetWeights {
+			weight := math.Round(*entry.Weight*(100+opts.IncreasePercent)) / 100
+			if weight < 0 || weight > maxWeight {
+				return nil, ErrWeightOutOfRange
+			}
+			copied.Weight = &weight
+		}
+		clone.Entries = append(clone.Entries, copied)
+	}
+
+	if len(drop) > 0 {
+		return nil, ErrEntryNotFound
+	}
+	return clone, nil
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneOptionsApply(t *testing.T) {
+	reps := 5
+	weight := 100.0
+	original := &Workout{
+		ID:     3,
+		UserID: 1,
+		Title:  "Leg day",
+		Entries: []WorkoutEntry{
+			{ID: 10, ExerciseName: "Squat", Sets: 5, Reps: &reps, Weight: &weight, OrderIndex: 1},
+			{ID: 11, ExerciseName: "Lunge", Sets: 3, Reps: &reps, OrderIndex: 2},
+			{ID: 12, ExerciseName: "Leg press", Sets: 3, Reps: &reps, Weight: &weight, OrderIndex: 3},
+		},
+	}
+
+	t.Run("increase and drop", func(t *testing.T) {
+		clone, err := CloneOptions{UserID: 2, IncreasePercent: 2.5, DropEntryIDs: []int{11}}.apply(original)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, clone.UserID)
+		assert.Equal(t, "Leg day", clone.Title)
+		require.Len(t, clone.Entries, 2)
+		assert.Equal(t, "Leg press", clone.Entries[1].ExerciseName)
+		assert.Equal(t, 2, clone.Entries[1].OrderIndex)
+		assert.Equal(t, 102.5, *clone.Entries[0].Weight)
+		assert.Zero(t, clone.Entries[0].ID)
+		// the original must not be touched
+		assert.Equal(t, 100.0, *original.Entries[0].Weight)
+	})
+
+	t.Run("reset weights", func(t *testing.T) {
+		clone, err := CloneOptions{ResetWeights: true}.apply(original)
+		require.NoError(t, err)
+		assert.Nil(t, clone.Entries[0].Weight)
+	})
+
+	t.Run("unknown entry", func(t *testing.T) {
+		_, err := CloneOptions{DropEntryIDs: []int{99}}.apply(original)
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+	})
+
+	t.Run("weight out of range", func(t *testing.T) {
+		heavy := 990.0
+		w := &Workout{Entries: []WorkoutEntry{{ExerciseName: "Deadlift", Reps: &reps, Weight: &heavy}}}
+		_, err := CloneOptions{IncreasePercent: 10}.apply(w)
+		assert.ErrorIs(t, err, ErrWeightOutOfRange)
+	})
+}
@@ -0,0 +1,488 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrEntryNotFound is returned when a write refers to an entry that does not
+// belong to the workout.
+var ErrEntryNotFound = errors.New("workout entry not found")
+
+func queryEntries(q querier, workoutID int64) ([]WorkoutEntry, error) {
+	query := `
+        SELECT id, workout_id, exercise_name, sets, reps, 
+               duration_seconds, weight, notes, order_index, group_id, created_at
+        FROM workout_entries
+        WHERE workout_id = $1
+        ORDER BY order_index, id
+    `
+
+	rows, err := q.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WorkoutEntry
+	for rows.Next() {
+		var entry WorkoutEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.WorkoutID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.Notes,
+			&entry.OrderIndex,
+			&entry.groupID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func insertEntry(q querier, workoutID int, entry *WorkoutEntry) error {
+	query := `
+		INSERT INTO workout_entries (
+			workout_id, exercise_name, sets, reps,
+			duration_seconds, weight, notes, order_index, group_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`
+
+	err := q.QueryRow(
+		query,
+		workoutID,
+		entry.ExerciseName,
+		entry.Sets,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.groupID,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	entry.WorkoutID = workoutID
+	return nil
+}
+
+func updateEntry(q querier, entry *WorkoutEntry) error {
+	query := `
+		UPDATE workout_entries
+		SET exercise_name = $1, sets = $2, reps = $3, duration_seconds = $4,
+		    weight = $5, notes = $6, order_index = $7, group_id = $8
+		WHERE id = $9 AND workout_id = $10
+	`
+
+	result, err := q.Exec(
+		query,
+		entry.ExerciseName,
+		entry.Sets,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.groupID,
+		entry.ID,
+		entry.WorkoutID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+	return nil
+}
+
+// sameEntry reports whether writing b over a would change the stored row.
+func sameEntry(a, b WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		a.Sets == b.Sets &&
+		equalPtr(a.Reps, b.Reps) &&
+		equalPtr(a.DurationSeconds, b.DurationSeconds) &&
+		equalPtr(a.Weight, b.Weight) &&
+		a.Notes == b.Notes &&
+		a.OrderIndex == b.OrderIndex &&
+		equalPtr(a.groupID, b.groupID)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// PatchWorkout stores a partially edited workout. Entries are saved as in
+// UpdateWorkout, except that an entry ID that does not belong to the
+// workout yields ErrEntryNotFound. Groups are matched by ID the same way.
+// Versioning and revisions work as in UpdateWorkout.
+func (pg *PostgresWorkoutStore) PatchWorkout(workout *Workout, authorID int) error {
+	err := prepareEntries(workout)
+	if err != nil {
+		return err
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = updateWorkoutRow(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	err = saveEntryGroups(tx, workout)
+	if err != nil {
+		return err
+	}
+	err = saveEntries(tx, workout, true)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, workout, authorID)
+	if err != nil {
+		return err
+	}
+	err = recordWorkoutChange(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveEntries writes workout.Entries touching only the rows that differ:
+// entries with ID 0 are inserted, changed entries are updated in place and
+// stored entries missing from the list are deleted. Keeping the rows keeps
+// their IDs, and the comments and reactions hanging off them. An ID that
+// isn't one of the workout's entries yields ErrEntryNotFound when strict,
+// otherwise the entry is inserted as new. The entries are reloaded
+// afterwards and groups left empty are dropped.
+func saveEntries(tx *sql.Tx, workout *Workout, strict bool) error {
+	existing, err := queryEntries(tx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+	stored := make(map[int]WorkoutEntry, len(existing))
+	for _, entry := range existing {
+		stored[entry.ID] = entry
+	}
+
+	kept := make(map[int]bool, len(workout.Entries))
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		old, ok := stored[entry.ID]
+		if entry.ID != 0 && (!ok || kept[entry.ID]) {
+			if strict {
+				return ErrEntryNotFound
+			}
+			ok = false
+		}
+		if !ok {
+			err = insertEntry(tx, workout.ID, entry)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		kept[entry.ID] = true
+		entry.WorkoutID = workout.ID
+		entry.CreatedAt = old.CreatedAt
+		if sameEntry(old, *entry) {
+			continue
+		}
+		err = updateEntry(tx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	for id := range stored {
+		if kept[id] {
+			continue
+		}
+		_, err = tx.Exec(`DELETE FROM workout_entries WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = dropEmptyGroups(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+	return loadEntries(tx, workout)
+}
+
+// ErrInvalidEntryOrder is returned by ReorderEntries when the given IDs are
+// not exactly the workout's entries.
+var ErrInvalidEntryOrder = errors.New("entry order must list every entry of the workout exactly once")
+
+func (pg *PostgresWorkoutStore) ListEntries(workoutID int64) ([]WorkoutEntry, error) {
+	workout := &Workout{ID: int(workoutID)}
+	err := loadEntries(pg.db, workout)
+	if err != nil {
+		return nil, err
+	}
+	return workout.Entries, nil
+}
+
+// CreateEntry adds a single entry to the workout. An entry without an
+// order_index is appended after the existing ones; its group, if any, is a
+// position in workout.Groups as loaded. Like the other entry writes it
+// bumps workout.Version (guarded as in UpdateWorkout) and records a
+// revision, without touching the workout's other entries. Writes that
+// would split a group return ErrInvalidEntryGroups.
+func (pg *PostgresWorkoutStore) CreateEntry(workout *Workout, entry *WorkoutEntry, authorID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = bumpWorkoutVersion(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	if entry.OrderIndex == 0 {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(order_index), 0) + 1 FROM workout_entries WHERE workout_id = $1`, workout.ID).
+			Scan(&entry.OrderIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = linkEntryGroup(workout, entry)
+	if err != nil {
+		return err
+	}
+	err = insertEntry(tx, workout.ID, entry)
+	if err != nil {
+		return err
+	}
+
+	err = recordEntryRevision(tx, workout, entry, authorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateEntry overwrites one entry of the workout. ErrEntryNotFound is
+// returned when entry.ID does not belong to it.
+func (pg *PostgresWorkoutStore) UpdateEntry(workout *Workout, entry *WorkoutEntry, authorID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = bumpWorkoutVersion(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	entry.WorkoutID = workout.ID
+	err = linkEntryGroup(workout, entry)
+	if err != nil {
+		return err
+	}
+	err = updateEntry(tx, entry)
+	if err != nil {
+		return err
+	}
+
+	err = recordEntryRevision(tx, workout, entry, authorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresWorkoutStore) DeleteEntry(workout *Workout, entryID int64, authorID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = bumpWorkoutVersion(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM workout_entries WHERE id = $1 AND workout_id = $2`, entryID, workout.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+
+	err = recordEntryRevision(tx, workout, nil, authorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReorderEntries sets order_index of every entry to its 1-based position in
+// entryIDs in a single statement, so readers never see a half applied
+// order.
+func (pg *PostgresWorkoutStore) ReorderEntries(workout *Workout, entryIDs []int64, authorID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = bumpWorkoutVersion(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	existing, err := queryEntries(tx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+	if len(existing) != len(entryIDs) {
+		return ErrInvalidEntryOrder
+	}
+	listed := make(map[int64]bool, len(entryIDs))
+	for _, id := range entryIDs {
+		listed[id] = true
+	}
+	for _, entry := range existing {
+		if !listed[int64(entry.ID)] {
+			return ErrInvalidEntryOrder
+		}
+	}
+
+	query := `
+		UPDATE workout_entries we
+		SET order_index = o.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(id, position)
+		WHERE we.id = o.id AND we.workout_id = $1
+	`
+	_, err = tx.Exec(query, workout.ID, entryIDs)
+	if err != nil {
+		return err
+	}
+
+	err = recordEntryRevision(tx, workout, nil, authorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// bumpWorkoutVersion locks the workout row for an entry write and moves it
+// to the next version, guarded by workout.Version like updateWorkoutRow.
+// The change is recorded by recordEntryRevision, after the write.
+func bumpWorkoutVersion(tx *sql.Tx, workout *Workout) error {
+	query := `
+		UPDATE workouts
+		SET updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+		RETURNING version, updated_at
+	`
+
+	err := tx.QueryRow(query, workout.ID, workout.Version).Scan(&workout.Version, &workout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return versionMismatchOrMissing(tx, int64(workout.ID))
+	}
+	return err
+}
+
+// recordEntryRevision reloads the entries after an entry write so the
+// revision snapshot reflects the whole workout, and refreshes entry (when
+// given) from the stored row, then records the change. Groups the write
+// emptied are dropped; a write that split a group fails with
+// ErrInvalidEntryGroups.
+func recordEntryRevision(tx *sql.Tx, workout *Workout, entry *WorkoutEntry, authorID int) error {
+	err := dropEmptyGroups(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+	err = loadEntries(tx, workout)
+	if err != nil {
+		return err
+	}
+	err = CheckEntryGroups(workout)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		for _, stored := range workout.Entries {
+			if stored.ID == entry.ID {
+				*entry = stored
+			}
+		}
+	}
+
+	err = insertRevision(tx, workout, authorID)
+	if err != nil {
+		return err
+	}
+	return recordWorkoutChange(tx, workout.ID)
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Kinds of entry groups.
+const (
+	// GroupSuperset runs its exercises back to back, then rests.
+	GroupSuperset = "superset"
+	// GroupCircuit is a superset over more stations, usually for several
+	// rounds.
+	GroupCircuit = "circuit"
+	// GroupEMOM starts a round every interval ("every minute on the
+	// minute").
+	GroupEMOM = "emom"
+	// GroupAMRAP repeats the exercises for as many rounds as possible
+	// within the time cap; Rounds records how many were completed.
+	GroupAMRAP = "amrap"
+)
+
+// ErrInvalidEntryGroups is returned for groups that don't fit the entries
+// they are written with. The wrapping error says what is wrong.
+var ErrInvalidEntryGroups = errors.New("invalid entry groups")
+
+// EntryGroup bundles consecutive entries of a workout. Entries point at
+// their group by its position in Workout.Groups, so new groups can be
+// created together with their entries. Groups are listed in the order of
+// their first entry.
+type EntryGroup struct {
+	ID     int    `json:"id"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name,omitempty"`
+	Rounds int    `json:"rounds"`
+	// RestSeconds is the rest after each round, ExerciseRestSeconds the
+	// rest between the exercises of a round.
+	RestSeconds         *int `json:"rest_seconds,omitempty"`
+	ExerciseRestSeconds *int `json:"exercise_rest_seconds,omitempty"`
+	// IntervalSeconds is required for EMOMs, TimeCapSeconds for AMRAPs.
+	IntervalSeconds *int `json:"interval_seconds,omitempty"`
+	TimeCapSeconds  *int `json:"time_cap_seconds,omitempty"`
+}
+
+// CheckEntryGroups validates workout.Groups and how the entries refer to
+// them: every group reference must exist and the entries of a group must
+// be consecutive in order_index. Groups without entries are allowed and
+// dropped when the workout is written. The returned error wraps
+// ErrInvalidEntryGroups.
+func CheckEntryGroups(workout *Workout) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{ErrInvalidEntryGroups}, args...)...)
+	}
+
+	for i, group := range workout.Groups {
+		switch group.Kind {
+		case GroupSuperset, GroupCircuit, GroupEMOM, GroupAMRAP:
+		default:
+			return invalid("groups/%d: kind must be superset, circuit, emom or amrap", i)
+		}
+		if group.Kind == GroupAMRAP && group.Rounds < 0 {
+			return invalid("groups/%d: rounds can't be negative", i)
+		}
+		if group.Kind != GroupAMRAP && group.Rounds < 1 {
+			return invalid("groups/%d: rounds must be at least 1", i)
+		}
+		if negative(group.RestSeconds) || negative(group.ExerciseRestSeconds) {
+			return invalid("groups/%d: rest can't be negative", i)
+		}
+		if (group.Kind == GroupEMOM) != positive(group.IntervalSeconds) {
+			return invalid("groups/%d: interval_seconds is required for emom groups and only allowed there", i)
+		}
+		if (group.Kind == GroupAMRAP) != positive(group.TimeCapSeconds) {
+			return invalid("groups/%d: time_cap_seconds is required for amrap groups and only allowed there", i)
+		}
+	}
+
+	ordered := make([]*WorkoutEntry, len(workout.Entries))
+	for i := range workout.Entries {
+		ordered[i] = &workout.Entries[i]
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].OrderIndex < ordered[j].OrderIndex
+	})
+
+	closed := make(map[int]bool, len(workout.Groups))
+	previous := -1
+	for _, entry := range ordered {
+		current := -1
+		if entry.Group != nil {
+			current = *entry.Group
+			if current < 0 || current >= len(workout.Groups) {
+				return invalid("entry %q refers to group %d, which does not exist", entry.ExerciseName, current)
+			}
+		}
+		if current != previous {
+			if previous >= 0 {
+				closed[previous] = true
+			}
+			if current >= 0 && closed[current] {
+				return invalid("groups/%d: the entries of a group must be consecutive", current)
+			}
+		}
+		previous = current
+	}
+
+	return nil
+}
+
+func negative(i *int) bool {
+	return i != nil && *i < 0
+}
+
+func positive(i *int) bool {
+	return i != nil && *i > 0
+}
+
+// prepareEntries validates the groups and sorts the entries by order_index
+// before a workout is written, so they are inserted in the order they are
+// read back in.
+func prepareEntries(workout *Workout) error {
+	err := CheckEntryGroups(workout)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(workout.Entries, func(i, j int) bool {
+		return workout.Entries[i].OrderIndex < workout.Entries[j].OrderIndex
+	})
+	return nil
+}
+
+// saveEntryGroups writes workout.Groups and points the entries at the
+// stored rows. Groups with an ID are updated in place, groups without one
+// are inserted and groups no longer listed are deleted.
+func saveEntryGroups(tx *sql.Tx, workout *Workout) error {
+	rows, err := tx.Query(`SELECT id FROM workout_entry_groups WHERE workout_id = $1`, workout.ID)
+	if err != nil {
+		return err
+	}
+	stored := map[int]bool{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		stored[id] = true
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	kept := make([]int64, 0, len(workout.Groups))
+	for i := range workout.Groups {
+		group := &workout.Groups[i]
+		if group.ID == 0 {
+			query := `
+				INSERT INTO workout_entry_groups (
+					workout_id, kind, name, rounds, rest_seconds,
+					exercise_rest_seconds, interval_seconds, time_cap_seconds
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id
+			`
+			err = tx.QueryRow(
+				query,
+				workout.ID,
+				group.Kind,
+				group.Name,
+				group.Rounds,
+				group.RestSeconds,
+				group.ExerciseRestSeconds,
+				group.IntervalSeconds,
+				group.TimeCapSeconds,
+			).Scan(&group.ID)
+			if err != nil {
+				return err
+			}
+		} else {
+			if !stored[group.ID] {
+				return fmt.Errorf("%w: groups/%d: unknown id %d", ErrInvalidEntryGroups, i, group.ID)
+			}
+			delete(stored, group.ID)
+
+			query := `
+				UPDATE workout_entry_groups
+				SET kind = $1, name = $2, rounds = $3, rest_seconds = $4,
+				    exercise_rest_seconds = $5, interval_seconds = $6, time_cap_seconds = $7
+				WHERE id = $8
+			`
+			_, err = tx.Exec(
+				query,
+				group.Kind,
+				group.Name,
+				group.Rounds,
+				group.RestSeconds,
+				group.ExerciseRestSeconds,
+				group.IntervalSeconds,
+				group.TimeCapSeconds,
+				group.ID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		kept = append(kept, int64(group.ID))
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_entry_groups WHERE workout_id = $1 AND NOT (id = ANY($2::bigint[]))`, workout.ID, kept)
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Entries {
+		err = linkEntryGroup(workout, &workout.Entries[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkEntryGroup resolves the entry's group position to the stored group.
+func linkEntryGroup(workout *Workout, entry *WorkoutEntry) error {
+	entry.groupID = nil
+	if entry.Group == nil {
+		return nil
+	}
+	if *entry.Group < 0 || *entry.Group >= len(workout.Groups) {
+		return fmt.Errorf("%w: entry %q refers to group %d, which does not exist", ErrInvalidEntryGroups, entry.ExerciseName, *entry.Group)
+	}
+	id := int64(workout.Groups[*entry.Group].ID)
+	entry.groupID = &id
+	return nil
+}
+
+// dropEmptyGroups deletes the groups whose entries are all gone.
+func dropEmptyGroups(tx *sql.Tx, workoutID int) error {
+	query := `
+		DELETE FROM workout_entry_groups g
+		WHERE g.workout_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM workout_entries we WHERE we.group_id = g.id)
+	`
+	_, err := tx.Exec(query, workoutID)
+	return err
+}
+
+// loadEntries reads the workout's entries and groups, orders the groups by
+// their first entry and sets each entry's group position.
+func loadEntries(q querier, workout *Workout) error {
+	entries, err := queryEntries(q, int64(workout.ID))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT id, kind, name, rounds, rest_seconds, exercise_rest_seconds,
+		       interval_seconds, time_cap_seconds
+		FROM workout_entry_groups
+		WHERE workout_id = $1
+		ORDER BY id
+	`
+	rows, err := q.Query(query, workout.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := map[int64]EntryGroup{}
+	for rows.Next() {
+		var group EntryGroup
+		err = rows.Scan(
+			&group.ID,
+			&group.Kind,
+			&group.Name,
+			&group.Rounds,
+			&group.RestSeconds,
+			&group.ExerciseRestSeconds,
+			&group.IntervalSeconds,
+			&group.TimeCapSeconds,
+		)
+		if err != nil {
+			return err
+		}
+		byID[int64(group.ID)] = group
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	groups := []EntryGroup{}
+	position := map[int64]int{}
+	for i := range entries {
+		id := entries[i].groupID
+		if id == nil {
+			continue
+		}
+		if _, ok := position[*id]; !ok {
+			position[*id] = len(groups)
+			groups = append(groups, byID[*id])
+		}
+		p := position[*id]
+		entries[i].Group = &p
+	}
+
+	workout.Entries = entries
+	workout.Groups = groups
+	return nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEntryGroups(t *testing.T) {
+	entry := func(name string, order int, group *int) WorkoutEntry {
+		return WorkoutEntry{ExerciseName: name, Sets: 3, Reps: IntPtr(10), OrderIndex: order, Group: group}
+	}
+	superset := EntryGroup{Kind: GroupSuperset, Rounds: 3, RestSeconds: IntPtr(90)}
+
+	tests := []struct {
+		name    string
+		workout Workout
+		wantErr string
+	}{
+		{
+			name: "consecutive entries",
+			workout: Workout{
+				Groups:  []EntryGroup{superset, {Kind: GroupEMOM, Rounds: 10, IntervalSeconds: IntPtr(60)}},
+				Entries: []WorkoutEntry{entry("Squat", 1, nil), entry("Bench", 2, IntPtr(0)), entry("Row", 3, IntPtr(0)), entry("Burpee", 4, IntPtr(1))},
+			},
+		},
+		{
+			name: "consecutive by order_index, not array position",
+			workout: Workout{
+				Groups:  []EntryGroup{superset},
+				Entries: []WorkoutEntry{entry("Bench", 2, IntPtr(0)), entry("Squat", 3, nil), entry("Row", 1, IntPtr(0))},
+			},
+		},
+		{
+			name: "split group",
+			workout: Workout{
+				Groups:  []EntryGroup{superset},
+				Entries: []WorkoutEntry{entry("Bench", 1, IntPtr(0)), entry("Squat", 2, nil), entry("Row", 3, IntPtr(0))},
+			},
+			wantErr: "groups/0: the entries of a group must be consecutive",
+		},
+		{
+			name:    "unknown group",
+			workout: Workout{Entries: []WorkoutEntry{entry("Bench", 1, IntPtr(0))}},
+			wantErr: "refers to group 0, which does not exist",
+		},
+		{
+			name:    "emom without interval",
+			workout: Workout{Groups: []EntryGroup{{Kind: GroupEMOM, Rounds: 10}}},
+			wantErr: "interval_seconds is required",
+		},
+		{
+			name:    "amrap counts completed rounds",
+			workout: Workout{Groups: []EntryGroup{{Kind: GroupAMRAP, TimeCapSeconds: IntPtr(600)}}},
+		},
+		{
+			name:    "superset without rounds",
+			workout: Workout{Groups: []EntryGroup{{Kind: GroupSuperset}}},
+			wantErr: "rounds must be at least 1",
+		},
+		{
+			name:    "unknown kind",
+			workout: Workout{Groups: []EntryGroup{{Kind: "tabata", Rounds: 8}}},
+			wantErr: "kind must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckEntryGroups(&tt.workout)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidEntryGroups)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WorkoutSummary is a workout as shown in lists, without its entries.
+type WorkoutSummary struct {
+	ID              int       `json:"id"`
+	Version         int       `json:"version"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	DurationMinutes int       `json:"duration_minutes"`
+	CaloriesBurned  int       `json:"calories_burned"`
+	EntryCount      int       `json:"entry_count"`
+	Tags            []Tag     `json:"tags"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type WorkoutStats struct {
+	Workouts             int        `json:"workouts"`
+	TotalDurationMinutes int        `json:"total_duration_minutes"`
+	TotalCaloriesBurned  int        `json:"total_calories_burned"`
+	TotalVolume          float64    `json:"total_volume"`
+	AvgDurationMinutes   float64    `json:"avg_duration_minutes"`
+	FirstWorkoutAt       *time.Time `json:"first_workout_at"`
+	LastWorkoutAt        *time.Time `json:"last_workout_at"`
+	ByTag                []TagStats `json:"by_tag"`
+}
+
+// TagStats breaks WorkoutStats down by the tags of the matching workouts.
+type TagStats struct {
+	TagID                int    `json:"tag_id"`
+	Name                 string `json:"name"`
+	Color                string `json:"color"`
+	Workouts             int    `json:"workouts"`
+	TotalDurationMinutes int    `json:"total_duration_minutes"`
+	TotalCaloriesBurned  int    `json:"total_calories_burned"`
+}
+
+// ListWorkouts returns the workouts matching filter, newest first.
+func (pg *PostgresWorkoutStore) ListWorkouts(filter WorkoutFilter, limit, offset int) ([]*WorkoutSummary, error) {
+	query := `
+		SELECT w.id, w.version, w.title, COALESCE(w.description, ''), w.duration_minutes,
+		       COALESCE(w.calories_burned, 0), w.created_at, w.updated_at,
+		       (SELECT COUNT(*) FROM workout_entries we WHERE we.workout_id = w.id),
+		       COALESCE((
+		           SELECT json_agg(json_build_object('id', t.id, 'name', t.name, 'color', t.color,
+		                                             'created_at', t.created_at, 'updated_at', t.updated_at)
+		                           ORDER BY LOWER(t.name))
+		           FROM workout_tags wt INNER JOIN tags t ON t.id = wt.tag_id
+		           WHERE wt.workout_id = w.id), '[]'::json)
+		FROM workouts w
+		WHERE ` + workoutFilterSQL + `
+		ORDER BY w.created_at DESC, w.id DESC
+		LIMIT $6 OFFSET $7
+	`
+
+	rows, err := pg.db.Query(query, append(filter.args(), limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []*WorkoutSummary{}
+	for rows.Next() {
+		var (
+			workout WorkoutSummary
+			tags    []byte
+		)
+		err = rows.Scan(
+			&workout.ID,
+			&workout.Version,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.CreatedAt,
+			&workout.UpdatedAt,
+			&workout.EntryCount,
+			&tags,
+		)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(tags, &workout.Tags)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, &workout)
+	}
+
+	return workouts, rows.Err()
+}
+
+// GetWorkoutStats aggregates the workouts matching filter. Volume is
+// sets x reps x weight summed over entries that have all three.
+func (pg *PostgresWorkoutStore) GetWorkoutStats(filter WorkoutFilter) (*WorkoutStats, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(w.duration_minutes), 0), COALESCE(SUM(w.calories_burned), 0),
+		       COALESCE((
+		           SELECT SUM(we.sets * we.reps * we.weight)
+		           FROM workout_entries we
+		           WHERE we.workout_id IN (SELECT w.id FROM workouts w WHERE ` + workoutFilterSQL + `)
+		       ), 0),
+		       COALESCE(AVG(w.duration_minutes), 0), MIN(w.created_at), MAX(w.created_at)
+		FROM workouts w
+		WHERE ` + workoutFilterSQL
+
+	var stats WorkoutStats
+	err := pg.db.QueryRow(query, filter.args()...).Scan(
+		&stats.Workouts,
+		&stats.TotalDurationMinutes,
+		&stats.TotalCaloriesBurned,
+		&stats.TotalVolume,
+		&stats.AvgDurationMinutes,
+		&stats.FirstWorkoutAt,
+		&stats.LastWorkoutAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT t.id, t.name, t.color, COUNT(*), COALESCE(SUM(w.duration_minutes), 0), COALESCE(SUM(w.calories_burned), 0)
+		FROM workouts w
+		INNER JOIN workout_tags wt2 ON wt2.workout_id = w.id
+		INNER JOIN tags t ON t.id = wt2.tag_id
+		WHERE ` + workoutFilterSQL + `
+		GROUP BY t.id
+		ORDER BY COUNT(*) DESC, LOWER(t.name)
+	`
+	rows, err := pg.db.Query(query, filter.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.ByTag = []TagStats{}
+	for rows.Next() {
+		var tag TagStats
+		err = rows.Scan(&tag.TagID, &tag.Name, &tag.Color, &tag.Workouts, &tag.TotalDurationMinutes, &tag.TotalCaloriesBurned)
+		if err != nil {
+			return nil, err
+		}
+		stats.ByTag = append(stats.ByTag, tag)
+	}
+
+	return &stats, rows.Err()
+}
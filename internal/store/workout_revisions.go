@@ -0,0 +1,297 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// WorkoutSnapshot is the editable part of a workout as stored in a
+// revision. IDs and timestamps are left out since UpdateWorkout recreates
+// entries and they would show up as noise in every diff.
+type WorkoutSnapshot struct {
+	Title           string          `json:"title"`
+	Description     string          `json:"description"`
+	DurationMinutes int             `json:"duration_minutes"`
+	CaloriesBurned  int             `json:"calories_burned"`
+	Groups          []GroupSnapshot `json:"groups,omitempty"`
+	Entries         []EntrySnapshot `json:"entries"`
+}
+
+// GroupSnapshot is an EntryGroup without its ID.
+type GroupSnapshot struct {
+	Kind                string `json:"kind"`
+	Name                string `json:"name,omitempty"`
+	Rounds              int    `json:"rounds"`
+	RestSeconds         *int   `json:"rest_seconds,omitempty"`
+	ExerciseRestSeconds *int   `json:"exercise_rest_seconds,omitempty"`
+	IntervalSeconds     *int   `json:"interval_seconds,omitempty"`
+	TimeCapSeconds      *int   `json:"time_cap_seconds,omitempty"`
+}
+
+type EntrySnapshot struct {
+	ExerciseName    string   `json:"exercise_name"`
+	Sets            int      `json:"sets"`
+	Reps            *int     `json:"reps,omitempty"`
+	DurationSeconds *int     `json:"duration_seconds,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+	Notes           string   `json:"notes,omitempty"`
+	OrderIndex      int      `json:"order_index"`
+	Group           *int     `json:"group,omitempty"`
+}
+
+type WorkoutRevision struct {
+	Revision  int             `json:"revision"`
+	AuthorID  *int            `json:"author_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Snapshot  WorkoutSnapshot `json:"snapshot"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+func NewWorkoutSnapshot(workout *Workout) WorkoutSnapshot {
+	snapshot := WorkoutSnapshot{
+		Title:           workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		Entries:         []EntrySnapshot{},
+	}
+	for _, g := range workout.Groups {
+		snapshot.Groups = append(snapshot.Groups, GroupSnapshot{
+			Kind:                g.Kind,
+			Name:                g.Name,
+			Rounds:              g.Rounds,
+			RestSeconds:         g.RestSeconds,
+			ExerciseRestSeconds: g.ExerciseRestSeconds,
+			IntervalSeconds:     g.IntervalSeconds,
+			TimeCapSeconds:      g.TimeCapSeconds,
+		})
+	}
+	for _, e := range workout.Entries {
+		snapshot.Entries = append(snapshot.Entries, EntrySnapshot{
+			ExerciseName:    e.ExerciseName,
+			Sets:            e.Sets,
+			Reps:            e.Reps,
+			DurationSeconds: e.DurationSeconds,
+			Weight:          e.Weight,
+			Notes:           e.Notes,
+			OrderIndex:      e.OrderIndex,
+			Group:           e.Group,
+		})
+	}
+	return snapshot
+}
+
+// Apply copies the snapshot onto the workout, replacing its entries and
+// groups. Snapshots don't record IDs, so entries and groups take the IDs
+// of the workout's current ones by position; saving then updates those
+// rows in place rather than replacing them all.
+func (s WorkoutSnapshot) Apply(workout *Workout) {
+	workout.Title = s.Title
+	workout.Description = s.Description
+	workout.DurationMinutes = s.DurationMinutes
+	workout.CaloriesBurned = s.CaloriesBurned
+	groups := workout.Groups
+	workout.Groups = make([]EntryGroup, 0, len(s.Groups))
+	for i, g := range s.Groups {
+		var id int
+		if i < len(groups) {
+			id = groups[i].ID
+		}
+		workout.Groups = append(workout.Groups, EntryGroup{
+			ID:                  id,
+			Kind:                g.Kind,
+			Name:                g.Name,
+			Rounds:              g.Rounds,
+			RestSeconds:         g.RestSeconds,
+			ExerciseRestSeconds: g.ExerciseRestSeconds,
+			IntervalSeconds:     g.IntervalSeconds,
+			TimeCapSeconds:      g.TimeCapSeconds,
+		})
+	}
+	entries := workout.Entries
+	workout.Entries = make([]WorkoutEntry, 0, len(s.Entries))
+	for i, e := range s.Entries {
+		var id int
+		if i < len(entries) {
+			id = entries[i].ID
+		}
+		workout.Entries = append(workout.Entries, WorkoutEntry{
+			ID:              id,
+			WorkoutID:       workout.ID,
+			ExerciseName:    e.ExerciseName,
+			Sets:            e.Sets,
+			Reps:            e.Reps,
+			DurationSeconds: e.DurationSeconds,
+			Weight:          e.Weight,
+			Notes:           e.Notes,
+			OrderIndex:      e.OrderIndex,
+			Group:           e.Group,
+		})
+	}
+}
+
+// DiffSnapshots lists field-level changes from a to b. Entries are
+// compared by position, as are groups; an entry or group present on only
+// one side is reported as a whole.
+func DiffSnapshots(a, b WorkoutSnapshot) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, from, to any) {
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+
+	add("title", a.Title, b.Title)
+	add("description", a.Description, b.Description)
+	add("duration_minutes", a.DurationMinutes, b.DurationMinutes)
+	add("calories_burned", a.CaloriesBurned, b.CaloriesBurned)
+
+	for i := 0; i < len(a.Groups) || i < len(b.Groups); i++ {
+		prefix := fmt.Sprintf("groups[%d]", i)
+		switch {
+		case i >= len(a.Groups):
+			add(prefix, nil, b.Groups[i])
+		case i >= len(b.Groups):
+			add(prefix, a.Groups[i], nil)
+		default:
+			ga, gb := a.Groups[i], b.Groups[i]
+			add(prefix+".kind", ga.Kind, gb.Kind)
+			add(prefix+".name", ga.Name, gb.Name)
+			add(prefix+".rounds", ga.Rounds, gb.Rounds)
+			add(prefix+".rest_seconds", derefInt(ga.RestSeconds), derefInt(gb.RestSeconds))
+			add(prefix+".exercise_rest_seconds", derefInt(ga.ExerciseRestSeconds), derefInt(gb.ExerciseRestSeconds))
+			add(prefix+".interval_seconds", derefInt(ga.IntervalSeconds), derefInt(gb.IntervalSeconds))
+			add(prefix+".time_cap_seconds", derefInt(ga.TimeCapSeconds), derefInt(gb.TimeCapSeconds))
+		}
+	}
+
+	for i := 0; i < len(a.Entries) || i < len(b.Entries); i++ {
+		prefix := fmt.Sprintf("entries[%d]", i)
+		switch {
+		case i >= len(a.Entries):
+			add(prefix, nil, b.Entries[i])
+		case i >= len(b.Entries):
+			add(prefix, a.Entries[i], nil)
+		default:
+			ea, eb := a.Entries[i], b.Entries[i]
+			add(prefix+".exercise_name", ea.ExerciseName, eb.ExerciseName)
+			add(prefix+".sets", ea.Sets, eb.Sets)
+			add(prefix+".reps", derefInt(ea.Reps), derefInt(eb.Reps))
+			add(prefix+".duration_seconds", derefInt(ea.DurationSeconds), derefInt(eb.DurationSeconds))
+			add(prefix+".weight", derefFloat(ea.Weight), derefFloat(eb.Weight))
+			add(prefix+".notes", ea.Notes, eb.Notes)
+			add(prefix+".order_index", ea.OrderIndex, eb.OrderIndex)
+			add(prefix+".group", derefInt(ea.Group), derefInt(eb.Group))
+		}
+	}
+
+	return changes
+}
+
+func derefInt(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func derefFloat(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// insertRevision appends a snapshot of the workout as the next revision.
+func insertRevision(tx *sql.Tx, workout *Workout, authorID int) error {
+	snapshot, err := json.Marshal(NewWorkoutSnapshot(workout))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO workout_revisions (workout_id, revision, author_id, snapshot)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3
+		FROM workout_revisions
+		WHERE workout_id = $1
+	`
+	_, err = tx.Exec(query, workout.ID, nullableID(authorID), snapshot)
+	return err
+}
+
+func (pg *PostgresWorkoutStore) ListRevisions(workoutID int64) ([]*WorkoutRevision, error) {
+	query := `
+		SELECT revision, author_id, created_at, snapshot
+		FROM workout_revisions
+		WHERE workout_id = $1
+		ORDER BY revision
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*WorkoutRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (pg *PostgresWorkoutStore) GetRevision(workoutID int64, revision int) (*WorkoutRevision, error) {
+	query := `
+		SELECT revision, author_id, created_at, snapshot
+		FROM workout_revisions
+		WHERE workout_id = $1 AND revision = $2
+	`
+
+	rev, err := scanRevision(pg.db.QueryRow(query, workoutID, revision))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row rowScanner) (*WorkoutRevision, error) {
+	var (
+		rev      WorkoutRevision
+		authorID sql.NullInt64
+		snapshot []byte
+	)
+	err := row.Scan(&rev.Revision, &authorID, &rev.CreatedAt, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if authorID.Valid {
+		id := int(authorID.Int64)
+		rev.AuthorID = &id
+	}
+
+	err = json.Unmarshal(snapshot, &rev.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
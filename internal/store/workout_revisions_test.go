@@ -0,0 +1,115 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	before := WorkoutSnapshot{
+		Title:           "push day",
+		DurationMinutes: 60,
+		Entries: []EntrySnapshot{
+			{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), Weight: FloatPtr(80), OrderIndex: 1},
+		},
+	}
+	after := WorkoutSnapshot{
+		Title:           "push day",
+		DurationMinutes: 75,
+		Entries: []EntrySnapshot{
+			{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), Weight: FloatPtr(85), OrderIndex: 1},
+			{ExerciseName: "Dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 2},
+		},
+	}
+
+	changes := DiffSnapshots(before, after)
+
+	assert.Equal(t, []FieldChange{
+		{Field: "duration_minutes", From: 60, To: 75},
+		{Field: "entries[0].weight", From: 80.0, To: 85.0},
+		{Field: "entries[1]", From: nil, To: after.Entries[1]},
+	}, changes)
+
+	assert.Empty(t, DiffSnapshots(after, after))
+}
+
+func TestSnapshotApply(t *testing.T) {
+	workout := &Workout{ID: 3, Title: "old"}
+	snapshot := WorkoutSnapshot{
+		Title:   "new",
+		Entries: []EntrySnapshot{{ExerciseName: "Row", Sets: 2, Reps: IntPtr(8), OrderIndex: 1}},
+	}
+
+	snapshot.Apply(workout)
+
+	assert.Equal(t, "new", workout.Title)
+	assert.Len(t, workout.Entries, 1)
+	assert.Equal(t, 3, workout.Entries[0].WorkoutID)
+	assert.Equal(t, snapshot, NewWorkoutSnapshot(workout))
+}
+
+func TestSnapshotApplyKeepsEntryIDs(t *testing.T) {
+	workout := &Workout{ID: 3, Entries: []WorkoutEntry{{ID: 7, ExerciseName: "Row"}}}
+	snapshot := WorkoutSnapshot{
+		Entries: []EntrySnapshot{
+			{ExerciseName: "Row", Sets: 3, Reps: IntPtr(8), OrderIndex: 1},
+			{ExerciseName: "Plank", Sets: 1, DurationSeconds: IntPtr(60), OrderIndex: 2},
+		},
+	}
+
+	snapshot.Apply(workout)
+
+	require.Len(t, workout.Entries, 2)
+	assert.Equal(t, 7, workout.Entries[0].ID)
+	assert.Equal(t, 0, workout.Entries[1].ID)
+}
+
+func TestWorkoutRevisions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, store, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+	)
+	entryID := workout.Entries[0].ID
+
+	workout.Title = "heavy push day"
+	workout.Entries[0].Sets = 5
+	err := store.UpdateWorkout(workout, user.ID)
+	require.NoError(t, err)
+
+	revisions, err := store.ListRevisions(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, 1, revisions[0].Revision)
+	assert.Equal(t, "push day", revisions[0].Snapshot.Title)
+	assert.Equal(t, "heavy push day", revisions[1].Snapshot.Title)
+	require.NotNil(t, revisions[1].AuthorID)
+	assert.Equal(t, user.ID, *revisions[1].AuthorID)
+
+	missing, err := store.GetRevision(int64(workout.ID), 3)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	first, err := store.GetRevision(int64(workout.ID), 1)
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	first.Snapshot.Apply(workout)
+	err = store.UpdateWorkout(workout, user.ID)
+	require.NoError(t, err)
+
+	restored, err := store.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "push day", restored.Title)
+	require.Len(t, restored.Entries, 1)
+	assert.Equal(t, entryID, restored.Entries[0].ID)
+	assert.Equal(t, 3, restored.Entries[0].Sets)
+
+	revisions, err = store.ListRevisions(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Len(t, revisions, 3)
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ts_headline marks matches with these control characters; they are
+// swapped for <mark> tags after the rest of the snippet has been HTML
+// escaped.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// WorkoutSearch is a full-text query over a user's workouts. Every word of
+// Query must match, either fully or as a prefix. Exercise, From and To
+// narrow the results further.
+type WorkoutSearch struct {
+	UserID   int
+	Query    string
+	Exercise string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Offset   int
+}
+
+type WorkoutSearchResult struct {
+	WorkoutID int          `json:"workout_id"`
+	Title     string       `json:"title"`
+	CreatedAt time.Time    `json:"created_at"`
+	Rank      float64      `json:"rank"`
+	Snippet   string       `json:"snippet"`
+	Entries   []EntryMatch `json:"entries"`
+}
+
+// EntryMatch is an entry whose exercise name or notes matched the query.
+type EntryMatch struct {
+	ID           int    `json:"id"`
+	ExerciseName string `json:"exercise_name"`
+	Snippet      string `json:"snippet"`
+}
+
+// SearchWorkouts ranks the user's workouts against search.Query. Matches
+// in titles weigh most, then exercise names, descriptions and notes.
+// Snippets are HTML escaped with matches wrapped in <mark>.
+func (pg *PostgresWorkoutStore) SearchWorkouts(search WorkoutSearch) ([]*WorkoutSearchResult, error) {
+	results := []*WorkoutSearchResult{}
+	tsquery := prefixTSQuery(search.Query)
+	if tsquery == "" {
+		return results, nil
+	}
+
+	// hits goes through the GIN indexes on both tables before anything is
+	// ranked or highlighted
+	query := `
+		WITH q AS (
+			SELECT to_tsquery('english', $2) AS query,
+			       format('StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5', chr(2), chr(3)) AS opts
+		),
+		hits AS (
+			SELECT w.id FROM workouts w, q
+			WHERE w.user_id = $1 AND w.deleted_at IS NULL AND w.search_vector @@ q.query
+			UNION
+			SELECT w.id FROM workout_entries we
+			INNER JOIN workouts w ON w.id = we.workout_id, q
+			WHERE w.user_id = $1 AND w.deleted_at IS NULL AND we.search_vector @@ q.query
+		)
+		SELECT w.id, w.title, w.created_at,
+		       GREATEST(ts_rank(w.search_vector, q.query), COALESCE(MAX(ts_rank(we.search_vector, q.query)), 0)) AS rank,
+		       ts_headline('english', w.title || ' ' || COALESCE(w.description, ''), q.query, q.opts),
+		       COALESCE(json_agg(json_build_object(
+		           'id', we.id,
+		           'exercise_name', we.exercise_name,
+		           'snippet', ts_headline('english', we.exercise_name || ' ' || COALESCE(we.notes, ''), q.query, q.opts)
+		       ) ORDER BY we.order_index) FILTER (WHERE we.id IS NOT NULL), '[]'::json)
+		FROM hits
+		INNER JOIN workouts w ON w.id = hits.id
+		CROSS JOIN q
+		LEFT JOIN workout_entries we ON we.workout_id = w.id AND we.search_vector @@ q.query
+		WHERE ($3 = '' OR EXISTS (
+		          SELECT 1 FROM workout_entries e
+		          WHERE e.workout_id = w.id AND LOWER(e.exercise_name) = LOWER($3)))
+		  AND ($4::timestamptz IS NULL OR w.created_at >= $4)
+		  AND ($5::timestamptz IS NULL OR w.created_at < $5)
+		GROUP BY w.id, q.query, q.opts
+		ORDER BY rank DESC, w.created_at DESC
+		LIMIT $6 OFFSET $7
+	`
+
+	rows, err := pg.db.Query(query, search.UserID, tsquery, search.Exercise, search.From, search.To, search.Limit, search.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			result  WorkoutSearchResult
+			entries []byte
+		)
+		err = rows.Scan(&result.WorkoutID, &result.Title, &result.CreatedAt, &result.Rank, &result.Snippet, &entries)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(entries, &result.Entries)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Snippet = highlight(result.Snippet)
+		for i := range result.Entries {
+			result.Entries[i].Snippet = highlight(result.Entries[i].Snippet)
+		}
+		results = append(results, &result)
+	}
+
+	return results, rows.Err()
+}
+
+// prefixTSQuery turns free text into a to_tsquery expression that ANDs all
+// words as prefixes, so "squ ben" finds "squat" and "bench press". Anything
+// that is not a letter or digit separates words, which also keeps tsquery
+// operators out of user input.
+func prefixTSQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
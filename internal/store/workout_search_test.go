@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixTSQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"squat", "squat:*"},
+		{"  Bench   Press ", "bench:* & press:*"},
+		{"knee & !pain | (ouch)", "knee:* & pain:* & ouch:*"},
+		{"'; DROP TABLE", "drop:* & table:*"},
+		{"!!!", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, prefixTSQuery(tt.in), tt.in)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("felt <b>great</b> on " + highlightStart + "squats" + highlightStop)
+	assert.Equal(t, "felt &lt;b&gt;great&lt;/b&gt; on <mark>squats</mark>", got)
+}
@@ -2,20 +2,36 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
 type Workout struct {
-	ID              int            `json:"id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID              int              `json:"id"`
+	UserID          int              `json:"user_id"`
+	ClientID        string           `json:"client_id"`
+	Version         int              `json:"version"`
+	Title           string           `json:"title"`
+	Description     string           `json:"description"`
+	DurationMinutes int              `json:"duration_minutes"`
+	CaloriesBurned  int              `json:"calories_burned"`
+	Visibility      string           `json:"visibility"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	DeletedAt       *time.Time       `json:"deleted_at,omitempty"`
+	Tags            []Tag            `json:"tags"`
+	Groups          []EntryGroup     `json:"groups"`
+	Entries         []WorkoutEntry   `json:"entries"`
+	Activity        *WorkoutActivity `json:"activity,omitempty"`
+	// CommentCount and Reactions change without a new version; the API
+	// folds them into the workout's ETag
+	CommentCount int            `json:"comment_count"`
+	Reactions    map[string]int `json:"reactions"`
 }
 
+// WorkoutEntry is one exercise of a workout. Group, when set, is the
+// position of the entry's group in Workout.Groups.
 type WorkoutEntry struct {
 	ID              int       `json:"id"`
 	WorkoutID       int       `json:"workout_id"`
@@ -26,7 +42,92 @@ type WorkoutEntry struct {
 	Weight          *float64  `json:"weight,omitempty"`
 	Notes           string    `json:"notes,omitempty"`
 	OrderIndex      int       `json:"order_index"`
+	Group           *int      `json:"group,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
+
+	// groupID is the stored group, resolved from Group on writes
+	groupID *int64
+}
+
+// WorkoutActivity holds the GPS/sensor data of a workout imported from a
+// GPX or TCX file.
+type WorkoutActivity struct {
+	SourceFormat        string            `json:"source_format"`
+	Sport               string            `json:"sport"`
+	StartedAt           time.Time         `json:"started_at"`
+	DistanceMeters      float64           `json:"distance_meters"`
+	DurationSeconds     int               `json:"duration_seconds"`
+	ElevationGainMeters float64           `json:"elevation_gain_meters"`
+	ElevationLossMeters float64           `json:"elevation_loss_meters"`
+	AvgHeartRate        *int              `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate        *int              `json:"max_heart_rate,omitempty"`
+	HeartRateSamples    []HeartRateSample `json:"heart_rate_samples"`
+	Splits              []ActivitySplit   `json:"splits"`
+	Route               [][2]float64      `json:"route"`
+}
+
+// HeartRateSample is the heart rate OffsetSeconds into an activity.
+type HeartRateSample struct {
+	OffsetSeconds int `json:"offset_seconds"`
+	BPM           int `json:"bpm"`
+}
+
+// ActivitySplit covers one stretch of an activity, e.g. its third km.
+type ActivitySplit struct {
+	Index               int     `json:"index"`
+	DistanceMeters      float64 `json:"distance_meters"`
+	DurationSeconds     int     `json:"duration_seconds"`
+	ElevationGainMeters float64 `json:"elevation_gain_meters"`
+	AvgHeartRate        *int    `json:"avg_heart_rate,omitempty"`
+}
+
+// Workout visibilities: who besides the owner may see a workout.
+const (
+	VisibilityPrivate   = "private"
+	VisibilityFollowers = "followers"
+	VisibilityPublic    = "public"
+)
+
+// ValidVisibility reports whether v is one of the workout visibilities.
+func ValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityFollowers || v == VisibilityPublic
+}
+
+// ErrVersionConflict is returned by version-guarded writes when the workout
+// was changed by someone else after the caller read it.
+var ErrVersionConflict = errors.New("workout version conflict")
+
+// WorkoutFilter narrows queries that walk over many workouts. Zero values
+// mean "no restriction".
+type WorkoutFilter struct {
+	UserID int
+	From   *time.Time
+	To     *time.Time
+	// TagIDs keeps workouts carrying any of the tags, or all of them with
+	// MatchAllTags.
+	TagIDs       []int64
+	MatchAllTags bool
+}
+
+// workoutFilterSQL applies a WorkoutFilter to the workouts table aliased
+// as w. It expects the filter's args() as $1 to $5.
+const workoutFilterSQL = `
+		w.deleted_at IS NULL
+		AND ($1 = 0 OR w.user_id = $1)
+		AND ($2::timestamptz IS NULL OR w.created_at >= $2)
+		AND ($3::timestamptz IS NULL OR w.created_at < $3)
+		AND (cardinality($4::bigint[]) = 0 OR CASE
+		    WHEN $5::boolean THEN (
+		        SELECT COUNT(*) FROM workout_tags wt
+		        WHERE wt.workout_id = w.id AND wt.tag_id = ANY($4)) = cardinality($4)
+		    ELSE EXISTS (
+		        SELECT 1 FROM workout_tags wt
+		        WHERE wt.workout_id = w.id AND wt.tag_id = ANY($4))
+		    END)
+`
+
+func (f WorkoutFilter) args() []any {
+	return []any{f.UserID, f.From, f.To, uniqueIDs(f.TagIDs), f.MatchAllTags}
 }
 
 type PostgresWorkoutStore struct {
@@ -40,8 +141,29 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
 	GetWorkoutByID(id int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int64) error
+	UpdateWorkout(workout *Workout, authorID int) error
+	PatchWorkout(workout *Workout, authorID int) error
+	ListEntries(workoutID int64) ([]WorkoutEntry, error)
+	CreateEntry(workout *Workout, entry *WorkoutEntry, authorID int) error
+	UpdateEntry(workout *Workout, entry *WorkoutEntry, authorID int) error
+	DeleteEntry(workout *Workout, entryID int64, authorID int) error
+	ReorderEntries(workout *Workout, entryIDs []int64, authorID int) error
+	DeleteWorkout(id int64, userID int, expectedVersion int) error
+	CreateWorkouts([]*Workout) error
+	ListExerciseNames(userID int) ([]string, error)
+	IterateWorkouts(filter WorkoutFilter, fn func(*Workout) error) error
+	ListDeletedWorkouts(userID int) ([]*Workout, error)
+	RestoreWorkout(id int64, userID int) error
+	PurgeDeletedWorkouts(retention time.Duration) (int64, error)
+	ListRevisions(workoutID int64) ([]*WorkoutRevision, error)
+	GetWorkoutByClientID(userID int, clientID string) (*Workout, error)
+	RunBatch(userID int, fn func(*WorkoutBatch) error) error
+	CloneWorkout(id int64, opts CloneOptions) (*Workout, error)
+	SearchWorkouts(search WorkoutSearch) ([]*WorkoutSearchResult, error)
+	ListWorkouts(filter WorkoutFilter, limit, offset int) ([]*WorkoutSummary, error)
+	GetWorkoutStats(filter WorkoutFilter) (*WorkoutStats, error)
+	ListChanges(userID int, after int64, limit int) ([]WorkoutChange, error)
+	GetRevision(workoutID int64, revision int) (*WorkoutRevision, error)
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -51,78 +173,152 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	}
 	defer tx.Rollback()
 
-	// Insert workout
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// CreateWorkouts inserts all workouts in a single transaction, so either the
+// whole batch is stored or none of it is.
+func (pg *PostgresWorkoutStore) CreateWorkouts(workouts []*Workout) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(workouts) > 0 {
+		err = lockChangeFeed(tx, workouts[0].UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, workout := range workouts {
+		err = insertWorkout(tx, workout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertWorkout(tx *sql.Tx, workout *Workout) error {
+	if workout.ClientID != "" && !ValidClientID(workout.ClientID) {
+		return ErrInvalidClientID
+	}
+	err := prepareEntries(workout)
+	if err != nil {
+		return err
+	}
+
+	// Insert workout, keeping created_at when the caller supplies one
+	// (imports of past sessions) and the client_id of workouts created
+	// offline. Workouts are private unless asked otherwise
 	query := `
-        INSERT INTO workouts (title, description, duration_minutes, calories_burned)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, updated_at
+        INSERT INTO workouts (user_id, client_id, title, description, duration_minutes, calories_burned, visibility, created_at, updated_at)
+        VALUES ($1, COALESCE($2::uuid, gen_random_uuid()), $3, $4, $5, $6, COALESCE($8, 'private'), COALESCE($7::timestamptz, CURRENT_TIMESTAMP), COALESCE($7::timestamptz, CURRENT_TIMESTAMP))
+        ON CONFLICT (user_id, client_id) DO NOTHING
+        RETURNING id, client_id, visibility, created_at, updated_at, version
     `
 
 	err = tx.QueryRow(
 		query,
+		nullableID(workout.UserID),
+		nullableString(workout.ClientID),
 		workout.Title,
 		workout.Description,
 		workout.DurationMinutes,
 		workout.CaloriesBurned,
-	).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
+		nullableTime(workout.CreatedAt),
+		nullableString(workout.Visibility),
+	).Scan(&workout.ID, &workout.ClientID, &workout.Visibility, &workout.CreatedAt, &workout.UpdatedAt, &workout.Version)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateClientID
+	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	// Insert groups, then entries; group IDs of a new workout are always
+	// new
+	for i := range workout.Groups {
+		workout.Groups[i].ID = 0
+	}
+	err = saveEntryGroups(tx, workout)
+	if err != nil {
+		return err
 	}
 
-	// Insert entries
 	for i := range workout.Entries {
-		entryQuery := `
-            INSERT INTO workout_entries (
-                workout_id, exercise_name, sets, reps, 
-                duration_seconds, weight, notes, order_index
-            )
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-            RETURNING id, created_at
-        `
-
-		err = tx.QueryRow(
-			entryQuery,
-			workout.ID,
-			workout.Entries[i].ExerciseName,
-			workout.Entries[i].Sets,
-			workout.Entries[i].Reps,
-			workout.Entries[i].DurationSeconds,
-			workout.Entries[i].Weight,
-			workout.Entries[i].Notes,
-			workout.Entries[i].OrderIndex,
-		).Scan(&workout.Entries[i].ID, &workout.Entries[i].CreatedAt)
+		err = insertEntry(tx, workout.ID, &workout.Entries[i])
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
+
+	err = dropEmptyGroups(tx, workout.ID)
+	if err != nil {
+		return err
+	}
+	err = loadEntries(tx, workout)
+	if err != nil {
+		return err
+	}
 
-		// Set WorkoutID
-		workout.Entries[i].WorkoutID = workout.ID
+	if workout.Activity != nil {
+		err = insertActivity(tx, int64(workout.ID), workout.Activity)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = tx.Commit()
+	err = insertRevision(tx, workout, workout.UserID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return workout, nil
+	return recordWorkoutChange(tx, workout.ID)
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+	return getWorkout(pg.db, id)
+}
+
+func getWorkout(q querier, id int64) (*Workout, error) {
 	// Get workout
 	query := `
-        SELECT id, title, description, duration_minutes, 
-               calories_burned, created_at, updated_at
+        SELECT id, COALESCE(user_id, 0), client_id, version, title, description, duration_minutes, 
+               calories_burned, visibility, created_at, updated_at
         FROM workouts
-        WHERE id = $1
+        WHERE id = $1 AND deleted_at IS NULL
     `
 
 	var workout Workout
-	err := pg.db.QueryRow(query, id).Scan(
+	err := q.QueryRow(query, id).Scan(
 		&workout.ID,
+		&workout.UserID,
+		&workout.ClientID,
+		&workout.Version,
 		&workout.Title,
 		&workout.Description,
 		&workout.DurationMinutes,
 		&workout.CaloriesBurned,
+		&workout.Visibility,
 		&workout.CreatedAt,
 		&workout.UpdatedAt,
 	)
@@ -130,27 +326,200 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 		return nil, err
 	}
 
-	// Get entries
-	entriesQuery := `
-        SELECT id, workout_id, exercise_name, sets, reps, 
-               duration_seconds, weight, notes, order_index, created_at
-        FROM workout_entries
-        WHERE workout_id = $1
-        ORDER BY order_index
-    `
+	// Get entries and their groups
+	err = loadEntries(q, &workout)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.Activity, err = getActivity(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.Tags, err = queryWorkoutTags(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.CommentCount, workout.Reactions, err = queryFeedbackCounts(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workout, nil
+}
+
+func insertActivity(tx *sql.Tx, workoutID int64, a *WorkoutActivity) error {
+	samples, err := json.Marshal(a.HeartRateSamples)
+	if err != nil {
+		return err
+	}
+	splits, err := json.Marshal(a.Splits)
+	if err != nil {
+		return err
+	}
+	route, err := json.Marshal(a.Route)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO workout_activities (
+			workout_id, source_format, sport, started_at, distance_meters,
+			duration_seconds, elevation_gain_meters, elevation_loss_meters,
+			avg_heart_rate, max_heart_rate, heart_rate_samples, splits, route
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err = tx.Exec(
+		query,
+		workoutID,
+		a.SourceFormat,
+		a.Sport,
+		a.StartedAt,
+		a.DistanceMeters,
+		a.DurationSeconds,
+		a.ElevationGainMeters,
+		a.ElevationLossMeters,
+		a.AvgHeartRate,
+		a.MaxHeartRate,
+		samples,
+		splits,
+		route,
+	)
+	return err
+}
+
+func getActivity(q querier, workoutID int64) (*WorkoutActivity, error) {
+	query := `
+		SELECT source_format, sport, started_at, distance_meters, duration_seconds,
+		       elevation_gain_meters, elevation_loss_meters, avg_heart_rate,
+		       max_heart_rate, heart_rate_samples, splits, route
+		FROM workout_activities
+		WHERE workout_id = $1
+	`
+
+	var (
+		a                      WorkoutActivity
+		samples, splits, route []byte
+	)
+	err := q.QueryRow(query, workoutID).Scan(
+		&a.SourceFormat,
+		&a.Sport,
+		&a.StartedAt,
+		&a.DistanceMeters,
+		&a.DurationSeconds,
+		&a.ElevationGainMeters,
+		&a.ElevationLossMeters,
+		&a.AvgHeartRate,
+		&a.MaxHeartRate,
+		&samples,
+		&splits,
+		&route,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(samples, &a.HeartRateSamples)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(splits, &a.Splits)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(route, &a.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
 
-	rows, err := pg.db.Query(entriesQuery, id)
+// ListExerciseNames returns every distinct exercise name the user has
+// logged, used to match names coming from other apps.
+func (pg *PostgresWorkoutStore) ListExerciseNames(userID int) ([]string, error) {
+	query := `
+		SELECT DISTINCT we.exercise_name
+		FROM workout_entries we
+		INNER JOIN workouts w ON w.id = we.workout_id
+		WHERE w.user_id = $1 AND w.deleted_at IS NULL
+		ORDER BY we.exercise_name
+	`
+
+	rows, err := pg.db.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var entries []WorkoutEntry
+	var names []string
 	for rows.Next() {
-		var entry WorkoutEntry
-		err := rows.Scan(
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// IterateWorkouts calls fn once per workout matching the filter, oldest
+// first, with its entries loaded. Rows are read from a single cursor so
+// large histories don't have to fit in memory.
+func (pg *PostgresWorkoutStore) IterateWorkouts(filter WorkoutFilter, fn func(*Workout) error) error {
+	query := `
+		SELECT w.id, COALESCE(w.user_id, 0), w.title, w.description, w.duration_minutes,
+		       w.calories_burned, w.created_at, w.updated_at,
+		       we.id, we.exercise_name, we.sets, we.reps, we.duration_seconds,
+		       we.weight, we.notes, we.order_index, we.created_at
+		FROM workouts w
+		LEFT JOIN workout_entries we ON we.workout_id = w.id
+		WHERE ` + workoutFilterSQL + `
+		ORDER BY w.created_at, w.id, we.order_index, we.id
+	`
+
+	rows, err := pg.db.Query(query, filter.args()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *Workout
+	for rows.Next() {
+		var (
+			workout Workout
+			entry   struct {
+				ID              sql.NullInt64
+				ExerciseName    sql.NullString
+				Sets            sql.NullInt64
+				Reps            *int
+				DurationSeconds *int
+				Weight          *float64
+				Notes           sql.NullString
+				OrderIndex      sql.NullInt64
+				CreatedAt       sql.NullTime
+			}
+			description sql.NullString
+			calories    sql.NullInt64
+		)
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&description,
+			&workout.DurationMinutes,
+			&calories,
+			&workout.CreatedAt,
+			&workout.UpdatedAt,
 			&entry.ID,
-			&entry.WorkoutID,
 			&entry.ExerciseName,
 			&entry.Sets,
 			&entry.Reps,
@@ -161,31 +530,143 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 			&entry.CreatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if current == nil || current.ID != workout.ID {
+			if current != nil {
+				err = fn(current)
+				if err != nil {
+					return err
+				}
+			}
+			workout.Description = description.String
+			workout.CaloriesBurned = int(calories.Int64)
+			current = &workout
+		}
+
+		if entry.ID.Valid {
+			current.Entries = append(current.Entries, WorkoutEntry{
+				ID:              int(entry.ID.Int64),
+				WorkoutID:       current.ID,
+				ExerciseName:    entry.ExerciseName.String,
+				Sets:            int(entry.Sets.Int64),
+				Reps:            entry.Reps,
+				DurationSeconds: entry.DurationSeconds,
+				Weight:          entry.Weight,
+				Notes:           entry.Notes.String,
+				OrderIndex:      int(entry.OrderIndex.Int64),
+				CreatedAt:       entry.CreatedAt.Time,
+			})
 		}
-		entries = append(entries, entry)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
 	}
 
-	workout.Entries = entries
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
 
-	return &workout, nil
+// nullableID maps the zero ID to NULL so rows without an owner can still be
+// written.
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
+// UpdateWorkout replaces the workout and its entries and records the new
+// state as a revision authored by authorID. Entries are matched by ID:
+// listed ones are updated in place, those with ID 0 or an ID the workout
+// doesn't have are added, and unlisted ones are deleted. workout.Version must be the
+// version the caller read (0 skips the check); if the row has moved on
+// since, ErrVersionConflict is returned and nothing is written. On success
+// workout.Version holds the new version.
+func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout, authorID int) error {
 	// Update workout
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, workout.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = replaceWorkout(tx, workout, authorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceWorkout(tx *sql.Tx, workout *Workout, authorID int) error {
+	err := prepareEntries(workout)
+	if err != nil {
+		return err
+	}
+
 	// bisa juuga menggunakan current_timestamp
+	err = updateWorkoutRow(tx, workout)
+	if err != nil {
+		return err
+	}
+
+	err = saveEntryGroups(tx, workout)
+	if err != nil {
+		return err
+	}
+	err = saveEntries(tx, workout, false)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(tx, workout, authorID)
+	if err != nil {
+		return err
+	}
+
+	return recordWorkoutChange(tx, workout.ID)
+}
+
+// DeleteWorkout moves the user's workout to the trash. It stays restorable
+// until PurgeDeletedWorkouts removes it for good. expectedVersion works as
+// in UpdateWorkout; workouts of other users are reported as sql.ErrNoRows.
+func (pg *PostgresWorkoutStore) DeleteWorkout(id int64, userID int, expectedVersion int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = softDeleteWorkout(tx, id, userID, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func softDeleteWorkout(tx *sql.Tx, id int64, userID int, expectedVersion int) error {
 	query := `
 		UPDATE workouts
-		SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, updated_at = NOW()
-		WHERE id = $5
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND user_id = $3 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
 	`
-
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.CaloriesBurned, workout.DurationMinutes, workout.ID)
+	result, err := tx.Exec(query, id, expectedVersion, userID)
 	if err != nil {
 		return err
 	}
@@ -196,44 +677,120 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 	}
 
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		// tell a stale version apart from a workout that is gone or
+		// belongs to someone else
+		var owner int
+		err = tx.QueryRow(`SELECT user_id FROM workouts WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&owner)
+		if err != nil {
+			return err
+		}
+		if owner != userID {
+			return sql.ErrNoRows
+		}
+		return ErrVersionConflict
 	}
 
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	return recordWorkoutChange(tx, int(id))
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx so helpers can run
+// inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// updateWorkoutRow writes the workout's own columns, guarded by
+// workout.Version (0 skips the check), and bumps the version. An empty
+// Visibility keeps the stored one. Callers record the change once the
+// entries are written too, so the event carries the final state.
+func updateWorkoutRow(tx *sql.Tx, workout *Workout) error {
+	query := `
+		UPDATE workouts
+		SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4,
+		    visibility = COALESCE($7, visibility), updated_at = NOW(), version = version + 1
+		WHERE id = $5 AND deleted_at IS NULL AND ($6 = 0 OR version = $6)
+		RETURNING version, visibility, updated_at
+	`
+
+	err := tx.QueryRow(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID, workout.Version, nullableString(workout.Visibility)).
+		Scan(&workout.Version, &workout.Visibility, &workout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return versionMismatchOrMissing(tx, int64(workout.ID))
+	}
+	return err
+}
+
+// versionMismatchOrMissing explains why a version-guarded write touched no
+// rows: the workout is either gone or at a different version.
+func versionMismatchOrMissing(q querier, id int64) error {
+	var version int
+	err := q.QueryRow(`SELECT version FROM workouts WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&version)
 	if err != nil {
 		return err
 	}
+	return ErrVersionConflict
+}
+
+// ListDeletedWorkouts returns the user's trashed workouts, most recently
+// deleted first. Entries are not loaded.
+func (pg *PostgresWorkoutStore) ListDeletedWorkouts(userID int) ([]*Workout, error) {
+	query := `
+		SELECT id, user_id, title, COALESCE(description, ''), duration_minutes,
+		       COALESCE(calories_burned, 0), created_at, updated_at, deleted_at
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	for _, entry := range workout.Entries {
-		entryQuery := `
-			INSERT INTO workout_entries (
-				workout_id, exercise_name, sets, reps, 
-				duration_seconds, weight, notes, order_index
-			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
-		_, err = tx.Exec(
-			entryQuery,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
+	workouts := []*Workout{}
+	for rows.Next() {
+		workout := &Workout{}
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.CreatedAt,
+			&workout.UpdatedAt,
+			&workout.DeletedAt,
 		)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		workouts = append(workouts, workout)
 	}
 
-	return tx.Commit()
+	return workouts, rows.Err()
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
-	query := `DELETE FROM workouts WHERE id = $1`
-	result, err := pg.db.Exec(query, id)
+func (pg *PostgresWorkoutStore) RestoreWorkout(id int64, userID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockChangeFeed(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE workouts
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	`
+	result, err := tx.Exec(query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -247,5 +804,28 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
 		return sql.ErrNoRows
 	}
 
-	return nil
+	err = recordWorkoutChange(tx, int(id))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedWorkouts hard-deletes workouts that have been in the trash
+// longer than retention. Entries go with them through the cascade.
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(retention time.Duration) (int64, error) {
+	query := `DELETE FROM workouts WHERE deleted_at < $1`
+	result, err := pg.db.Exec(query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
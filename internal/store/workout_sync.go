@@ -0,0 +1,172 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// changeFeedLock namespaces the per-user advisory locks taken while writing
+// to workout_changes.
+const changeFeedLock = 36
+
+var clientIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ErrInvalidClientID is returned when a workout is created with a
+// client_id that ValidClientID rejects.
+var ErrInvalidClientID = errors.New("client_id must be a UUID")
+
+// ErrDuplicateClientID is returned when the user already has a workout
+// with the client_id being created.
+var ErrDuplicateClientID = errors.New("client_id already in use")
+
+// ValidClientID reports whether id is a UUID in the lower case form
+// workouts store it in.
+func ValidClientID(id string) bool {
+	return clientIDPattern.MatchString(id)
+}
+
+// WorkoutChange is one entry of a user's change feed: the workout was
+// created or modified, or deleted when Deleted is set.
+type WorkoutChange struct {
+	Seq       int64     `json:"seq"`
+	WorkoutID int       `json:"workout_id"`
+	ClientID  string    `json:"client_id"`
+	Deleted   bool      `json:"deleted"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// recordWorkoutChange appends the workout's current state to its owner's
+// change feed and activity log and to the outbox. Every write to a workout
+// must call it inside the write's transaction, which must hold the owner's
+// lockChangeFeed.
+//
+// Sequence numbers are handed out under that lock, so a user's changes
+// commit in seq order and a client that has seen seq N can never later
+// miss a change below N.
+func recordWorkoutChange(tx *sql.Tx, workoutID int) error {
+	var (
+		userID   sql.NullInt64
+		clientID string
+		deleted  bool
+	)
+	query := `SELECT user_id, client_id, deleted_at IS NOT NULL FROM workouts WHERE id = $1`
+	err := tx.QueryRow(query, workoutID).Scan(&userID, &clientID, &deleted)
+	if err != nil {
+		return err
+	}
+	if !userID.Valid {
+		// workouts without an owner are not synced to anyone
+		return nil
+	}
+
+	eventType, err := workoutEventType(tx, workoutID, deleted)
+	if err != nil {
+		return err
+	}
+	err = recordActivityEvent(tx, eventType, userID.Int64, workoutID)
+	if err != nil {
+		return err
+	}
+	data, err := workoutEventData(tx, eventType, workoutID, userID.Int64, clientID)
+	if err != nil {
+		return err
+	}
+	err = recordOutboxEvent(tx, AggregateWorkout, int64(workoutID), userID.Int64, eventType, data)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO workout_changes (user_id, workout_id, client_id, deleted)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err = tx.Exec(query, userID.Int64, workoutID, clientID, deleted)
+	return err
+}
+
+// lockChangeFeed serializes writers of one user's change feed until the
+// transaction ends. Every transaction writing the user's workouts takes it
+// as its first statement, before any row lock, so writers can only ever
+// wait on each other in one order and never deadlock. Workouts without an
+// owner have no feed and need no lock.
+func lockChangeFeed(tx *sql.Tx, userID int) error {
+	if userID == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1::int, $2::int)`, changeFeedLock, userID)
+	return err
+}
+
+// GetWorkoutByClientID finds a workout by the UUID its client assigned,
+// including workouts in the trash; those come back with DeletedAt set and
+// no entries. sql.ErrNoRows is returned when there is no such workout.
+func (pg *PostgresWorkoutStore) GetWorkoutByClientID(userID int, clientID string) (*Workout, error) {
+	var (
+		id        int64
+		deletedAt *time.Time
+	)
+	query := `SELECT id, deleted_at FROM workouts WHERE user_id = $1 AND client_id = $2`
+	err := pg.db.QueryRow(query, userID, clientID).Scan(&id, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt == nil {
+		return pg.GetWorkoutByID(id)
+	}
+
+	workout := &Workout{ID: int(id), UserID: userID, ClientID: clientID, DeletedAt: deletedAt}
+	query = `SELECT version, title, COALESCE(description, ''), duration_minutes, COALESCE(calories_burned, 0), created_at, updated_at FROM workouts WHERE id = $1`
+	err = pg.db.QueryRow(query, id).Scan(
+		&workout.Version,
+		&workout.Title,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.CreatedAt,
+		&workout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// ListChanges returns up to limit changes of the user with a seq above
+// after, oldest first.
+func (pg *PostgresWorkoutStore) ListChanges(userID int, after int64, limit int) ([]WorkoutChange, error) {
+	query := `
+		SELECT seq, workout_id, client_id, deleted, changed_at
+		FROM workout_changes
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`
+
+	rows, err := pg.db.Query(query, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []WorkoutChange{}
+	for rows.Next() {
+		var change WorkoutChange
+		err = rows.Scan(&change.Seq, &change.WorkoutID, &change.ClientID, &change.Deleted, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// nullableString maps "" to NULL.
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListChanges(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	other := createTestUser(t, db, "prime")
+
+	clientID := "4f1c1a52-8d1e-4d2c-9a55-0a3c8c2b1f10"
+	workout, err := store.CreateWorkout(&Workout{UserID: user.ID, ClientID: clientID, Title: "push day", DurationMinutes: 60})
+	require.NoError(t, err)
+	createTestWorkout(t, store, other.ID)
+
+	workout.Title = "heavy push day"
+	err = store.UpdateWorkout(workout, user.ID)
+	require.NoError(t, err)
+	err = store.DeleteWorkout(int64(workout.ID), user.ID, workout.Version)
+	require.NoError(t, err)
+
+	changes, err := store.ListChanges(user.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	for i, change := range changes {
+		assert.Equal(t, workout.ID, change.WorkoutID)
+		assert.Equal(t, clientID, change.ClientID)
+		assert.Equal(t, i == 2, change.Deleted)
+		if i > 0 {
+			assert.Greater(t, change.Seq, changes[i-1].Seq)
+		}
+	}
+
+	later, err := store.ListChanges(user.ID, changes[1].Seq, 10)
+	require.NoError(t, err)
+	require.Len(t, later, 1)
+	assert.Equal(t, changes[2].Seq, later[0].Seq)
+
+	deleted, err := store.GetWorkoutByClientID(user.ID, clientID)
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+	assert.Equal(t, "heavy push day", deleted.Title)
+	assert.Empty(t, deleted.Entries)
+}
+
+func TestCreateWorkoutClientID(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	other := createTestUser(t, db, "prime")
+
+	clientID := "4f1c1a52-8d1e-4d2c-9a55-0a3c8c2b1f10"
+	_, err := store.CreateWorkout(&Workout{UserID: user.ID, ClientID: clientID, Title: "push day"})
+	require.NoError(t, err)
+
+	_, err = store.CreateWorkout(&Workout{UserID: user.ID, ClientID: clientID, Title: "pull day"})
+	assert.ErrorIs(t, err, ErrDuplicateClientID)
+
+	// client IDs only need to be unique per user
+	_, err = store.CreateWorkout(&Workout{UserID: other.ID, ClientID: clientID, Title: "pull day"})
+	assert.NoError(t, err)
+
+	_, err = store.CreateWorkout(&Workout{UserID: user.ID, ClientID: "not-a-uuid", Title: "pull day"})
+	assert.ErrorIs(t, err, ErrInvalidClientID)
+}
@@ -133,6 +133,120 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func TestUpdateWorkoutKeepsEntryFeedback(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	commentStore := NewPostgresCommentStore(db)
+	user := createTestUser(t, db, "melkey")
+
+	workout := createTestWorkout(t, store, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+	)
+	entryID := int64(workout.Entries[0].ID)
+	_, err := commentStore.AddReaction(&Reaction{WorkoutID: int64(workout.ID), EntryID: &entryID, UserID: user.ID, Emoji: "🔥"})
+	require.NoError(t, err)
+
+	workout.Title = "push day (heavy)"
+	err = store.UpdateWorkout(workout, user.ID)
+	require.NoError(t, err)
+
+	updated, err := store.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "push day (heavy)", updated.Title)
+	require.Len(t, updated.Entries, 1)
+	assert.Equal(t, int(entryID), updated.Entries[0].ID)
+
+	reactions, err := commentStore.ListReactions(int64(workout.ID), &entryID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []ReactionCount{{Emoji: "🔥", Count: 1, Reacted: true}}, reactions)
+}
+
+func TestUpdateWorkoutMatchesEntriesByID(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, store, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+		WorkoutEntry{ExerciseName: "Dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 2},
+	)
+	kept := workout.Entries[0].ID
+	stale := workout.Version
+
+	workout.Entries = []WorkoutEntry{
+		{ID: kept, ExerciseName: "Bench press", Sets: 5, Reps: IntPtr(5), OrderIndex: 1},
+		{ExerciseName: "Push ups", Sets: 2, Reps: IntPtr(20), OrderIndex: 2},
+		// not an entry of the workout, so added as a new one
+		{ID: kept + 1000, ExerciseName: "Plank", Sets: 1, DurationSeconds: IntPtr(60), OrderIndex: 3},
+	}
+	err := store.UpdateWorkout(workout, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stale+1, workout.Version)
+
+	updated, err := store.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, updated.Entries, 3)
+	assert.Equal(t, kept, updated.Entries[0].ID)
+	assert.Equal(t, 5, updated.Entries[0].Sets)
+	assert.Equal(t, "Push ups", updated.Entries[1].ExerciseName)
+	assert.NotEqual(t, kept+1000, updated.Entries[2].ID)
+
+	updated.Version = stale
+	err = store.UpdateWorkout(updated, user.ID)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
+func TestPatchWorkout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "melkey")
+	workout := createTestWorkout(t, store, user.ID,
+		WorkoutEntry{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+		WorkoutEntry{ExerciseName: "Dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 2},
+	)
+	kept := workout.Entries[1].ID
+
+	unknown := *workout
+	unknown.Entries = []WorkoutEntry{{ID: kept + 1000, ExerciseName: "Plank", Sets: 1, DurationSeconds: IntPtr(60), OrderIndex: 1}}
+	err := store.PatchWorkout(&unknown, user.ID)
+	assert.ErrorIs(t, err, ErrEntryNotFound)
+
+	workout.Title = "dips only"
+	workout.Entries = []WorkoutEntry{{ID: kept, ExerciseName: "Dips", Sets: 4, Reps: IntPtr(12), OrderIndex: 1}}
+	err = store.PatchWorkout(workout, user.ID)
+	require.NoError(t, err)
+
+	patched, err := store.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "dips only", patched.Title)
+	assert.Equal(t, 2, patched.Version)
+	require.Len(t, patched.Entries, 1)
+	assert.Equal(t, kept, patched.Entries[0].ID)
+	assert.Equal(t, 4, patched.Entries[0].Sets)
+}
+
+func createTestUser(t *testing.T, db *sql.DB, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com"}
+	err := user.PasswordHash.SetPassword("securepassword")
+	require.NoError(t, err)
+	err = NewPostgresUserStore(db).CreateUser(user)
+	require.NoError(t, err)
+	return user
+}
+
+func createTestWorkout(t *testing.T, store *PostgresWorkoutStore, userID int, entries ...WorkoutEntry) *Workout {
+	created, err := store.CreateWorkout(&Workout{UserID: userID, Title: "push day", DurationMinutes: 60, Entries: entries})
+	require.NoError(t, err)
+	workout, err := store.GetWorkoutByID(int64(created.ID))
+	require.NoError(t, err)
+	return workout
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
@@ -8,7 +8,9 @@ import (
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth       = "authentication"
+	ScopeDataExport = "data_export"
+	ScopeShare      = "workout_share"
 )
 
 type Token struct {
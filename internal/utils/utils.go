@@ -3,8 +3,10 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 )
@@ -36,3 +38,43 @@ func ReadIDParam(r *http.Request) (int64, error) {
 
 	return id, nil
 }
+
+// ReadTimeParam parses an optional query parameter given either as a date
+// (2006-01-02) or an RFC3339 timestamp. With endOfDay a bare date is moved
+// to the start of the next day so it can be used as an exclusive upper
+// bound covering the whole day.
+func ReadTimeParam(r *http.Request, name string, endOfDay bool) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return &t, nil
+	}
+
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter, expected YYYY-MM-DD or RFC3339", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// ReadIntParam parses an optional integer query parameter, returning def
+// when it is absent.
+func ReadIntParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter, expected an integer", name)
+	}
+	return i, nil
+}
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+// Sink is the outbox sink that fans events out into deliveries for the
+// matching subscriptions, which the Worker then sends.
+type Sink struct {
+	Store store.WebhookStore
+}
+
+func (s *Sink) Name() string {
+	return "webhooks"
+}
+
+func (s *Sink) Publish(ctx context.Context, event *store.OutboxEvent) error {
+	_, err := s.Store.EnqueueWebhookDeliveries(event)
+	return err
+}
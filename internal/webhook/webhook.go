@@ -0,0 +1,233 @@
+// Package webhook delivers webhook events to their subscribers. Sink
+// queues a delivery per matching subscription as events leave the outbox,
+// and Worker sends them.
+//
+// Every delivery is a POST of the event's JSON payload with these headers:
+//
+//	X-Webhook-Id         the event ID, the same for every attempt
+//	X-Webhook-Event      the event type
+//	X-Webhook-Timestamp  Unix time of the attempt
+//	X-Webhook-Signature  sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// keyed with the subscription's secret. Receivers should check the
+// signature and reject old timestamps to stop replays. Events may arrive
+// more than once and out of order.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it fails.
+	MaxAttempts = 8
+	// baseBackoff doubles after every failed attempt, up to maxBackoff.
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	// requestTimeout bounds a single attempt; the claim lease has to
+	// outlast it.
+	requestTimeout = 10 * time.Second
+	claimLease     = time.Minute
+	// maxResponseBody is how much of a response is kept in the attempt
+	// log.
+	maxResponseBody = 1024
+)
+
+// ErrPrivateAddress is returned for deliveries to loopback, private and
+// other non-public addresses, so subscriptions can't probe our network.
+var ErrPrivateAddress = errors.New("webhook URL resolves to a non-public address")
+
+// Sign returns the X-Webhook-Signature header value for body sent at
+// timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the wait after the given number of failed attempts, with up
+// to 20% jitter so retries of one outage don't arrive all at once.
+func Backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		wait = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	return wait - time.Duration(rand.Int64N(int64(wait/5)+1))
+}
+
+// Worker sends due deliveries. Several workers, also in other processes,
+// can run against the same store.
+type Worker struct {
+	Store       store.WebhookStore
+	Client      *http.Client
+	Logger      *log.Logger
+	Interval    time.Duration
+	BatchSize   int
+	Concurrency int
+}
+
+// NewWorker returns a worker whose client refuses to connect to
+// non-public addresses.
+func NewWorker(webhookStore store.WebhookStore, logger *log.Logger) *Worker {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Worker{
+		Store: webhookStore,
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   requestTimeout,
+			// a redirect would bypass the subscription's URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Logger:      logger,
+		Interval:    5 * time.Second,
+		BatchSize:   50,
+		Concurrency: 8,
+	}
+}
+
+// Run delivers due webhooks until ctx is done, checking every Interval.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := w.DeliverDue(ctx)
+			if err != nil {
+				w.Logger.Println("ERROR: deliverWebhooks:", err)
+			}
+			if err != nil || n < w.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims a batch of due deliveries, sends them and records the
+// outcome. It returns how many were claimed.
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := w.Store.ClaimWebhookDeliveries(w.BatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(w.Concurrency, 1))
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.deliver(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (w *Worker) deliver(ctx context.Context, delivery *store.WebhookDelivery) {
+	attempt := w.send(ctx, delivery)
+
+	var next *time.Time
+	if delivery.Attempts+1 < MaxAttempts {
+		at := time.Now().Add(Backoff(delivery.Attempts + 1))
+		next = &at
+	}
+	err := w.Store.RecordWebhookAttempt(delivery, attempt, next)
+	if err != nil {
+		// the claim runs out and the delivery is tried again
+		w.Logger.Println("ERROR: recordWebhookAttempt:", err)
+		return
+	}
+	if delivery.Status == store.DeliveryFailed {
+		w.Logger.Printf("INFO: webhook delivery %d to subscription %d failed after %d attempts", delivery.ID, delivery.SubscriptionID, delivery.Attempts)
+	}
+}
+
+// send makes one attempt; failures end up in the returned attempt.
+func (w *Worker) send(ctx context.Context, delivery *store.WebhookDelivery) *store.WebhookAttempt {
+	attempt := &store.WebhookAttempt{}
+	started := time.Now()
+	defer func() {
+		attempt.DurationMS = int(time.Since(started).Milliseconds())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := started.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "femProject-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	status := resp.StatusCode
+	attempt.StatusCode = &status
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// stored as text, which takes neither NUL bytes nor invalid UTF-8
+	attempt.ResponseBody = strings.ToValidUTF8(strings.ReplaceAll(string(body), "\x00", ""), "\uFFFD")
+	if status < 200 || status >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", status)
+	}
+	return attempt
+}
+
+// refusePrivate is a net.Dialer Control hook rejecting connections to
+// addresses that aren't public, after DNS resolution.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
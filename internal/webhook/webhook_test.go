@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Anezz12/femProject/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryWebhookStore struct {
+	store.WebhookStore
+
+	mu       sync.Mutex
+	due      []*store.WebhookDelivery
+	attempts []*store.WebhookAttempt
+	next     []*time.Time
+}
+
+func (m *memoryWebhookStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*store.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := min(limit, len(m.due))
+	claimed := m.due[:n]
+	m.due = m.due[n:]
+	return claimed, nil
+}
+
+func (m *memoryWebhookStore) RecordWebhookAttempt(delivery *store.WebhookDelivery, attempt *store.WebhookAttempt, next *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, attempt)
+	m.next = append(m.next, next)
+	delivery.Attempts++
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac whsec_test
+	assert.Equal(t,
+		"sha256=38877139021993b830af32feea6e18a8da83eb2f6e49ee50bd9e4cf4ca4d3789",
+		Sign("whsec_test", 1700000000, []byte(`{"a":1}`)),
+	)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 5: 8 * time.Minute, 12: maxBackoff, 64: maxBackoff} {
+		got := Backoff(attempts)
+		assert.LessOrEqual(t, got, want, "attempts %d", attempts)
+		assert.GreaterOrEqual(t, got, want*4/5, "attempts %d", attempts)
+	}
+}
+
+func TestWorkerDeliversSignedPayloads(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*http.Request
+		bodies   [][]byte
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+		if r.Header.Get("X-Webhook-Event") == store.EventWorkoutDeleted {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	payload := json.RawMessage(`{"id":"e1","type":"workout.created","data":{"id":3}}`)
+	memory := &memoryWebhookStore{due: []*store.WebhookDelivery{
+		{ID: 1, EventID: "e1", EventType: store.EventWorkoutCreated, Payload: payload, URL: receiver.URL, Secret: "whsec_a"},
+		{ID: 2, EventID: "e2", EventType: store.EventWorkoutDeleted, Payload: payload, URL: receiver.URL, Secret: "whsec_a", Attempts: MaxAttempts - 1},
+		{ID: 3, EventID: "e3", EventType: store.EventWorkoutDeleted, Payload: payload, URL: receiver.URL, Secret: "whsec_a"},
+	}}
+	worker := &Worker{Store: memory, Client: receiver.Client(), Logger: log.New(io.Discard, "", 0), BatchSize: 10, Concurrency: 1}
+
+	n, err := worker.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	require.Len(t, received, 3)
+
+	r := received[0]
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, "e1", r.Header.Get("X-Webhook-Id"))
+	assert.Equal(t, Sign("whsec_a", timestamp, bodies[0]), r.Header.Get("X-Webhook-Signature"))
+	assert.JSONEq(t, string(payload), string(bodies[0]))
+
+	require.Len(t, memory.attempts, 3)
+	assert.Equal(t, 200, *memory.attempts[0].StatusCode)
+	assert.Empty(t, memory.attempts[0].Error)
+	assert.Equal(t, 500, *memory.attempts[1].StatusCode)
+	assert.Equal(t, "boom\n", memory.attempts[1].ResponseBody)
+	assert.Nil(t, memory.next[1], "the last attempt gives up")
+	require.NotNil(t, memory.next[2])
+	assert.WithinDuration(t, time.Now().Add(baseBackoff), *memory.next[2], baseBackoff/5+time.Second)
+}
+
+func TestRefusePrivate(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "10.1.2.3:443", "192.168.0.10:443", "169.254.169.254:80", "[::1]:443", "[fd00::1]:443", "0.0.0.0:80"} {
+		assert.ErrorIs(t, refusePrivate("tcp", address, nil), ErrPrivateAddress, address)
+	}
+	assert.NoError(t, refusePrivate("tcp", "93.184.216.34:443", nil))
+
+	worker := NewWorker(&memoryWebhookStore{}, log.New(io.Discard, "", 0))
+	resp, err := worker.Client.Post("http://127.0.0.1:9/", "application/json", strings.NewReader("{}"))
+	if resp != nil {
+		resp.Body.Close()
+	}
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+}
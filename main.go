@@ -1,19 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Anezz12/femProject/internal/app"
+	"github.com/Anezz12/femProject/internal/outbox"
 	"github.com/Anezz12/femProject/internal/routes"
 )
 
+// shutdownTimeout is how long requests in flight get to finish on
+// shutdown.
+const shutdownTimeout = 20 * time.Second
+
 func main() {
 
 	var port int
+	var trashRetention time.Duration
+	var outboxLog string
 	flag.IntVar(&port, "port", 8080, "Port to run the server on")
+	flag.DurationVar(&trashRetention, "trash-retention", 30*24*time.Hour, "How long deleted workouts stay restorable")
+	flag.StringVar(&outboxLog, "outbox-log", "", "Append every published domain event to this file as JSON lines")
 	flag.Parse()
 
 	app, err := app.NewApplication()
@@ -23,6 +37,31 @@ func main() {
 
 	defer app.DB.Close()
 
+	if outboxLog != "" {
+		logFile, err := outbox.OpenLogFile(outboxLog)
+		if err != nil {
+			app.Logger.Fatalf("Error opening outbox log: %s", err)
+		}
+		defer logFile.Close()
+		app.Outbox.Sinks = append(app.Outbox.Sinks, logFile)
+	}
+
+	// SIGINT and SIGTERM stop the server and the background workers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app.ScheduleMaintenance(trashRetention)
+	go app.Scheduler.Run(ctx)
+	go app.Webhooks.Run(ctx)
+	go app.Outbox.Run(ctx)
+	go app.LiveHub.Run(ctx)
+
+	jobsDone := make(chan struct{})
+	go func() {
+		app.Jobs.Run(ctx)
+		close(jobsDone)
+	}()
+
 	r := routes.SetupRoutes(app)
 
 	server := &http.Server{
@@ -32,12 +71,31 @@ func main() {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	server.RegisterOnShutdown(app.EventHandler.Shutdown)
+	server.RegisterOnShutdown(app.LiveHub.Shutdown)
 
 	app.Logger.Println(fmt.Sprintf("Application started at port %d", port))
 
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		<-ctx.Done()
+		app.Logger.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			app.Logger.Printf("Error shutting down server: %s", err)
+		}
+	}()
+
 	err = server.ListenAndServe()
-	if err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		app.Logger.Fatalf("Error starting server: %s", err)
 	}
 
+	// let requests and jobs in flight finish before the database is closed
+	<-serverDone
+	<-jobsDone
+	app.Logger.Println("Application stopped")
 }
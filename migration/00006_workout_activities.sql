@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_activities (
+  workout_id BIGINT PRIMARY KEY REFERENCES workouts(id) ON DELETE CASCADE,
+  source_format VARCHAR(10) NOT NULL,
+  sport VARCHAR(50) NOT NULL,
+  started_at TIMESTAMP WITH TIME ZONE,
+  distance_meters DOUBLE PRECISION NOT NULL DEFAULT 0,
+  duration_seconds INTEGER NOT NULL DEFAULT 0,
+  elevation_gain_meters DOUBLE PRECISION NOT NULL DEFAULT 0,
+  elevation_loss_meters DOUBLE PRECISION NOT NULL DEFAULT 0,
+  avg_heart_rate INTEGER,
+  max_heart_rate INTEGER,
+  heart_rate_samples JSONB NOT NULL DEFAULT '[]',
+  splits JSONB NOT NULL DEFAULT '[]',
+  -- simplified [lat, lon] polyline
+  route JSONB NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_activities;
+-- +goose StatementEnd
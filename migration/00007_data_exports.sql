@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS data_exports (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  archive BYTEA,
+  error TEXT,
+  download_hash BYTEA UNIQUE NOT NULL,
+  download_expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- user_id is kept without a foreign key on purpose, the user row is gone
+-- by the time we write here
+CREATE TABLE IF NOT EXISTS erasure_log (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  erased_records JSONB NOT NULL,
+  erased_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE erasure_log;
+DROP TABLE data_exports;
+-- +goose StatementEnd
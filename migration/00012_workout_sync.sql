@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- gen_random_uuid() is only built in from Postgres 13
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS client_id UUID NOT NULL DEFAULT gen_random_uuid();
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workouts_user_client_id ON workouts (user_id, client_id);
+
+-- one row per write to a workout, read by the sync change feed. workout_id
+-- has no foreign key so the feed still knows about purged workouts
+CREATE TABLE IF NOT EXISTS workout_changes (
+  seq BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  workout_id BIGINT NOT NULL,
+  client_id UUID NOT NULL,
+  deleted BOOLEAN NOT NULL DEFAULT FALSE,
+  changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_changes_user_seq ON workout_changes (user_id, seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_changes;
+DROP INDEX IF EXISTS idx_workouts_user_client_id;
+ALTER TABLE workouts DROP COLUMN client_id;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_search_vector ON workouts USING GIN (search_vector);
+
+ALTER TABLE workout_entries ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(exercise_name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(notes, '')), 'C')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_search_vector ON workout_entries USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workout_entries_search_vector;
+ALTER TABLE workout_entries DROP COLUMN search_vector;
+DROP INDEX IF EXISTS idx_workouts_search_vector;
+ALTER TABLE workouts DROP COLUMN search_vector;
+-- +goose StatementEnd
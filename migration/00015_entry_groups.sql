@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- supersets, circuits, EMOMs and AMRAPs. A group's entries are consecutive
+-- in order_index; the group itself has no position of its own
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  kind VARCHAR(20) NOT NULL,
+  name VARCHAR(100) NOT NULL DEFAULT '',
+  rounds INTEGER NOT NULL DEFAULT 1,
+  rest_seconds INTEGER,
+  exercise_rest_seconds INTEGER,
+  interval_seconds INTEGER,
+  time_cap_seconds INTEGER,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT valid_entry_group CHECK (
+    kind IN ('superset', 'circuit', 'emom', 'amrap') AND
+    rounds >= 0 AND
+    (rest_seconds IS NULL OR rest_seconds >= 0) AND
+    (exercise_rest_seconds IS NULL OR exercise_rest_seconds >= 0) AND
+    ((kind = 'emom') = (interval_seconds IS NOT NULL AND interval_seconds > 0)) AND
+    ((kind = 'amrap') = (time_cap_seconds IS NOT NULL AND time_cap_seconds > 0))
+  )
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_entry_groups_workout_id ON workout_entry_groups (workout_id);
+
+ALTER TABLE workout_entries ADD COLUMN IF NOT EXISTS group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_group_id ON workout_entries (group_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN group_id;
+DROP TABLE workout_entry_groups;
+-- +goose StatementEnd
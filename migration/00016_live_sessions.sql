@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- workouts in progress. state holds the session as the devices see it and
+-- seq counts the events applied to it
+CREATE TABLE IF NOT EXISTS live_sessions (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  template_workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'active',
+  seq BIGINT NOT NULL DEFAULT 0,
+  state JSONB NOT NULL,
+  workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+  started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  ended_at TIMESTAMP WITH TIME ZONE,
+  CONSTRAINT valid_live_session_status CHECK (status IN ('active', 'finished', 'abandoned'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_live_sessions_user_active ON live_sessions (user_id) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE live_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the log behind the /events stream. Readers only see events of
+-- transactions older than every running one (see ListActivityEvents), so
+-- they page by (tx_id, id) rather than by id alone. workout_id has no
+-- foreign key so events of purged workouts stay readable
+CREATE TABLE IF NOT EXISTS activity_events (
+  id BIGSERIAL PRIMARY KEY,
+  tx_id BIGINT NOT NULL DEFAULT txid_current(),
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  workout_id BIGINT NOT NULL,
+  type VARCHAR(30) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT valid_activity_event_type CHECK (type IN ('workout.created', 'workout.updated', 'workout.deleted'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_events_user_position ON activity_events (user_id, tx_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE activity_events;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- domain events waiting to be published, written in the transaction of the
+-- change they describe. Rows are deleted once every sink has the event;
+-- published_to remembers the sinks that already do while others are
+-- retried. Events of one aggregate are published in id order
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  event_id VARCHAR(32) NOT NULL UNIQUE,
+  aggregate_type VARCHAR(30) NOT NULL,
+  aggregate_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  event_type VARCHAR(30) NOT NULL,
+  payload TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  published_to TEXT[] NOT NULL DEFAULT '{}',
+  last_error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate ON outbox (aggregate_type, aggregate_id, id);
+CREATE INDEX IF NOT EXISTS idx_outbox_user_id ON outbox (user_id);
+
+-- the webhook sink may see an event twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (subscription_id, event_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_webhook_deliveries_event;
+DROP TABLE outbox;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the last run of every scheduled task. slot is the time the run was
+-- scheduled for; a slot is only ever claimed once, so a task runs once per
+-- slot however many instances are up
+CREATE TABLE IF NOT EXISTS scheduled_task_runs (
+  name VARCHAR(50) PRIMARY KEY,
+  slot TIMESTAMP WITH TIME ZONE NOT NULL,
+  started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  finished_at TIMESTAMP WITH TIME ZONE,
+  last_error TEXT
+);
+
+-- refreshed by the scheduler; days are UTC and trashed workouts don't count
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_workout_stats AS
+SELECT (created_at AT TIME ZONE 'UTC')::date AS day,
+       COUNT(*) AS workouts,
+       COUNT(DISTINCT user_id) AS active_users,
+       COALESCE(SUM(duration_minutes), 0) AS total_duration_minutes,
+       COALESCE(SUM(calories_burned), 0) AS total_calories_burned
+FROM workouts
+WHERE deleted_at IS NULL
+GROUP BY 1;
+
+-- REFRESH ... CONCURRENTLY needs a unique index
+CREATE UNIQUE INDEX IF NOT EXISTS idx_daily_workout_stats_day ON daily_workout_stats (day);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_expiry ON tokens (expiry);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_tokens_expiry;
+DROP MATERIALIZED VIEW daily_workout_stats;
+DROP TABLE scheduled_task_runs;
+-- +goose StatementEnd
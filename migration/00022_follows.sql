@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- following a private account needs the owner's approval; until then the
+-- follow is pending
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follows (
+  follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(20) NOT NULL DEFAULT 'accepted' CHECK (status IN ('pending', 'accepted')),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  accepted_at TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (follower_id, followee_id),
+  CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee ON follows (followee_id, status);
+
+-- existing workouts stay private to their owner
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'private'
+  CHECK (visibility IN ('private', 'followers', 'public'));
+
+-- the feed reads every followed user's workouts newest first
+CREATE INDEX IF NOT EXISTS idx_workouts_user_created ON workouts (user_id, created_at DESC) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_workouts_user_created;
+ALTER TABLE workouts DROP COLUMN visibility;
+DROP TABLE follows;
+ALTER TABLE users DROP COLUMN is_private;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- comments thread through parent_id. Deleting a comment only marks it, so
+-- the replies below it stay in place; erasing a user turns the replies to
+-- their comments into top level ones. Entries are replaced on every full
+-- update of a workout, so comments on one fall back to the workout
+CREATE TABLE IF NOT EXISTS workout_comments (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  entry_id BIGINT REFERENCES workout_entries(id) ON DELETE SET NULL,
+  parent_id BIGINT REFERENCES workout_comments(id) ON DELETE SET NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  edited_at TIMESTAMP WITH TIME ZONE,
+  deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_comments_workout ON workout_comments (workout_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_workout_comments_parent ON workout_comments (parent_id);
+CREATE INDEX IF NOT EXISTS idx_workout_comments_user ON workout_comments (user_id);
+
+-- one reaction per user, emoji and target; entry_id is NULL for reactions
+-- to the whole workout
+CREATE TABLE IF NOT EXISTS workout_reactions (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  entry_id BIGINT REFERENCES workout_entries(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  emoji VARCHAR(32) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_reactions_unique
+  ON workout_reactions (workout_id, COALESCE(entry_id, 0), user_id, emoji);
+CREATE INDEX IF NOT EXISTS idx_workout_reactions_user ON workout_reactions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_reactions;
+DROP TABLE workout_comments;
+-- +goose StatementEnd
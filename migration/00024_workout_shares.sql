@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- read-only links to a workout for people without an account. Only the
+-- hash of the token is stored; expires_at is NULL for links that don't
+-- expire
+CREATE TABLE IF NOT EXISTS workout_shares (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash BYTEA UNIQUE NOT NULL,
+  expires_at TIMESTAMP(0) WITH TIME ZONE,
+  revoked_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_shares_workout ON workout_shares (workout_id);
+CREATE INDEX IF NOT EXISTS idx_workout_shares_user ON workout_shares (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_shares;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- workouts created before revisions were recorded have none, so their
+-- original state could not be restored once edited. Snapshot them as
+-- revision 1, in the format of WorkoutSnapshot; they predate entry groups,
+-- so there are none to include
+INSERT INTO workout_revisions (workout_id, revision, author_id, snapshot, created_at)
+SELECT w.id, 1, w.user_id,
+       jsonb_build_object(
+         'title', w.title,
+         'description', COALESCE(w.description, ''),
+         'duration_minutes', w.duration_minutes,
+         'calories_burned', COALESCE(w.calories_burned, 0),
+         'entries', COALESCE((
+           SELECT jsonb_agg(jsonb_strip_nulls(jsonb_build_object(
+                    'exercise_name', we.exercise_name,
+                    'sets', we.sets,
+                    'reps', we.reps,
+                    'duration_seconds', we.duration_seconds,
+                    'weight', we.weight,
+                    'notes', NULLIF(we.notes, ''),
+                    'order_index', we.order_index
+                  )) ORDER BY we.order_index, we.id)
+           FROM workout_entries we
+           WHERE we.workout_id = w.id
+         ), '[]'::jsonb)
+       ),
+       w.created_at
+FROM workouts w
+WHERE NOT EXISTS (SELECT 1 FROM workout_revisions r WHERE r.workout_id = w.id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- the backfilled revisions are kept: they can't be told apart from the
+-- recorded ones, and dropping them would lose history again
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the user whose event a delivery carries, which is not always the owner of
+-- the subscription (all_users subscriptions get everyone's events). Erasing
+-- the user erases the deliveries with their data
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS user_id BIGINT;
+
+UPDATE webhook_deliveries
+SET user_id = CASE
+      WHEN event_type LIKE 'user.%' THEN (payload::jsonb #>> '{data,id}')::bigint
+      ELSE (payload::jsonb #>> '{data,user_id}')::bigint
+    END;
+
+-- deliveries of users erased before, or that can't be told whose they are
+DELETE FROM webhook_deliveries d
+WHERE d.user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = d.user_id);
+
+ALTER TABLE webhook_deliveries ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE webhook_deliveries ADD CONSTRAINT webhook_deliveries_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_user_id ON webhook_deliveries (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE webhook_deliveries DROP COLUMN user_id;
+-- +goose StatementEnd